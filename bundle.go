@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"time"
+)
+
+//version is set at build time with -ldflags "-X main.version=..."
+var version = "dev"
+
+//runSupportBundle writes a support bundle next to the saved data and prints where it is
+func runSupportBundle() (err error) {
+
+	updater, err := newUpdater(nil)
+	if err != nil {
+		return
+	}
+
+	bundlePath := path.Join(path.Dir(savePath), fmt.Sprintf("go-cloudflare-ddns-support-%s.zip", time.Now().Format("20060102-150405")))
+
+	f, err := os.OpenFile(bundlePath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return
+	}
+	if err = updater.WriteSupportBundle(f, version); err != nil {
+		f.Close()
+		os.Remove(bundlePath)
+		return
+	}
+	if err = f.Close(); err != nil {
+		return
+	}
+
+	fmt.Printf("Support bundle written to %v\n", bundlePath)
+	fmt.Println("Credentials and webhook URLs are removed, but it includes host names and IP addresses. Check it before sharing.")
+	return
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/jonegerton/go-cloudflare-ddns/ddns"
+)
+
+//envPrefix is added to a flag's name, in upper case with dashes as underscores, to give its environment variable
+const envPrefix = "DDNS_"
+
+//secretFlags are masked when showing the configuration
+var secretFlags = map[string]bool{"cfkey": true, "cftoken": true, "router-password": true}
+
+//urlPattern finds URLs within a setting, eg in scrape:<url> or a host entry's source, to mask their credentials
+var urlPattern = regexp.MustCompile(`[a-zA-Z][a-zA-Z0-9+.-]*://[^\s,]+`)
+
+//flagSources records where each flag's value came from: flag, env, file or default
+var flagSources = map[string]string{}
+
+//envName returns the environment variable for a flag, eg DDNS_CFZONE for -cfzone
+func envName(name string) string {
+	return envPrefix + strings.ToUpper(strings.Replace(name, "-", "_", -1))
+}
+
+//applyConfigSources fills in flags not given on the command line from the environment, then from the -config file.
+//Flags given on the command line win over the environment, which wins over the file.
+func applyConfigSources() (err error) {
+
+	flag.Visit(func(f *flag.Flag) {
+		flagSources[f.Name] = "flag"
+	})
+
+	if configPath == "" {
+		configPath = os.Getenv(envName("config"))
+	}
+	var file map[string]interface{}
+	if configPath != "" {
+		if file, err = readConfigFile(configPath); err != nil {
+			return
+		}
+	}
+
+	flag.VisitAll(func(f *flag.Flag) {
+		if err != nil || flagSources[f.Name] != "" {
+			return
+		}
+		flagSources[f.Name] = "default"
+
+		if value, ok := os.LookupEnv(envName(f.Name)); ok {
+			flagSources[f.Name] = "env"
+			if setErr := setFromEnv(f, value); setErr != nil {
+				err = fmt.Errorf("Invalid value '%v' for %v: %v", value, envName(f.Name), setErr)
+			}
+			return
+		}
+
+		if value, ok := file[f.Name]; ok {
+			flagSources[f.Name] = "file"
+			if setErr := setFromFile(f, value); setErr != nil {
+				err = fmt.Errorf("Invalid value for %v in %v: %v", f.Name, configPath, setErr)
+			}
+		}
+	})
+
+	return
+}
+
+//setFromEnv sets a flag from an environment variable. Repeatable flags take one value per line.
+func setFromEnv(f *flag.Flag, value string) error {
+
+	values := []string{value}
+	if _, repeatable := f.Value.(*arrayFlags); repeatable {
+		values = strings.Split(strings.TrimSpace(value), "\n")
+	}
+	for _, v := range values {
+		if err := f.Value.Set(strings.TrimSpace(v)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//readConfigFile reads a JSON object of flag names and values, eg {"cfzone": "example.com", "cfhost": ["home", "vpn"]}
+func readConfigFile(configPath string) (file map[string]interface{}, err error) {
+
+	data, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		err = fmt.Errorf("Error reading config file: %v", err)
+		return
+	}
+	if err = json.Unmarshal(data, &file); err != nil {
+		err = fmt.Errorf("Error parsing config file %v: %v", configPath, err)
+		return
+	}
+
+	for name := range file {
+		if flag.Lookup(name) == nil || name == "config" {
+			err = fmt.Errorf("Config file %v has an unknown setting '%v'", configPath, name)
+			return
+		}
+	}
+
+	return
+}
+
+//setFromFile sets a flag from a config file value. Lists set repeatable flags once for each item.
+func setFromFile(f *flag.Flag, value interface{}) error {
+
+	list, ok := value.([]interface{})
+	if !ok {
+		list = []interface{}{value}
+	}
+	for _, item := range list {
+		if err := f.Value.Set(settingText(item)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//settingText returns a config file value as it would be given as a flag. Objects, such as -payload-patch, are given as JSON.
+func settingText(value interface{}) string {
+	if object, ok := value.(map[string]interface{}); ok {
+		if data, err := json.Marshal(object); err == nil {
+			return string(data)
+		}
+	}
+	return fmt.Sprint(value)
+}
+
+//givenSettings returns the settings given as flags, in the environment or in the -config file, as they would be
+//written to a config file. Settings named in skip are left out.
+func givenSettings(skip map[string]bool) (settings map[string]interface{}) {
+
+	settings = map[string]interface{}{}
+	flag.VisitAll(func(f *flag.Flag) {
+		if skip[f.Name] || flagSources[f.Name] == "default" || flagSources[f.Name] == "" {
+			return
+		}
+		switch value := f.Value.(type) {
+		case *arrayFlags:
+			settings[f.Name] = []string(*value)
+		case flag.Getter:
+			if b, ok := value.Get().(bool); ok {
+				settings[f.Name] = b
+				return
+			}
+			settings[f.Name] = value.String()
+		default:
+			settings[f.Name] = value.String()
+		}
+	})
+
+	return
+}
+
+//showConfig prints every setting with where it came from, masking secrets, followed by the host entries as they will be used
+func showConfig() (err error) {
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SETTING\tVALUE\tFROM")
+
+	var names []string
+	flag.VisitAll(func(f *flag.Flag) {
+		if !hiddenFlags[f.Name] || flagSources[f.Name] != "default" {
+			names = append(names, f.Name)
+		}
+	})
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Fprintf(w, "%v\t%v\t%v\n", name, maskedValue(name, flag.Lookup(name).Value.String()), flagSources[name])
+	}
+	if configPath != "" {
+		fmt.Fprintf(w, "\nConfig file: %v\n", configPath)
+	}
+	w.Flush()
+
+	var extraHosts []ddns.Host
+	if hostsFrom != "" {
+		if extraHosts, err = readHostsFrom(hostsFrom); err != nil {
+			return
+		}
+	}
+	updater, err := newUpdater(extraHosts)
+	if err != nil {
+		return
+	}
+
+	fmt.Println()
+	if len(updater.Hosts()) == 0 {
+		fmt.Println("No host entries.")
+	}
+	for _, host := range updater.Hosts() {
+		source := host.Source
+		if source == "" {
+			source = cfg.IPSource
+		}
+		var names []string
+		for name := range host.Labels {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		labels := ""
+		for _, name := range names {
+			labels += fmt.Sprintf(", label %v=%v", name, host.Labels[name])
+		}
+		fmt.Printf("Host %v: content %v, IP source %v%v\n", host, host.Content, maskURLs(source), labels)
+	}
+
+	return
+}
+
+//maskedValue returns value with secrets hidden. Webhook URLs are secrets in themselves, so only their host is shown,
+//and other URLs have any user info and query string hidden.
+func maskedValue(name string, value string) string {
+
+	switch {
+	case value == "":
+		return `""`
+	case secretFlags[name]:
+		return "********"
+	case name == "notify":
+		var masked []string
+		for _, notifyURL := range strings.Split(value, ",") {
+			if parsed, err := url.Parse(notifyURL); err == nil && parsed.Host != "" {
+				notifyURL = parsed.Scheme + "://" + parsed.Host + "/********"
+			}
+			masked = append(masked, notifyURL)
+		}
+		return strings.Join(masked, ",")
+	}
+
+	return maskURLs(value)
+}
+
+//maskURLs hides the user info and query string of any URLs in value, as they often hold passwords or keys. The rest
+//is left as given, eg with {ip} placeholders unescaped.
+func maskURLs(value string) string {
+	return urlPattern.ReplaceAllStringFunc(value, func(rawURL string) string {
+		scheme, rest, _ := strings.Cut(rawURL, "://")
+		authority, path := rest, ""
+		if i := strings.IndexAny(rest, "/?#"); i >= 0 {
+			authority, path = rest[:i], rest[i:]
+		}
+		if i := strings.LastIndex(authority, "@"); i >= 0 {
+			authority = "********" + authority[i:]
+		}
+		if i := strings.Index(path, "?"); i >= 0 {
+			fragment := ""
+			if j := strings.Index(path[i:], "#"); j >= 0 {
+				fragment = path[i+j:]
+			}
+			path = path[:i] + "?********" + fragment
+		}
+		return scheme + "://" + authority + path
+	})
+}
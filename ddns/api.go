@@ -0,0 +1,112 @@
+package ddns
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+//apiResponseMessage is the part of the envelope common to all API responses
+type apiResponseMessage struct {
+	Success bool `json:"success"`
+	Errors  []struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+//Cloudflare error codes for a request to a zone that doesn't exist
+const (
+	cfErrorNoRoute       = 7000
+	cfErrorInvalidObject = 7003
+)
+
+//cfAPI sends a request to the Cloudflare API and parses the response into msg.
+//body is sent as JSON if not nil. Unsuccessful responses are returned as errors
+//including Cloudflare's error messages.
+func (u *Updater) cfAPI(method string, path string, body interface{}, msg interface{}) (err error) {
+
+	url := u.cfg.APIBase + path
+
+	var reqBody []byte
+	if body != nil {
+		if reqBody, err = json.Marshal(body); err != nil {
+			err = fmt.Errorf("Error preparing request to %v: %v", url, err)
+			return
+		}
+	}
+
+	req, _ := http.NewRequestWithContext(u.runContext(), method, url, bytes.NewBuffer(reqBody))
+	u.setAuth(req)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := u.apiClient().Do(req)
+	if err != nil {
+		err = clockHint(err)
+		return
+	}
+	defer resp.Body.Close()
+	u.captureAPIError(req, resp)
+	u.checkClock(resp)
+
+	//Rate limiting and server errors are worth retrying
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		err = &retryableError{
+			StatusCode: resp.StatusCode,
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+		}
+		return
+	}
+
+	envelope := apiEnvelope{msg: msg}
+	if err = u.decodeResponse(resp.Body, &envelope); err != nil {
+		err = fmt.Errorf("Error parsing response from %v %v (status %d): %v", method, url, resp.StatusCode, err)
+		return
+	}
+	if !envelope.Success || resp.StatusCode >= 400 {
+		var messages []string
+		zoneNotFound := false
+		for _, e := range envelope.Errors {
+			messages = append(messages, fmt.Sprintf("%d: %s", e.Code, e.Message))
+			zoneNotFound = zoneNotFound || e.Code == cfErrorNoRoute || e.Code == cfErrorInvalidObject
+		}
+		err = fmt.Errorf("Request %v %v failed with status %d: %s", method, url, resp.StatusCode, strings.Join(messages, ", "))
+		//Writes are also rejected for the record sent, eg a comment too long, which says nothing about the zone
+		rejectedRead := method == "GET" && len(envelope.Errors) == 0 && (resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusNotFound)
+		if strings.HasPrefix(path, "/zones/") && (zoneNotFound || rejectedRead) {
+			err = fmt.Errorf("%w: %v", errZoneInvalid, err)
+		}
+		return
+	}
+
+	return
+}
+
+//setAuth adds the credentials to an API request: the token if there is one, otherwise the email and Global API Key
+func (u *Updater) setAuth(req *http.Request) {
+	if u.cfg.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+u.cfg.Token)
+		return
+	}
+	req.Header.Set("X-Auth-Key", u.cfg.Key)
+	req.Header.Set("X-Auth-Email", u.cfg.User)
+}
+
+//apiEnvelope parses the common envelope and msg from the same response, so it only has to be read once
+type apiEnvelope struct {
+	apiResponseMessage
+	msg interface{}
+}
+
+//UnmarshalJSON parses the envelope, and msg if the request succeeded
+func (e *apiEnvelope) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &e.apiResponseMessage); err != nil {
+		return err
+	}
+	if e.msg == nil || !e.Success {
+		return nil
+	}
+	return json.Unmarshal(data, e.msg)
+}
@@ -0,0 +1,48 @@
+package ddns
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGetHostDataZoneInvalid(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		status      int
+		errors      string
+		wantInvalid bool
+	}{
+		{"invalid zone id", http.StatusBadRequest, `[{"code":7003,"message":"Could not route to /zones/x"}]`, true},
+		{"no route", http.StatusNotFound, `[{"code":7000,"message":"No route for that URI"}]`, true},
+		{"rejected without errors", http.StatusNotFound, `[]`, true},
+		{"bad record name", http.StatusBadRequest, `[{"code":9005,"message":"Content for A record is invalid"}]`, false},
+		{"bad filter", http.StatusBadRequest, `[{"code":1004,"message":"DNS Validation Error"}]`, false},
+		{"not allowed", http.StatusForbidden, `[{"code":10000,"message":"Authentication error"}]`, false},
+	}
+
+	for _, test := range tests {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(test.status)
+			fmt.Fprintf(w, `{"success":false,"errors":%s,"messages":[],"result":null}`, test.errors)
+		}))
+
+		u, err := New(WithToken("fake"), WithZone("example.com"), WithHosts("home"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		u.cfg.APIBase = srv.URL
+
+		_, err = u.getHostData("zone", u.hosts[0])
+		if err == nil {
+			t.Errorf("%v: getHostData returned no error", test.name)
+		} else if errors.Is(err, errZoneInvalid) != test.wantInvalid {
+			t.Errorf("%v: getHostData returned %v, expected the zone to be invalid: %v", test.name, err, test.wantInvalid)
+		}
+
+		srv.Close()
+	}
+}
@@ -0,0 +1,179 @@
+package ddns
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+//archivedHost is the saved state of a host that is no longer in the host list, kept so it is restored if the
+//host is added back, rather than the host being updated again as if new. Restored is set once the state restore
+//command has put the state back, so it isn't archived again before the host is added back.
+type archivedHost struct {
+	IP       string    `json:"ip"`
+	Archived time.Time `json:"archived"`
+	Restored bool      `json:"restored,omitempty"`
+}
+
+//ArchivedHost is a host's saved state kept after it was removed from the host list
+type ArchivedHost struct {
+	Type     string
+	Name     string
+	IP       string
+	Archived time.Time
+	Restored bool
+}
+
+//String describes the archived host for listing
+func (a ArchivedHost) String() string {
+	text := fmt.Sprintf("%-6s %s %s (removed %v)", a.Type, toUnicode(a.Name), a.IP, a.Archived.Format(time.RFC1123))
+	if a.Restored {
+		text += ", restored until added back"
+	}
+	return text
+}
+
+//archiveRemovedHosts moves the saved state of hosts no longer in the host list to the archive, and restores the
+//archived state of hosts that are back in it. changed is true if the saved data changed.
+func (u *Updater) archiveRemovedHosts(saveData *saveDataDocument, hosts []Host, now time.Time) (changed bool) {
+
+	configured := make(map[string]bool)
+	for _, host := range hosts {
+		configured[host.key()] = true
+	}
+
+	for key, ip := range saveData.Hosts {
+		//State put back by state restore is kept until the host is added back
+		if configured[key] || saveData.ArchivedHosts[key].Restored {
+			continue
+		}
+		if saveData.ArchivedHosts == nil {
+			saveData.ArchivedHosts = make(map[string]archivedHost)
+		}
+		saveData.ArchivedHosts[key] = archivedHost{IP: ip, Archived: now}
+		delete(saveData.Hosts, key)
+		u.log.Printf("Host %v is no longer in the host list - archived its saved state, which is restored if it is added back.", toUnicode(strings.SplitN(key, ":", 2)[1]))
+		changed = true
+	}
+
+	for key, state := range saveData.ArchivedHosts {
+		if !configured[key] {
+			continue
+		}
+		if _, saved := saveData.Hosts[key]; !saved {
+			if saveData.Hosts == nil {
+				saveData.Hosts = make(map[string]string)
+			}
+			saveData.Hosts[key] = state.IP
+			u.log.Printf("Host %v is back in the host list - restored its archived state.", toUnicode(strings.SplitN(key, ":", 2)[1]))
+		}
+		delete(saveData.ArchivedHosts, key)
+		changed = true
+	}
+
+	return
+}
+
+//ArchivedHosts returns the hosts whose saved state was archived when they were removed from the host list
+func (u *Updater) ArchivedHosts() (archived []ArchivedHost, err error) {
+
+	saveData, err := u.getSaveData()
+	if err != nil {
+		return
+	}
+
+	return archivedHosts(saveData, nil), nil
+}
+
+//archivedHosts returns the archived hosts, sorted, or only those with the given names if there are any
+func archivedHosts(saveData saveDataDocument, names []string) (archived []ArchivedHost) {
+
+	for key, state := range saveData.ArchivedHosts {
+		hostType, name, _ := strings.Cut(key, ":")
+		if len(names) > 0 && !containsName(names, name) {
+			continue
+		}
+		archived = append(archived, ArchivedHost{Type: hostType, Name: name, IP: state.IP, Archived: state.Archived, Restored: state.Restored})
+	}
+	sort.Slice(archived, func(i, j int) bool {
+		if archived[i].Name != archived[j].Name {
+			return archived[i].Name < archived[j].Name
+		}
+		return archived[i].Type < archived[j].Type
+	})
+
+	return
+}
+
+//containsName reports whether name is in names, which are normalized names
+func containsName(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+//RestoreHosts puts the archived state of the named hosts, of any record type, back into the saved data straight away,
+//and keeps it there until they are added back to the host list. No names restores them all. Archived state is also
+//restored when a host is added back without this.
+func (u *Updater) RestoreHosts(names []string) (restored []ArchivedHost, err error) {
+	return u.changeArchive(names, true)
+}
+
+//ForgetArchivedHosts deletes the archived state of the named hosts, or of all of them if no names are given
+func (u *Updater) ForgetArchivedHosts(names []string) (forgotten []ArchivedHost, err error) {
+	return u.changeArchive(names, false)
+}
+
+//changeArchive restores the state of the named hosts if restore is set, or otherwise takes them out of the archive,
+//along with any state restored for them
+func (u *Updater) changeArchive(names []string, restore bool) (changed []ArchivedHost, err error) {
+
+	unlock, err := u.store.Lock()
+	if err != nil {
+		return
+	}
+	defer unlock()
+
+	saveData, err := u.getSaveData()
+	if err != nil {
+		return
+	}
+
+	var normalized []string
+	for _, name := range names {
+		normalized = append(normalized, normalizeName(name, u.cfg.Zone))
+	}
+	changed = archivedHosts(saveData, normalized)
+	for _, name := range normalized {
+		if len(archivedHosts(saveData, []string{name})) == 0 {
+			return nil, fmt.Errorf("No archived state for %v", toUnicode(name))
+		}
+	}
+	if len(changed) == 0 {
+		return
+	}
+
+	for _, a := range changed {
+		key := a.Type + ":" + a.Name
+		if !restore {
+			if a.Restored {
+				delete(saveData.Hosts, key)
+			}
+			delete(saveData.ArchivedHosts, key)
+			continue
+		}
+		if saveData.Hosts == nil {
+			saveData.Hosts = make(map[string]string)
+		}
+		saveData.Hosts[key] = a.IP
+		saveData.ArchivedHosts[key] = archivedHost{IP: a.IP, Archived: a.Archived, Restored: true}
+	}
+
+	err = u.setSaveData(saveData)
+
+	return
+}
@@ -0,0 +1,172 @@
+package ddns
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
+)
+
+//redacted replaces secrets in support bundles
+const redacted = "REDACTED"
+
+//urlPattern finds URLs in text, such as log lines, to redact
+var urlPattern = regexp.MustCompile(`[a-zA-Z][a-zA-Z0-9+.-]*://[^\s,"']+`)
+
+//WriteSupportBundle writes a zip archive to w for attaching to bug reports. It holds the version, the settings
+//with credentials removed, the saved data, and the recent log lines and API errors kept in it.
+func (u *Updater) WriteSupportBundle(w io.Writer, version string) (err error) {
+
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("Error in WriteSupportBundle(): %v", err)
+		}
+	}()
+
+	saveData, err := u.getSaveData()
+	if err != nil {
+		return
+	}
+	u.diag.seed(saveData.Diagnostics)
+	diag := u.diag.snapshot()
+	if diag == nil {
+		diag = saveData.Diagnostics
+	}
+	saveData.Diagnostics = nil
+
+	archive := zip.NewWriter(w)
+
+	add := func(name string, content string) {
+		if err != nil {
+			return
+		}
+		var f io.Writer
+		if f, err = archive.Create(name); err == nil {
+			_, err = io.WriteString(f, content)
+		}
+	}
+	addJSON := func(name string, v interface{}) {
+		data, jsonErr := json.MarshalIndent(v, "", "  ")
+		if jsonErr != nil && err == nil {
+			err = jsonErr
+		}
+		add(name, string(data)+"\n")
+	}
+
+	add("version.txt", fmt.Sprintf("go-cloudflare-ddns %v\n%v %v/%v\nCreated %v\n",
+		version, runtime.Version(), runtime.GOOS, runtime.GOARCH, time.Now().Format(time.RFC1123)))
+
+	var hosts []string
+	for _, host := range u.hosts {
+		hosts = append(hosts, host.String())
+	}
+	addJSON("config.json", struct {
+		Config Config   `json:"config"`
+		Hosts  []string `json:"hosts"`
+		Store  string   `json:"store"`
+	}{u.sanitizedConfig(), hosts, fmt.Sprint(u.store)})
+
+	addJSON("state.json", saveData)
+
+	var log []string
+	var apiErrors []apiError
+	if diag != nil {
+		log, apiErrors = diag.Log, diag.APIErrors
+	}
+	add("log.txt", u.redactText(strings.Join(log, "\n"))+"\n")
+	addJSON("api-errors.json", apiErrors)
+
+	if err != nil {
+		return
+	}
+	return archive.Close()
+}
+
+//sanitizedConfig returns the settings with credentials removed, and URLs that may hold them cut down to the host
+func (u *Updater) sanitizedConfig() Config {
+
+	cfg := u.cfg
+
+	for _, secret := range []*string{&cfg.User, &cfg.Key, &cfg.Token, &cfg.RouterUser, &cfg.RouterPassword} {
+		if *secret != "" {
+			*secret = redacted
+		}
+	}
+
+	cfg.IPSource = redactURL(cfg.IPSource)
+	cfg.ConfirmWith = redactURL(cfg.ConfirmWith)
+	cfg.HealthCheckURL = redactURL(cfg.HealthCheckURL)
+	cfg.PeerSources = nil
+	for _, spec := range u.cfg.PeerSources {
+		cfg.PeerSources = append(cfg.PeerSources, redactURL(spec))
+	}
+
+	//Webhook URLs are secrets in themselves
+	cfg.Notify = nil
+	for _, channel := range u.cfg.Notify {
+		channel.URL = redactWebhook(channel.URL)
+		cfg.Notify = append(cfg.Notify, channel)
+	}
+
+	return cfg
+}
+
+//redactText removes the credentials and webhook URLs from text, eg log lines, and any user info and query from other
+//URLs in it, as for the settings
+func (u *Updater) redactText(text string) string {
+
+	for _, secret := range []string{u.cfg.Key, u.cfg.Token, u.cfg.RouterPassword} {
+		if secret != "" {
+			text = strings.ReplaceAll(text, secret, redacted)
+		}
+	}
+	for _, channel := range u.cfg.Notify {
+		text = strings.ReplaceAll(text, channel.URL, redactWebhook(channel.URL))
+	}
+
+	return urlPattern.ReplaceAllStringFunc(text, redactURL)
+}
+
+//redactWebhook cuts a webhook URL down to its host
+func redactWebhook(value string) string {
+	parsed, err := url.Parse(value)
+	if err != nil || parsed.Host == "" {
+		return redacted
+	}
+	return parsed.Scheme + "://" + parsed.Host + "/" + redacted
+}
+
+//redactURL removes any user info and query from a URL, leaving anything else as it is. A source's prefix, as in
+//scrape:<url>, is kept and the URL after it redacted. Values that aren't URLs, eg dns or command:<path>, are unchanged.
+func redactURL(value string) string {
+
+	i := strings.Index(value, "://")
+	if i < 0 {
+		return value
+	}
+	prefix := value[:strings.LastIndex(value[:i], ":")+1]
+	scheme, rest := value[len(prefix):i], value[i+3:]
+
+	//Worked on as text rather than parsed, so placeholders such as {ip} aren't escaped
+	authority, path := rest, ""
+	if j := strings.IndexAny(rest, "/?#"); j >= 0 {
+		authority, path = rest[:j], rest[j:]
+	}
+	if j := strings.LastIndex(authority, "@"); j >= 0 {
+		authority = redacted + authority[j:]
+	}
+	if j := strings.Index(path, "?"); j >= 0 {
+		fragment := ""
+		if k := strings.Index(path[j:], "#"); k >= 0 {
+			fragment = path[j+k:]
+		}
+		path = path[:j] + "?" + redacted + fragment
+	}
+
+	return prefix + scheme + "://" + authority + path
+}
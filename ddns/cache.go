@@ -0,0 +1,94 @@
+package ddns
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+//cache keeps the results of API lookups for a while, so runs in a long running process, and the steps within a run,
+//don't ask Cloudflare for the same thing again. It is safe for concurrent use. A nil cache holds nothing.
+type cache struct {
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+}
+
+//cacheEntry is a cached value and when it stops being used
+type cacheEntry struct {
+	value   interface{}
+	expires time.Time
+}
+
+func newCache() *cache {
+	return &cache{entries: make(map[string]cacheEntry)}
+}
+
+//get returns the value for key if there is one that hasn't expired
+func (c *cache) get(key string) (value interface{}, ok bool) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if ok && !time.Now().Before(entry.expires) {
+		delete(c.entries, key)
+		return nil, false
+	}
+	return entry.value, ok
+}
+
+//set keeps value for key for ttl. Nothing is kept if ttl isn't positive.
+func (c *cache) set(key string, value interface{}, ttl time.Duration) {
+	if c == nil || ttl <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[key] = cacheEntry{value: value, expires: time.Now().Add(ttl)}
+}
+
+//remove drops the value for key, and any with key as a prefix if it ends in ":"
+func (c *cache) remove(key string) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for k := range c.entries {
+		if k == key || (strings.HasSuffix(key, ":") && strings.HasPrefix(k, key)) {
+			delete(c.entries, k)
+		}
+	}
+}
+
+//zoneCacheKey identifies the zone id of the configured zone in the cache
+func (u *Updater) zoneCacheKey() string {
+	return "zone:" + u.cfg.Zone + ":" + u.cfg.Account
+}
+
+//recordCacheKey identifies the record for host in the zone in the cache
+func recordCacheKey(zoneID string, host Host) string {
+	return "record:" + zoneID + ":" + host.key()
+}
+
+//cachedRecord returns the record for host from the cache, if it was fetched or updated within -record-cache-ttl
+func (u *Updater) cachedRecord(zoneID string, host Host) (data hostData, ok bool) {
+	value, ok := u.cache.get(recordCacheKey(zoneID, host))
+	if ok {
+		data = value.(hostData)
+		data.Tags = append([]string(nil), data.Tags...)
+	}
+	return
+}
+
+//cacheRecord keeps what the record for host holds, to save fetching it again
+func (u *Updater) cacheRecord(zoneID string, host Host, data hostData) {
+	u.cache.set(recordCacheKey(zoneID, host), data, u.cfg.RecordCacheTTL)
+}
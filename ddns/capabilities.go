@@ -0,0 +1,218 @@
+package ddns
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+//capabilities are what the credentials were found to be allowed to do in the zone, kept in the saved data
+type capabilities struct {
+	//ReadZone is reading the zone's details, needed to look the zone id up again and to check its plan's minimum TTL
+	ReadZone bool `json:"readZone"`
+	//EditRecords is creating and changing DNS records. Without it the records are only checked.
+	EditRecords bool `json:"editRecords"`
+
+	//Credentials identifies the credentials probed, so new ones are probed again, and Checked is when
+	Credentials string    `json:"credentials"`
+	Checked     time.Time `json:"checked"`
+}
+
+//String lists what the credentials can do
+func (c capabilities) String() string {
+	can, cannot := []string{"read DNS records"}, []string(nil)
+	for _, capability := range []struct {
+		ok   bool
+		name string
+	}{{c.ReadZone, "read the zone"}, {c.EditRecords, "edit DNS records"}} {
+		if capability.ok {
+			can = append(can, capability.name)
+		} else {
+			cannot = append(cannot, capability.name)
+		}
+	}
+	if len(cannot) == 0 {
+		return "can " + joinList(can, "and")
+	}
+	return fmt.Sprintf("can %v, but not %v", joinList(can, "and"), joinList(cannot, "or"))
+}
+
+//joinList joins items for a sentence, eg "a, b and c"
+func joinList(items []string, conjunction string) string {
+	if len(items) < 2 {
+		return strings.Join(items, "")
+	}
+	return strings.Join(items[:len(items)-1], ", ") + " " + conjunction + " " + items[len(items)-1]
+}
+
+//credentialsID returns a hash identifying the credentials, without keeping them in the saved data
+func (u *Updater) credentialsID() string {
+	sum := sha256.Sum256([]byte(u.cfg.Token + "\x00" + u.cfg.User + "\x00" + u.cfg.Key))
+	return hex.EncodeToString(sum[:8])
+}
+
+//checkCapabilities finds what the credentials are allowed to do in the zone, so features they can't use are turned
+//off before the run relies on them rather than failing part way through. Credentials that can't read the records
+//can't be used at all, so are an error. What was found is kept in the saved data for -zone-cache-ttl, or until the
+//credentials change. changed is true if the saved data needs saving.
+func (u *Updater) checkCapabilities(saveData *saveDataDocument) (changed bool, err error) {
+
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("Error in checkCapabilities(): %v", err)
+		}
+	}()
+
+	id := u.credentialsID()
+	if caps := saveData.Capabilities; caps != nil && caps.Credentials == id && time.Since(caps.Checked) < u.cfg.ZoneCacheTTL {
+		return
+	}
+
+	if err = u.resolveZoneID(saveData); err != nil {
+		return
+	}
+	caps := capabilities{Credentials: id, Checked: time.Now()}
+
+	status, err := u.probe("GET", "/zones/"+saveData.ZoneID, nil)
+	if err != nil {
+		return
+	}
+	caps.ReadZone = status < 300
+
+	if status, err = u.probe("GET", fmt.Sprintf("/zones/%s/dns_records?per_page=5", saveData.ZoneID), nil); err != nil {
+		return
+	}
+	if status >= 300 {
+		return false, fmt.Errorf("The credentials can't read the DNS records in zone %v (status %d). Give the API token DNS Edit permission for the zone", toUnicode(u.cfg.Zone), status)
+	}
+
+	if caps.EditRecords, err = u.canEditRecords(saveData.ZoneID); err != nil {
+		return
+	}
+
+	if old := saveData.Capabilities; old == nil || old.ReadZone != caps.ReadZone || old.EditRecords != caps.EditRecords {
+		u.log.Printf("The credentials %v.", caps)
+		if !caps.EditRecords {
+			u.log.Print("The records will only be checked against the IP, as with -verify-only, until the credentials can edit them.")
+		}
+		if !caps.ReadZone {
+			u.log.Print("The saved zone id will be kept rather than looked up again, and the plan's minimum TTL isn't checked.")
+		}
+	}
+	saveData.Capabilities = &caps
+
+	return true, nil
+}
+
+//DNS Write is the permission group allowing an API token to edit DNS records
+const dnsWritePermission = "4755a26eedb94da69e1066d98aa820be"
+
+//tokenMessage is the part of an API token's details saying what it is allowed to do
+type tokenMessage struct {
+	Result struct {
+		ID       string `json:"id"`
+		Status   string `json:"status"`
+		Policies []struct {
+			Effect           string                 `json:"effect"`
+			Resources        map[string]interface{} `json:"resources"`
+			PermissionGroups []struct {
+				ID   string `json:"id"`
+				Name string `json:"name"`
+			} `json:"permission_groups"`
+		} `json:"policies"`
+	} `json:"result"`
+}
+
+//canEditRecords finds whether the credentials can edit DNS records in the zone from the API token's policies, without
+//sending any writes. The Global API Key can edit anything. A token that isn't allowed to read its own details is taken
+//to be able to edit, and writes it can't make fail as they would without the check.
+func (u *Updater) canEditRecords(zoneID string) (can bool, err error) {
+
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("Error in canEditRecords(): %v", err)
+		}
+	}()
+
+	if u.cfg.Token == "" {
+		return true, nil
+	}
+
+	var verify tokenMessage
+	if err = u.cfAPI("GET", "/user/tokens/verify", nil, &verify); err != nil {
+		return
+	}
+	if verify.Result.Status != "active" {
+		return false, fmt.Errorf("The API token is %v rather than active", verify.Result.Status)
+	}
+
+	var token tokenMessage
+	if err = u.cfAPI("GET", "/user/tokens/"+verify.Result.ID, nil, &token); err != nil {
+		var retryErr *retryableError
+		if errors.As(err, &retryErr) {
+			return
+		}
+		u.logVerbose("The API token's permissions can't be read, so it is taken to be able to edit DNS records: %v", err)
+		return true, nil
+	}
+
+	allowed, denied := false, false
+	for _, policy := range token.Result.Policies {
+		if !coversZone(policy.Resources, zoneID) {
+			continue
+		}
+		for _, group := range policy.PermissionGroups {
+			if group.ID == dnsWritePermission || group.Name == "DNS Write" {
+				allowed = allowed || policy.Effect == "allow"
+				denied = denied || policy.Effect == "deny"
+			}
+		}
+	}
+
+	return allowed && !denied, nil
+}
+
+//coversZone reports whether a token policy's resources include the zone, by its id, all zones, or an account's zones.
+//Accounts are taken to hold the zone, as the zone's account isn't always known.
+func coversZone(resources map[string]interface{}, zoneID string) bool {
+	for resource := range resources {
+		if resource == "com.cloudflare.api.account.zone."+zoneID || resource == "com.cloudflare.api.account.zone.*" ||
+			(strings.HasPrefix(resource, "com.cloudflare.api.account.") && !strings.HasPrefix(resource, "com.cloudflare.api.account.zone.")) {
+			return true
+		}
+	}
+	return false
+}
+
+//probe sends a request to see whether the credentials are allowed to make it, returning the status. Only the status
+//is looked at, and errors are only returned if Cloudflare couldn't be reached or had a problem of its own.
+func (u *Updater) probe(method string, path string, body []byte) (status int, err error) {
+
+	req, _ := http.NewRequestWithContext(u.runContext(), method, u.cfg.APIBase+path, bytes.NewBuffer(body))
+	u.setAuth(req)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := u.apiClient().Do(req)
+	if err != nil {
+		err = clockHint(err)
+		return
+	}
+	defer resp.Body.Close()
+	u.checkClock(resp)
+
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		return resp.StatusCode, fmt.Errorf("Request %v %v failed with status %d", method, u.cfg.APIBase+path, resp.StatusCode)
+	}
+
+	return resp.StatusCode, nil
+}
+
+//canReadZone reports whether the credentials were found to be able to read the zone, or haven't been checked
+func (d saveDataDocument) canReadZone() bool {
+	return d.Capabilities == nil || d.Capabilities.ReadZone
+}
@@ -0,0 +1,46 @@
+package ddns
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jonegerton/go-cloudflare-ddns/ipsource"
+)
+
+//checkCGNAT compares the public IP with the router's own WAN address.
+//It returns true when they differ, meaning the router is behind another layer of NAT
+//and publishing the public IP would not reach this network.
+func (u *Updater) checkCGNAT(ctx context.Context, ip string) (behindCGNAT bool, err error) {
+
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("Error in checkCGNAT(): %v", err)
+		}
+	}()
+
+	routerAddr, err := ipsource.NewUPnP().Detect(ctx)
+	if err != nil {
+		return
+	}
+	routerIP := routerAddr.String()
+	u.logVerbose("Router WAN IP is: %s", routerIP)
+
+	if routerIP == ip {
+		return
+	}
+
+	behindCGNAT = true
+
+	reason := "is not the same as"
+	if !ipsource.IsPublic(routerAddr) {
+		reason = "is a carrier-grade NAT or private address, not"
+	}
+
+	u.log.Printf("The router's WAN address %v %v the public IP %v.", routerIP, reason, ip)
+	u.log.Print("This connection looks to be behind carrier-grade NAT (CGNAT): the public IP is shared with other customers " +
+		"and incoming connections to it will not reach this network, so the DNS update has been skipped.")
+	u.log.Print("To fix this ask your ISP for a public IPv4 address (sometimes called opting out of CGNAT), " +
+		"or publish services another way such as a Cloudflare Tunnel.")
+
+	return
+}
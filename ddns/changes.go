@@ -0,0 +1,131 @@
+package ddns
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+//changeNote starts the note written to a record's comment with the id of the change that last wrote it
+const changeNote = "ddns-change: "
+
+//changeNoteRX matches a change note, with the separator before it
+var changeNoteRX = regexp.MustCompile(`(?:;\s*)?` + regexp.QuoteMeta(changeNote) + `[^;]*`)
+
+//Actions recorded in the change history
+const (
+	changeCreate = "create"
+	changeUpdate = "update"
+	changeDelete = "delete"
+)
+
+//changeEntry is a change made to a record, kept in the saved data so it can be matched with Cloudflare's audit log
+type changeEntry struct {
+	ID       string    `json:"id"`
+	Time     time.Time `json:"time"`
+	Run      string    `json:"run"`
+	Action   string    `json:"action"`
+	Type     string    `json:"type"`
+	Name     string    `json:"name"`
+	RecordID string    `json:"recordID,omitempty"`
+	Old      string    `json:"old,omitempty"`
+	New      string    `json:"new,omitempty"`
+	//Error is why the change failed. A change that timed out may still have been made.
+	Error string `json:"error,omitempty"`
+}
+
+//Change is a change this utility made, or tried to make, to a record
+type Change struct {
+	ID       string
+	Time     time.Time
+	Run      string
+	Action   string
+	Type     string
+	Name     string
+	RecordID string
+	Old      string
+	New      string
+	Error    string
+}
+
+//String describes the change for listing
+func (c Change) String() string {
+	var what string
+	switch c.Action {
+	case changeCreate:
+		what = fmt.Sprintf("created holding %v", c.New)
+	case changeDelete:
+		what = fmt.Sprintf("deleted, held %v", c.Old)
+	default:
+		what = fmt.Sprintf("%v -> %v", c.Old, c.New)
+	}
+	s := fmt.Sprintf("%v  change %v  ", c.Time.Format(time.RFC3339), c.ID)
+	if c.Run != "" {
+		s += fmt.Sprintf("run %v  ", c.Run)
+	}
+	s += fmt.Sprintf("%-6s %v %v", c.Type, toUnicode(c.Name), what)
+	if c.RecordID != "" {
+		s += fmt.Sprintf(" (record %v)", c.RecordID)
+	}
+	if c.Error != "" {
+		s += " FAILED: " + c.Error
+	}
+	return s
+}
+
+//newChangeID returns an id for a change to a record
+func newChangeID() string {
+	return newID() + newID()
+}
+
+//changeComment returns the record comment noting the change writing it, in place of any earlier change's note
+func changeComment(comment string, changeID string) string {
+	comment = strings.TrimPrefix(strings.TrimSpace(changeNoteRX.ReplaceAllString(comment, "")), "; ")
+	if changeID == "" {
+		return comment
+	}
+	if comment == "" {
+		return changeNote + changeID
+	}
+	return comment + "; " + changeNote + changeID
+}
+
+//recordChange adds a change to the history in the saved data, dropping changes from before the statistics period
+func (u *Updater) recordChange(saveData *saveDataDocument, entry changeEntry, changeErr error) {
+
+	entry.Time, entry.Run = time.Now(), u.runID
+	if changeErr != nil {
+		entry.Error = changeErr.Error()
+	}
+	saveData.Changes = append(saveData.Changes, entry)
+
+	limit := statsMaxEvents
+	if u.cfg.LowMemory {
+		limit = statsMaxEventsLowMemory
+	}
+	from := entry.Time.Add(-statsPeriod)
+	for len(saveData.Changes) > 0 && (saveData.Changes[0].Time.Before(from) || len(saveData.Changes) > limit) {
+		saveData.Changes = saveData.Changes[1:]
+	}
+}
+
+//Changes returns the changes made to records over the statistics period, oldest first. If match is given only changes
+//with that id, or to records of that name, are returned.
+func (u *Updater) Changes(match string) (changes []Change, err error) {
+
+	saveData, err := u.getSaveData()
+	if err != nil {
+		return
+	}
+
+	match = toASCII(strings.ToLower(strings.TrimSuffix(match, ".")))
+	for _, entry := range saveData.Changes {
+		if match != "" && entry.ID != match && entry.Name != match && entry.Name != match+"."+u.cfg.Zone {
+			continue
+		}
+		changes = append(changes, Change(entry))
+	}
+
+	return
+}
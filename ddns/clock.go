@@ -0,0 +1,51 @@
+package ddns
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+//clockSkewLimit is how far the local clock can be from Cloudflare's before warning
+const clockSkewLimit = time.Minute * 5
+
+//checkClock compares the Date of a Cloudflare response with the local clock, warning once when they are far apart and
+//again when they agree. Devices with a flat real-time clock battery can start years out, which breaks TLS and API token
+//checks with errors that don't mention the clock.
+func (u *Updater) checkClock(resp *http.Response) {
+
+	date, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		return
+	}
+
+	skew := time.Since(date)
+	skewed := skew > clockSkewLimit || skew < -clockSkewLimit
+
+	switch {
+	case skewed && !u.clockSkewed:
+		direction := "ahead of"
+		if skew < 0 {
+			direction, skew = "behind", -skew
+		}
+		u.log.Printf("The local clock is %v %v Cloudflare's (local time %v, Cloudflare %v). Set the clock, eg with NTP, "+
+			"as a wrong clock breaks TLS and API token checks.", skew.Round(time.Second), direction, time.Now().UTC().Format(time.RFC1123), date.Format(time.RFC1123))
+	case !skewed && u.clockSkewed:
+		u.log.Print("The local clock agrees with Cloudflare's again.")
+	}
+	u.clockSkewed = skewed
+}
+
+//clockHint adds a hint to check the clock to TLS errors about certificate dates, which usually mean the local clock is wrong
+//rather than the certificate
+func clockHint(err error) error {
+
+	var invalid x509.CertificateInvalidError
+	if errors.As(err, &invalid) && invalid.Reason == x509.Expired {
+		return fmt.Errorf("%w (the certificate isn't valid at the local time %v - check the clock is set, eg with NTP)", err, time.Now().UTC().Format(time.RFC1123))
+	}
+
+	return err
+}
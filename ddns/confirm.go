@@ -0,0 +1,34 @@
+package ddns
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+//confirmWANIP checks the ip against the secondary source given by -confirm-with.
+//An error is returned if the source fails or reports a different address.
+func (u *Updater) confirmWANIP(ctx context.Context, ip string) (err error) {
+
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("Error in confirmWANIP(): %v", err)
+		}
+	}()
+
+	source, err := u.newSource(u.cfg.ConfirmWith)
+	if err != nil {
+		return
+	}
+
+	addr, err := source.Detect(ctx)
+	if err != nil {
+		return
+	}
+
+	if strings.Compare(ip, addr.String()) != 0 {
+		err = fmt.Errorf("WAN IP %v does not match %v reported by %v - not updating", ip, addr, source.Name())
+	}
+
+	return
+}
@@ -0,0 +1,43 @@
+package ddns
+
+import (
+	"time"
+
+	"github.com/jonegerton/go-cloudflare-ddns/schedule"
+)
+
+//coolingDown reports whether Cloudflare is being left alone after failed writes, logging until when.
+//The cooldown is kept in the saved data so runs from cron respect it as well as -interval.
+func (u *Updater) coolingDown(saveData saveDataDocument) bool {
+
+	if u.cfg.Cooldown <= 0 || saveData.CooldownUntil.IsZero() || time.Now().After(saveData.CooldownUntil) {
+		return false
+	}
+
+	u.log.Printf("Cloudflare updates keep failing - cooling down until %v (failed runs in a row: %d).", saveData.CooldownUntil.Format(time.RFC1123), saveData.WriteFailures)
+	return true
+}
+
+//startCooldown records a run where writing to Cloudflare failed, and sets when to try again.
+//The cooldown is -cooldown after the first failure and doubles with each one after, up to -cooldown-max.
+func (u *Updater) startCooldown(saveData *saveDataDocument) {
+
+	if u.cfg.Cooldown <= 0 {
+		return
+	}
+
+	saveData.WriteFailures++
+
+	cooldown := schedule.Backoff{Initial: u.cfg.Cooldown, Max: u.cfg.CooldownMax}.Delay(saveData.WriteFailures)
+	saveData.CooldownUntil = time.Now().Add(cooldown)
+	u.log.Printf("Cloudflare updates failed - not trying again for %v (failed runs in a row: %d).", cooldown, saveData.WriteFailures)
+}
+
+//endCooldown clears the failure count after a successful write
+func (u *Updater) endCooldown(saveData *saveDataDocument) {
+	if saveData.WriteFailures > 0 {
+		u.log.Printf("Cloudflare updates are working again (failed runs in a row: %d).", saveData.WriteFailures)
+	}
+	saveData.WriteFailures = 0
+	saveData.CooldownUntil = time.Time{}
+}
@@ -0,0 +1,63 @@
+package ddns
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jonegerton/go-cloudflare-ddns/schedule"
+)
+
+//Run runs the update at every Config.Interval until ctx is cancelled, with the Config.Jitter and Config.RetryInterval
+//of the schedule package. Errors are logged rather than ending the loop, so the next run can try again.
+func (u *Updater) Run(ctx context.Context) error {
+
+	if u.cfg.Interval <= 0 {
+		return errors.New("Run needs an interval - use RunOnce to run once")
+	}
+	if err := u.checkRequired(); err != nil {
+		return err
+	}
+
+	u.log.Printf("Running every %v.", u.cfg.Interval)
+
+	u.schedule.Interval = u.cfg.Interval
+	u.schedule.InitialDelay = u.cfg.InitialDelay
+	u.schedule.RunOnStart = u.cfg.RunOnStart
+	u.schedule.Jitter = u.cfg.Jitter
+	u.schedule.Retry = schedule.Backoff{Initial: u.cfg.RetryInterval, Max: u.cfg.Interval}
+	u.schedule.Waiting = func(wait time.Duration, failures int) {
+		if failures > 0 && u.cfg.RetryInterval > 0 {
+			u.log.Printf("Run failed (%d in a row) - trying again in %v.", failures, wait.Round(time.Second))
+			return
+		}
+		u.logVerbose("Next check in %v", wait.Round(time.Second))
+	}
+
+	return u.schedule.Run(ctx, u.runLogged)
+}
+
+//Trigger makes Run check straight away rather than waiting for the interval, eg when the network has changed.
+//A check already under way is followed by another. Triggers before Run starts make its first check straight away.
+func (u *Updater) Trigger() {
+	u.schedule.Trigger()
+}
+
+//runLogged runs the update once within -max-runtime, logging any error
+func (u *Updater) runLogged(ctx context.Context) (err error) {
+
+	if u.cfg.MaxRuntime > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, u.cfg.MaxRuntime)
+		defer cancel()
+	}
+
+	if err = u.RunOnce(ctx); err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			u.log.Printf("Run did not complete within -max-runtime of %v - giving up until the next check.", u.cfg.MaxRuntime)
+		}
+		u.log.Print(err)
+	}
+
+	return
+}
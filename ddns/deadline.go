@@ -0,0 +1,12 @@
+package ddns
+
+import "context"
+
+//runContext is the context of the run under way, so API requests and retries stop when it is cancelled, eg when Run
+//gives up on a run taking longer than Config.MaxRuntime. Outside a run nothing cancels them.
+func (u *Updater) runContext() context.Context {
+	if u.ctx == nil {
+		return context.Background()
+	}
+	return u.ctx
+}
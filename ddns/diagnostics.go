@@ -0,0 +1,133 @@
+package ddns
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+//How much is kept for support bundles
+const (
+	diagnosticLogLines  = 50
+	diagnosticAPIErrors = 5
+	maxAPIErrorBody     = 4096
+)
+
+//diagnosticsData is what is kept in the saved data to help with bug reports: the last lines logged
+//and the bodies of the last unsuccessful API responses
+type diagnosticsData struct {
+	Log       []string   `json:"log,omitempty"`
+	APIErrors []apiError `json:"apiErrors,omitempty"`
+}
+
+//apiError is an unsuccessful response from the Cloudflare API
+type apiError struct {
+	Time   time.Time `json:"time"`
+	Method string    `json:"method"`
+	URL    string    `json:"url"`
+	Status int       `json:"status"`
+	Body   string    `json:"body"`
+}
+
+//diagnostics collects diagnosticsData as the updater runs. It is attached to the logger as a second output.
+//It is left out in -low-memory mode, and its methods do nothing on a nil diagnostics.
+type diagnostics struct {
+	mu     sync.Mutex
+	seeded bool
+	data   diagnosticsData
+}
+
+//Write keeps the lines written to the log, dropping the oldest
+func (d *diagnostics) Write(p []byte) (n int, err error) {
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		d.data.Log = append(d.data.Log, line)
+	}
+	if extra := len(d.data.Log) - diagnosticLogLines; extra > 0 {
+		d.data.Log = append([]string(nil), d.data.Log[extra:]...)
+	}
+
+	return len(p), nil
+}
+
+//addAPIError keeps an unsuccessful API response, dropping the oldest
+func (d *diagnostics) addAPIError(e apiError) {
+
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.data.APIErrors = append(d.data.APIErrors, e)
+	if extra := len(d.data.APIErrors) - diagnosticAPIErrors; extra > 0 {
+		d.data.APIErrors = append([]apiError(nil), d.data.APIErrors[extra:]...)
+	}
+}
+
+//seed starts from what earlier runs saved, so one-shot runs from cron build up a history.
+//Only the first saved data read is used, as after that the saved data comes from this process.
+func (d *diagnostics) seed(saved *diagnosticsData) {
+
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.seeded {
+		return
+	}
+	d.seeded = true
+	if saved != nil {
+		d.data.Log = append(append([]string(nil), saved.Log...), d.data.Log...)
+		d.data.APIErrors = append(append([]apiError(nil), saved.APIErrors...), d.data.APIErrors...)
+	}
+}
+
+//snapshot returns a copy of what has been collected, or nil if nothing has
+func (d *diagnostics) snapshot() *diagnosticsData {
+
+	if d == nil {
+		return nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if len(d.data.Log) == 0 && len(d.data.APIErrors) == 0 {
+		return nil
+	}
+	return &diagnosticsData{
+		Log:       append([]string(nil), d.data.Log...),
+		APIErrors: append([]apiError(nil), d.data.APIErrors...),
+	}
+}
+
+//captureAPIError keeps the body of an unsuccessful API response, leaving it to be read as normal afterwards
+func (u *Updater) captureAPIError(req *http.Request, resp *http.Response) {
+
+	if u.diag == nil || resp.StatusCode < 400 {
+		return
+	}
+
+	head, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxAPIErrorBody))
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(head), resp.Body), resp.Body}
+
+	u.diag.addAPIError(apiError{
+		Time:   time.Now(),
+		Method: req.Method,
+		URL:    req.URL.String(),
+		Status: resp.StatusCode,
+		Body:   string(head),
+	})
+}
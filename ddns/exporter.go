@@ -0,0 +1,104 @@
+package ddns
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+//lastCheck is the outcome of the last -verify-only check, kept in memory for the metrics
+type lastCheck struct {
+	mu sync.Mutex
+
+	Time time.Time
+	Err  error
+
+	//IPs are the detected IPs by source, and Records what each record held
+	IPs     map[string]string
+	Records []recordCheck
+}
+
+//recordCheck is what a record held when checked against the IP
+type recordCheck struct {
+	Host      Host
+	Published string
+	Drift     error
+}
+
+//setLastCheck keeps the outcome of a -verify-only check. runErr is any error that stopped the check, not drift.
+func (u *Updater) setLastCheck(ips map[string]string, records []recordCheck, runErr error) {
+	u.checked.mu.Lock()
+	defer u.checked.mu.Unlock()
+
+	u.checked.Time, u.checked.Err = time.Now(), runErr
+	u.checked.IPs, u.checked.Records = ips, records
+}
+
+//promLabel escapes a Prometheus label value
+var promLabel = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+//hostMetricLabels returns the host's labels to add to its metrics, each starting with a comma
+func hostMetricLabels(host Host) (labels string) {
+	for _, pair := range host.labelPairs() {
+		name, val, _ := strings.Cut(pair, "=")
+		labels += fmt.Sprintf(",%s=\"%s\"", name, promLabel.Replace(val))
+	}
+	return
+}
+
+//writeCheckMetrics adds the outcome of the last -verify-only check to the metrics: the detected IPs, what each record
+//holds and whether it has drifted. Nothing is written until there has been a check.
+func (u *Updater) writeCheckMetrics(w io.Writer) {
+
+	u.checked.mu.Lock()
+	defer u.checked.mu.Unlock()
+
+	if u.checked.Time.IsZero() {
+		return
+	}
+
+	success := 1
+	if u.checked.Err != nil {
+		success = 0
+	}
+	fmt.Fprintf(w, "# HELP ddns_check_timestamp_seconds When the records were last checked against the IP.\n# TYPE ddns_check_timestamp_seconds gauge\nddns_check_timestamp_seconds %d\n", u.checked.Time.Unix())
+	fmt.Fprintf(w, "# HELP ddns_check_success 1 if the last check ran, whether or not records had drifted.\n# TYPE ddns_check_success gauge\nddns_check_success %d\n", success)
+
+	if len(u.checked.IPs) > 0 {
+		sources := make([]string, 0, len(u.checked.IPs))
+		for source := range u.checked.IPs {
+			sources = append(sources, source)
+		}
+		sort.Strings(sources)
+
+		fmt.Fprint(w, "# HELP ddns_wan_ip_info The WAN IP detected from each IP source.\n# TYPE ddns_wan_ip_info gauge\n")
+		for _, source := range sources {
+			fmt.Fprintf(w, "ddns_wan_ip_info{source=\"%s\",ip=\"%s\"} 1\n", promLabel.Replace(source), promLabel.Replace(u.checked.IPs[source]))
+		}
+	}
+
+	if len(u.checked.Records) == 0 {
+		return
+	}
+
+	drifted := 0
+	fmt.Fprint(w, "# HELP ddns_record_info What each record held when last checked. Missing records aren't listed.\n# TYPE ddns_record_info gauge\n")
+	for _, record := range u.checked.Records {
+		if record.Drift == errDriftNotFound {
+			continue
+		}
+		fmt.Fprintf(w, "ddns_record_info{name=\"%s\",type=\"%s\",content=\"%s\"%s} 1\n", promLabel.Replace(record.Host.Name), record.Host.Type, promLabel.Replace(record.Published), hostMetricLabels(record.Host))
+	}
+	fmt.Fprint(w, "# HELP ddns_record_drift 1 if the record doesn't hold the detected IP, or is missing.\n# TYPE ddns_record_drift gauge\n")
+	for _, record := range u.checked.Records {
+		drift := 0
+		if record.Drift != nil {
+			drift, drifted = 1, drifted+1
+		}
+		fmt.Fprintf(w, "ddns_record_drift{name=\"%s\",type=\"%s\"%s} %d\n", promLabel.Replace(record.Host.Name), record.Host.Type, hostMetricLabels(record.Host), drift)
+	}
+	fmt.Fprintf(w, "# HELP ddns_records_drifted Records that don't hold the detected IP.\n# TYPE ddns_records_drifted gauge\nddns_records_drifted %d\n", drifted)
+}
@@ -0,0 +1,57 @@
+package ddns
+
+import (
+	"errors"
+	"time"
+
+	"github.com/jonegerton/go-cloudflare-ddns/ipsource"
+)
+
+//applyFailover tracks how long IP detection has been failing, given the result of getWANIPs.
+//Once it has failed for longer than -failover-after every host is given -failover-ip,
+//eg a cloud relay. When detection works again the dynamic IP is published as normal.
+//Only sources failing to answer count: an IP that was detected but rejected, by -ip-filter or for not being public,
+//fails the run without starting or clearing the failover timer, as the connection is up.
+func (u *Updater) applyFailover(saveData *saveDataDocument, hosts []Host, ips map[string]string, detectErr error) (result map[string]string, failingOver bool, err error) {
+
+	//Detection working again
+	if detectErr == nil {
+		if !saveData.FailingSince.IsZero() {
+			u.log.Printf("IP detection is working again after failing since %v.", saveData.FailingSince.Format(time.RFC1123))
+			saveData.FailingSince = time.Time{}
+			err = u.setSaveData(*saveData)
+		}
+		result = ips
+		return
+	}
+
+	if errors.Is(detectErr, errIPRejected) || errors.Is(detectErr, ipsource.ErrNotPublic) {
+		err = detectErr
+		return
+	}
+
+	if saveData.FailingSince.IsZero() {
+		saveData.FailingSince = time.Now()
+		if err = u.setSaveData(*saveData); err != nil {
+			return
+		}
+	}
+
+	failingFor := time.Since(saveData.FailingSince)
+	if failingFor < u.cfg.FailoverAfter {
+		u.log.Printf("IP detection has been failing for %v - will publish failover IP %v after %v.", failingFor.Round(time.Second), u.cfg.FailoverIP, u.cfg.FailoverAfter)
+		err = detectErr
+		return
+	}
+
+	u.log.Printf("IP detection has been failing for %v - publishing failover IP %v: %v", failingFor.Round(time.Second), u.cfg.FailoverIP, detectErr)
+
+	result = make(map[string]string)
+	result[u.cfg.IPSource] = u.cfg.FailoverIP
+	for _, host := range hosts {
+		result[u.sourceOf(host)] = u.cfg.FailoverIP
+	}
+	failingOver = true
+
+	return
+}
@@ -0,0 +1,67 @@
+package ddns
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jonegerton/go-cloudflare-ddns/fakecf"
+	"github.com/jonegerton/go-cloudflare-ddns/ipsource"
+)
+
+func TestFailoverCountsSourceFailures(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		detectErr   error
+		wantCounted bool
+	}{
+		{"source unreachable", errors.New("Get \"http://192.0.2.1/\": dial tcp: connection refused"), true},
+		{"no ip in response", errors.New("Response from http://192.0.2.1/ is not an IP address"), true},
+		{"rejected by filter", fmt.Errorf("Error in run: %w", fmt.Errorf("%w: IP 10.0.0.1 from default is not a public address (IP filter deny-private)", errIPRejected)), false},
+		{"private interface address", fmt.Errorf("Error in getWANIP(): %w", fmt.Errorf("%w: interface eth0 only has the private address 10.0.0.1", ipsource.ErrNotPublic)), false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			fake := fakecf.New("203.0.113.10")
+			fake.AddZone("example.com")
+			cfg := DefaultConfig()
+			cfg.FailoverIP = "198.51.100.1"
+			cfg.FailoverAfter = time.Hour
+			u := testUpdater(t, fake, cfg, WithHosts("home"))
+
+			var saveData saveDataDocument
+			_, failingOver, err := u.applyFailover(&saveData, u.hosts, nil, test.detectErr)
+			if !errors.Is(err, test.detectErr) {
+				t.Errorf("applyFailover returned %v, want the detection error", err)
+			}
+			if failingOver {
+				t.Error("Failed over before -failover-after")
+			}
+			if counted := !saveData.FailingSince.IsZero(); counted != test.wantCounted {
+				t.Errorf("Counted towards -failover-after: %v, want %v", counted, test.wantCounted)
+			}
+		})
+	}
+}
+
+func TestFailoverRejectionKeepsTimer(t *testing.T) {
+
+	fake := fakecf.New("203.0.113.10")
+	fake.AddZone("example.com")
+	cfg := DefaultConfig()
+	cfg.FailoverIP = "198.51.100.1"
+	cfg.FailoverAfter = time.Minute
+	u := testUpdater(t, fake, cfg, WithHosts("home"))
+
+	//A rejection while already failing neither clears the timer nor fails over
+	since := time.Now().Add(-time.Hour)
+	saveData := saveDataDocument{FailingSince: since}
+	_, failingOver, _ := u.applyFailover(&saveData, u.hosts, nil, fmt.Errorf("%w: IP 10.0.0.1 is in a denied range", errIPRejected))
+	if failingOver || !saveData.FailingSince.Equal(since) {
+		t.Errorf("Rejected IP changed failover: failing over %v, failing since %v", failingOver, saveData.FailingSince)
+	}
+}
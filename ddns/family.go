@@ -0,0 +1,76 @@
+package ddns
+
+import (
+	"fmt"
+	"net/netip"
+
+	"github.com/jonegerton/go-cloudflare-ddns/ipsource"
+)
+
+//Address families for -prefer-family
+const (
+	familyIPv4 = "ipv4"
+	familyIPv6 = "ipv6"
+	familyAny  = "any"
+)
+
+//validFamily checks the -prefer-family value
+func validFamily(family string) error {
+	switch family {
+	case familyIPv4, familyIPv6, familyAny:
+		return nil
+	}
+	return fmt.Errorf("Prefer family '%v' is not valid (expected %v, %v or %v)", family, familyIPv4, familyIPv6, familyAny)
+}
+
+//applyFamily makes echo services answer with the preferred family. They report the address the request came from,
+//so on a dual-stack network the answer depends on how the connection was made.
+func (u *Updater) applyFamily(source ipsource.Source) {
+	if s, ok := source.(*ipsource.HTTP); ok {
+		switch u.cfg.PreferFamily {
+		case familyIPv4:
+			s.ForceNetwork("tcp4")
+		case familyIPv6:
+			s.ForceNetwork("tcp6")
+		}
+	}
+}
+
+//checkFamily checks an address detected by source is of the preferred family
+func (u *Updater) checkFamily(source ipsource.Source, addr netip.Addr) error {
+	switch {
+	case u.cfg.PreferFamily == familyIPv4 && !addr.Is4():
+		return fmt.Errorf("Response from %v is not an IPv4 address: %v (use -prefer-family to publish IPv6 addresses)", source.Name(), addr)
+	case u.cfg.PreferFamily == familyIPv6 && !addr.Is6():
+		return fmt.Errorf("Response from %v is not an IPv6 address: %v", source.Name(), addr)
+	}
+	return nil
+}
+
+//routeByFamily returns hosts with entries left as the default A record switched to AAAA when the IP detected for them
+//is IPv6. An entry is saved and updated under the type it was routed to. Entries given a type of A or AAAA keep it,
+//so a name can have both with a source for each family, and are left out while their IP is of the other family.
+func (u *Updater) routeByFamily(hosts []Host, ips map[string]string) (routed []Host) {
+
+	for _, host := range hosts {
+		addr, err := netip.ParseAddr(ips[u.sourceOf(host)])
+		if err != nil || (host.Type != "A" && host.Type != "AAAA") {
+			routed = append(routed, host)
+			continue
+		}
+
+		recordType := addrRecordType(addr)
+		switch {
+		case recordType == host.Type:
+		case host.typeGiven || host.Matched:
+			u.log.Printf("Skipping %v: it is an %v record, which can't hold its IP %v. Leave the type out for the record to follow the IP's family.", host, host.Type, addr)
+			continue
+		default:
+			u.logVerbose("Host entry %v is updated as an %v record as its IP is %v", host, recordType, addr)
+			host.Type = recordType
+		}
+		routed = append(routed, host)
+	}
+
+	return
+}
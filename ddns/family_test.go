@@ -0,0 +1,58 @@
+package ddns
+
+import (
+	"testing"
+)
+
+func TestRouteByFamily(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		spec     string
+		ip       string
+		wantType string
+	}{
+		{"default with IPv4", "home", "203.0.113.10", "A"},
+		{"default with IPv6", "home", "2001:db8::1", "AAAA"},
+		{"given A with IPv4", "home,type=A", "203.0.113.10", "A"},
+		{"given A with IPv6", "home,type=A", "2001:db8::1", ""},
+		{"given AAAA with IPv6", "home,type=AAAA", "2001:db8::1", "AAAA"},
+		{"given AAAA with IPv4", "home,type=AAAA", "203.0.113.10", ""},
+		{"other type", "home,type=TXT,content=ip={ip}", "2001:db8::1", "TXT"},
+		{"no IP detected", "home,type=AAAA", "", "AAAA"},
+	}
+
+	for _, test := range tests {
+		u, err := New(WithToken("fake"), WithZone("example.com"), WithHosts(test.spec), WithIPSource("dns"))
+		if err != nil {
+			t.Fatalf("%v: %v", test.name, err)
+		}
+
+		routed := u.routeByFamily(u.hosts, map[string]string{"dns": test.ip})
+		switch {
+		case test.wantType == "" && len(routed) != 0:
+			t.Errorf("%v: routed to %v, expected the host to be skipped", test.name, routed[0].Type)
+		case test.wantType != "" && len(routed) != 1:
+			t.Errorf("%v: host was skipped, expected it routed to %v", test.name, test.wantType)
+		case test.wantType != "" && routed[0].Type != test.wantType:
+			t.Errorf("%v: routed to %v, expected %v", test.name, routed[0].Type, test.wantType)
+		}
+	}
+}
+
+func TestRouteByFamilyDualStack(t *testing.T) {
+
+	u, err := New(WithToken("fake"), WithZone("example.com"), WithIPSource("dns"),
+		WithHosts("home,type=A,source=https://api4.example.com", "home,type=AAAA,source=https://api6.example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	routed := u.routeByFamily(u.hosts, map[string]string{
+		"https://api4.example.com": "203.0.113.10",
+		"https://api6.example.com": "2001:db8::1",
+	})
+	if len(routed) != 2 || routed[0].Type != "A" || routed[1].Type != "AAAA" {
+		t.Errorf("Routed %v, expected the A and AAAA records of the name kept apart", routed)
+	}
+}
@@ -0,0 +1,190 @@
+package ddns
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jonegerton/go-cloudflare-ddns/ipsource"
+)
+
+//IP filter kinds for -ip-filter
+const (
+	filterDenyPrivate = "deny-private"
+	filterAllow       = "allow"
+	filterDeny        = "deny"
+	filterStable      = "stable"
+)
+
+//errIPRejected is returned when an IP filter rejects a detected IP. The source did answer, so it isn't counted as failing.
+var errIPRejected = errors.New("Rejected by -ip-filter")
+
+//IPFilter is a check applied to detected IPs, parsed from an -ip-filter value of the form:
+//deny-private, allow=<cidr>[,<cidr>...], deny=<cidr>[,<cidr>...] or stable[=<polls>]
+//Filters are applied in the order given, each to the IP passed on by the one before.
+type IPFilter struct {
+	Kind     string
+	Prefixes []netip.Prefix
+	Polls    int
+}
+
+//stableIP tracks an IP source for a stable filter: the IP last let through, and a new IP and how many polls in a row it has been seen
+type stableIP struct {
+	Accepted  string `json:"accepted"`
+	Candidate string `json:"candidate,omitempty"`
+	Seen      int    `json:"seen,omitempty"`
+}
+
+//ParseIPFilters parses the -ip-filter values
+func ParseIPFilters(values []string) (filters []IPFilter, err error) {
+
+	for _, value := range values {
+		kind, arg, hasArg := strings.Cut(strings.TrimSpace(value), "=")
+		filter := IPFilter{Kind: kind}
+
+		switch kind {
+		case filterDenyPrivate:
+			if hasArg {
+				err = fmt.Errorf("IP filter '%v' doesn't take a value", value)
+				return
+			}
+		case filterAllow, filterDeny:
+			for _, cidr := range strings.Split(arg, ",") {
+				prefix, parseErr := netip.ParsePrefix(strings.TrimSpace(cidr))
+				if parseErr != nil {
+					err = fmt.Errorf("IP filter '%v' has an invalid range '%v' (expected eg 203.0.113.0/24)", value, cidr)
+					return
+				}
+				filter.Prefixes = append(filter.Prefixes, prefix.Masked())
+			}
+		case filterStable:
+			filter.Polls = 2
+			if hasArg {
+				if filter.Polls, err = strconv.Atoi(arg); err != nil || filter.Polls < 2 {
+					err = fmt.Errorf("IP filter '%v' needs a number of polls of at least 2", value)
+					return
+				}
+			}
+		default:
+			err = fmt.Errorf("IP filter '%v' is not valid (expected %v, %v=<ranges>, %v=<ranges> or %v[=<polls>])", value, filterDenyPrivate, filterAllow, filterDeny, filterStable)
+			return
+		}
+
+		filters = append(filters, filter)
+	}
+
+	return
+}
+
+//String describes the filter as it was given
+func (f IPFilter) String() string {
+	switch f.Kind {
+	case filterAllow, filterDeny:
+		var cidrs []string
+		for _, prefix := range f.Prefixes {
+			cidrs = append(cidrs, prefix.String())
+		}
+		return f.Kind + "=" + strings.Join(cidrs, ",")
+	case filterStable:
+		return fmt.Sprintf("%v=%d", f.Kind, f.Polls)
+	}
+	return f.Kind
+}
+
+//contains reports whether addr is in any of the filter's ranges
+func (f IPFilter) contains(addr netip.Addr) bool {
+	for _, prefix := range f.Prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+//applyIPFilters runs the -ip-filter chain over each detected IP. An IP that is rejected fails the run with errIPRejected,
+//and a stable filter passes on the IP it last let through until a new one has been seen for long enough.
+//changed is true if the stable filters' tracking in the saved data changed, so it needs saving.
+func (u *Updater) applyIPFilters(saveData *saveDataDocument, ips map[string]string) (changed bool, err error) {
+
+	if len(u.cfg.IPFilters) == 0 {
+		return
+	}
+
+	specs := make([]string, 0, len(ips))
+	for spec := range ips {
+		specs = append(specs, spec)
+	}
+	sort.Strings(specs)
+
+	for _, spec := range specs {
+		ip := ips[spec]
+		for i, filter := range u.cfg.IPFilters {
+			addr, parseErr := netip.ParseAddr(ip)
+			if parseErr != nil {
+				return changed, fmt.Errorf("IP %v from %v is not valid: %v", ip, spec, parseErr)
+			}
+
+			switch filter.Kind {
+			case filterDenyPrivate:
+				if !ipsource.IsPublic(addr) {
+					return changed, fmt.Errorf("%w: IP %v from %v is not a public address (IP filter %v)", errIPRejected, ip, spec, filter)
+				}
+			case filterAllow:
+				if !filter.contains(addr) {
+					return changed, fmt.Errorf("%w: IP %v from %v is not in an allowed range (IP filter %v)", errIPRejected, ip, spec, filter)
+				}
+			case filterDeny:
+				if filter.contains(addr) {
+					return changed, fmt.Errorf("%w: IP %v from %v is in a denied range (IP filter %v)", errIPRejected, ip, spec, filter)
+				}
+			case filterStable:
+				var tracked bool
+				ip, tracked = u.stableFilter(saveData, fmt.Sprintf("%d:%s", i, spec), filter, ip)
+				changed = changed || tracked
+			}
+		}
+
+		if ip != ips[spec] {
+			u.logVerbose("WAN IP from %s after filters is: %s", spec, ip)
+		}
+		ips[spec] = ip
+	}
+
+	return
+}
+
+//stableFilter returns the IP a stable filter passes on for a detected ip, holding back a new IP until it has been seen
+//for enough polls in a row. The first IP seen is let through straight away, as there is nothing to hold.
+//changed is true if the tracking in the saved data changed.
+func (u *Updater) stableFilter(saveData *saveDataDocument, key string, filter IPFilter, ip string) (passed string, changed bool) {
+
+	if saveData.StableIPs == nil {
+		saveData.StableIPs = make(map[string]stableIP)
+	}
+	state, tracked := saveData.StableIPs[key]
+
+	switch {
+	case !tracked || state.Accepted == "":
+		state = stableIP{Accepted: ip}
+	case ip == state.Accepted:
+		state.Candidate, state.Seen = "", 0
+	case ip == state.Candidate:
+		state.Seen++
+	default:
+		state.Candidate, state.Seen = ip, 1
+	}
+
+	if state.Candidate != "" && state.Seen >= filter.Polls {
+		state = stableIP{Accepted: ip}
+	}
+	if state.Candidate != "" {
+		u.log.Printf("New IP %v has been seen %d of %d times in a row - keeping %v until it is stable.", ip, state.Seen, filter.Polls, state.Accepted)
+	}
+
+	changed = !tracked || state != saveData.StableIPs[key]
+	saveData.StableIPs[key] = state
+	return state.Accepted, changed
+}
@@ -0,0 +1,121 @@
+package ddns
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/jonegerton/go-cloudflare-ddns/fakecf"
+)
+
+func TestParseIPFilters(t *testing.T) {
+
+	tests := []struct {
+		values  []string
+		want    []string
+		wantErr bool
+	}{
+		{values: []string{"deny-private"}, want: []string{"deny-private"}},
+		{values: []string{"allow=203.0.113.7/24, 198.51.100.0/24"}, want: []string{"allow=203.0.113.0/24,198.51.100.0/24"}},
+		{values: []string{"deny=192.0.2.0/24", "stable"}, want: []string{"deny=192.0.2.0/24", "stable=2"}},
+		{values: []string{"stable=5"}, want: []string{"stable=5"}},
+		{values: []string{"deny-private=yes"}, wantErr: true},
+		{values: []string{"allow=203.0.113.0"}, wantErr: true},
+		{values: []string{"stable=1"}, wantErr: true},
+		{values: []string{"stable=often"}, wantErr: true},
+		{values: []string{"public-only"}, wantErr: true},
+	}
+
+	for _, test := range tests {
+		filters, err := ParseIPFilters(test.values)
+		if (err != nil) != test.wantErr {
+			t.Errorf("ParseIPFilters(%q) error %v, want error %v", test.values, err, test.wantErr)
+			continue
+		}
+		var got []string
+		for _, filter := range filters {
+			got = append(got, filter.String())
+		}
+		if !test.wantErr && !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ParseIPFilters(%q) = %v, want %v", test.values, got, test.want)
+		}
+	}
+}
+
+func TestApplyIPFilters(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		filters  []string
+		ip       string
+		rejected bool
+	}{
+		{"public allowed", []string{"deny-private"}, "203.0.113.10", false},
+		{"private denied", []string{"deny-private"}, "192.168.1.2", true},
+		{"cgnat denied", []string{"deny-private"}, "100.64.1.2", true},
+		{"in allowed range", []string{"allow=203.0.113.0/24"}, "203.0.113.10", false},
+		{"outside allowed range", []string{"allow=203.0.113.0/24"}, "198.51.100.1", true},
+		{"in denied range", []string{"deny=203.0.113.0/24"}, "203.0.113.10", true},
+		{"ipv6 outside ipv4 range", []string{"deny=203.0.113.0/24"}, "2001:db8::1", false},
+		{"chain", []string{"deny-private", "allow=198.51.100.0/24"}, "203.0.113.10", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			fake := fakecf.New("203.0.113.10")
+			fake.AddZone("example.com")
+			cfg := DefaultConfig()
+			var err error
+			if cfg.IPFilters, err = ParseIPFilters(test.filters); err != nil {
+				t.Fatal(err)
+			}
+			u := testUpdater(t, fake, cfg, WithHosts("home"))
+
+			ips := map[string]string{"default": test.ip}
+			_, err = u.applyIPFilters(&saveDataDocument{}, ips)
+			if rejected := errors.Is(err, errIPRejected); rejected != test.rejected {
+				t.Errorf("applyIPFilters returned %v, want rejected %v", err, test.rejected)
+			}
+		})
+	}
+}
+
+func TestStableFilter(t *testing.T) {
+
+	fake := fakecf.New("203.0.113.10")
+	fake.AddZone("example.com")
+	cfg := DefaultConfig()
+	var err error
+	if cfg.IPFilters, err = ParseIPFilters([]string{"stable=3"}); err != nil {
+		t.Fatal(err)
+	}
+	u := testUpdater(t, fake, cfg, WithHosts("home"))
+
+	//Each poll's detected IP, and the IP the filter should pass on
+	polls := []struct {
+		detected string
+		want     string
+	}{
+		{"192.0.2.1", "192.0.2.1"},
+		{"192.0.2.2", "192.0.2.1"},
+		{"192.0.2.2", "192.0.2.1"},
+		{"192.0.2.3", "192.0.2.1"},
+		{"192.0.2.1", "192.0.2.1"},
+		{"192.0.2.3", "192.0.2.1"},
+		{"192.0.2.3", "192.0.2.1"},
+		{"192.0.2.3", "192.0.2.3"},
+		{"192.0.2.3", "192.0.2.3"},
+	}
+
+	var saveData saveDataDocument
+	for i, poll := range polls {
+		ips := map[string]string{"default": poll.detected}
+		if _, err := u.applyIPFilters(&saveData, ips); err != nil {
+			t.Fatalf("Poll %d: applyIPFilters returned %v", i, err)
+		}
+		if ips["default"] != poll.want {
+			t.Errorf("Poll %d: detected %v passed on %v, want %v", i, poll.detected, ips["default"], poll.want)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package ddns
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+//healthCheck checks the service is reachable on ip before it is published.
+//With -healthcheck-url an external checker is asked, as connecting to our own public IP
+//from inside the network doesn't work with every router. Otherwise -healthcheck-port is connected to directly.
+func (u *Updater) healthCheck(ip string) (err error) {
+
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("Health check of %v failed: %v", ip, err)
+		}
+	}()
+
+	port := strconv.Itoa(u.cfg.HealthCheckPort)
+
+	if u.cfg.HealthCheckURL != "" {
+		url := strings.NewReplacer("{ip}", ip, "{port}", port).Replace(u.cfg.HealthCheckURL)
+
+		client := &http.Client{
+			Timeout:   u.cfg.HealthCheckTimeout,
+			Transport: u.transport,
+		}
+		resp, getErr := client.Get(url)
+		if getErr != nil {
+			err = getErr
+			return
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			err = fmt.Errorf("Checker %v returned status %d", url, resp.StatusCode)
+		}
+		return
+	}
+
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(ip, port), u.cfg.HealthCheckTimeout)
+	if err != nil {
+		return
+	}
+	conn.Close()
+
+	return
+}
+
+//healthCheckHosts returns the hosts whose new IP passes the health check.
+//Hosts that fail are left for the next run, by which time the service may be reachable.
+func (u *Updater) healthCheckHosts(changed []Host, ips map[string]string) (passed []Host) {
+
+	results := make(map[string]error)
+
+	for _, host := range changed {
+		ip := ips[u.sourceOf(host)]
+
+		checkErr, done := results[ip]
+		if !done {
+			checkErr = u.healthCheck(ip)
+			results[ip] = checkErr
+			if checkErr == nil {
+				u.logVerbose("Health check of %v passed", ip)
+			}
+		}
+
+		if checkErr != nil {
+			u.log.Printf("Not updating %v yet: %v", host, checkErr)
+			continue
+		}
+		passed = append(passed, host)
+	}
+
+	return
+}
@@ -0,0 +1,47 @@
+package ddns
+
+import "errors"
+
+//Hooks are callbacks for progress through a run, so programs embedding the updater can show it
+//without parsing logs. Any of them can be nil. They are called on the goroutine doing the run,
+//so should return quickly.
+type Hooks struct {
+	//IPDetected is called with each IP found, and the source it came from
+	IPDetected func(source string, ip string)
+	//RecordUpdated is called after a host's record is updated from oldIP to newIP
+	RecordUpdated func(host Host, oldIP string, newIP string)
+	//UpdateFailed is called when updating a host's record fails, or is skipped as the run was cancelled
+	//Neither is called for hosts whose change is only staged in the record comment by Config.Staged
+	UpdateFailed func(host Host, err error)
+
+	//MutatePayload can change the record sent to Cloudflare to create or update host's record, after Config.PayloadPatch,
+	//eg to set a field the updater doesn't know about yet. payload is the JSON object as decoded by encoding/json.
+	//The type, name, content, data and comment are set by the updater and can't be changed. An error stops the update.
+	MutatePayload func(host Host, payload map[string]interface{}) error
+}
+
+//WithHooks registers callbacks for lifecycle events
+func WithHooks(hooks Hooks) Option {
+	return func(u *Updater) error {
+		u.hooks = hooks
+		return nil
+	}
+}
+
+//ipDetected calls the IPDetected hook if there is one
+func (u *Updater) ipDetected(source string, ip string) {
+	if u.hooks.IPDetected != nil {
+		u.hooks.IPDetected(source, ip)
+	}
+}
+
+//hostDone calls RecordUpdated or UpdateFailed for the result, if set
+func (u *Updater) hostDone(r hostResult) {
+	switch {
+	case errors.Is(r.Err, errStaged):
+	case r.Err == nil && u.hooks.RecordUpdated != nil:
+		u.hooks.RecordUpdated(r.Host, r.OldIP, r.NewIP)
+	case r.Err != nil && u.hooks.UpdateFailed != nil:
+		u.hooks.UpdateFailed(r.Host, r.Err)
+	}
+}
@@ -0,0 +1,281 @@
+package ddns
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//ipPlaceholder is replaced with the WAN IP when rendering record content
+const ipPlaceholder = "{ip}"
+
+//Host is a record to maintain, parsed from a -cfhost value of the form:
+//name[,type=TXT][,content=...] or name,type=SRV,port=n[,target=...][,priority=n][,weight=n]
+//Any entry can also have source=<ip source> to use a different IP source to -wan-ip-source,
+//ttl=<ttl> to set the record's TTL, see ParseTTL, and any number of label.<name>=<value>.
+type Host struct {
+	Name    string
+	Type    string
+	Content string
+	Source  string
+	SRV     SRVData
+
+	//TTL is in seconds, 1 for automatic. Zero keeps the record's existing TTL.
+	TTL int
+
+	//Matched is set for records found by -update-all-matching rather than configured
+	Matched bool
+
+	//typeGiven is set when the type was given with type=, rather than left as the default A record. Only entries
+	//left as the default follow the family of the IP, see routeByFamily.
+	typeGiven bool
+
+	//Labels are passed through to logs, metrics, notifications and reports, eg to route alerts by site or team.
+	//They are set with label.<name>=<value> options.
+	Labels map[string]string
+}
+
+//labelPrefix starts a host option setting a label, eg label.site=london
+const labelPrefix = "label."
+
+//reservedLabels are names used by the utility's own log fields and metrics labels, so can't be host labels
+var reservedLabels = map[string]bool{"run": true, "op": true, "name": true, "type": true, "content": true, "source": true, "ip": true}
+
+//labelName matches the names Prometheus allows for labels, so every label can be used in metrics
+var labelName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+//SRVData is the data block of an SRV record
+type SRVData struct {
+	Priority int    `json:"priority"`
+	Weight   int    `json:"weight"`
+	Port     int    `json:"port"`
+	Target   string `json:"target"`
+}
+
+//NewHost returns an A record entry holding the WAN IP
+func NewHost(name string) Host {
+	return Host{
+		Name:    strings.TrimSpace(name),
+		Type:    "A",
+		Content: ipPlaceholder,
+		SRV:     SRVData{Priority: -1, Weight: -1},
+	}
+}
+
+//ParseHost parses a -cfhost value. Bare names are A records holding the WAN IP.
+func ParseHost(value string) (host Host, err error) {
+
+	parts := strings.Split(value, ",")
+
+	host = NewHost(parts[0])
+
+	for _, part := range parts[1:] {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			err = fmt.Errorf("Host entry '%v' has an invalid option '%v' (expected key=value)", value, part)
+			return
+		}
+		if err = host.SetOption(strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])); err != nil {
+			err = fmt.Errorf("Host entry '%v' %v", value, err)
+			return
+		}
+	}
+
+	if err = host.Validate(); err != nil {
+		err = fmt.Errorf("Host entry '%v' %v", value, err)
+	}
+
+	return
+}
+
+//SetOption applies a single option to the entry
+func (h *Host) SetOption(key string, val string) error {
+
+	switch key {
+	case "type":
+		h.Type = strings.ToUpper(val)
+		h.typeGiven = true
+	case "content":
+		h.Content = val
+	case "source":
+		h.Source = val
+	case "ttl":
+		ttl, err := ParseTTL(val)
+		if err != nil {
+			return fmt.Errorf("has an invalid ttl: %v", err)
+		}
+		h.TTL = ttl
+	case "target":
+		h.SRV.Target = strings.TrimSuffix(val, ".")
+	case "port", "priority", "weight":
+		n, err := strconv.Atoi(val)
+		if err != nil || n < 0 || n > 65535 {
+			return fmt.Errorf("has an invalid %v '%v'", key, val)
+		}
+		switch key {
+		case "port":
+			h.SRV.Port = n
+		case "priority":
+			h.SRV.Priority = n
+		case "weight":
+			h.SRV.Weight = n
+		}
+	default:
+		if !strings.HasPrefix(key, labelPrefix) {
+			return fmt.Errorf("has an unknown option '%v'", key)
+		}
+		name := strings.TrimPrefix(key, labelPrefix)
+		if !labelName.MatchString(name) || reservedLabels[name] {
+			return fmt.Errorf("has an invalid label name '%v' (expected letters, digits and underscores, and not one of run, op, name, type, content, source or ip)", name)
+		}
+		if h.Labels == nil {
+			h.Labels = make(map[string]string)
+		}
+		h.Labels[name] = val
+	}
+
+	return nil
+}
+
+//labelPairs returns the host's labels as name=value, sorted by name
+func (h Host) labelPairs() (pairs []string) {
+	for name, val := range h.Labels {
+		pairs = append(pairs, name+"="+val)
+	}
+	sort.Strings(pairs)
+	return
+}
+
+//Validate checks the options make sense for the record type.
+//Sources are checked by New, as router sources depend on its settings.
+func (h *Host) Validate() error {
+
+	if h.Name == "" {
+		return fmt.Errorf("has no name")
+	}
+
+	switch h.Type {
+	case "A", "AAAA", "TXT", "CNAME":
+	case "SRV":
+		if h.SRV.Port == 0 {
+			return fmt.Errorf("is an SRV record so needs a port")
+		}
+	default:
+		return fmt.Errorf("has an unsupported record type '%v'", h.Type)
+	}
+
+	if (h.Type == "A" || h.Type == "AAAA") && h.Content != ipPlaceholder {
+		return fmt.Errorf("is an %v record so its content must be %v", h.Type, ipPlaceholder)
+	}
+	//A CNAME holds a host name, so can't take the default content of just the IP
+	if h.Type == "CNAME" && h.Content == ipPlaceholder {
+		return fmt.Errorf("is a CNAME record so needs content naming the target, eg content=home.example.com")
+	}
+
+	return nil
+}
+
+//normalizeName lowercases name, removes any trailing dot and converts internationalized names to punycode.
+//Names without a trailing dot are relative to zone unless they are already within it, as in a zone file,
+//and @ is the zone itself.
+func normalizeName(name string, zone string) string {
+
+	name = toASCII(strings.ToLower(strings.TrimSpace(name)))
+	if name == "@" {
+		return zone
+	}
+	if strings.HasSuffix(name, ".") {
+		return strings.TrimSuffix(name, ".")
+	}
+	if zone == "" || name == zone || strings.HasSuffix(name, "."+zone) {
+		return name
+	}
+	return name + "." + zone
+}
+
+//normalizeHosts normalizes the names of hosts and drops repeats of the same record,
+//so a record isn't updated twice in a run. Repeats are logged, as the entries may have been meant to differ.
+func (u *Updater) normalizeHosts(hosts []Host) (normalized []Host) {
+
+	seen := make(map[string]Host)
+
+	for _, host := range hosts {
+		original := host.Name
+		host.Name = normalizeName(host.Name, u.cfg.Zone)
+		host.SRV.Target = toASCII(strings.ToLower(strings.TrimSuffix(host.SRV.Target, ".")))
+		if host.Name != original {
+			u.logVerbose("Host entry '%v' is %v", original, host.Name)
+		}
+
+		if first, ok := seen[host.key()]; ok {
+			u.log.Printf("Host entry '%v' is the same record as '%v' - ignoring the repeat.", original, first)
+			continue
+		}
+		seen[host.key()] = host
+		normalized = append(normalized, host)
+	}
+
+	return
+}
+
+//defaultSRVTargets points SRV entries without a target at the first A or AAAA record in the list
+func defaultSRVTargets(hosts []Host) (err error) {
+
+	for i := range hosts {
+		if hosts[i].Type != "SRV" || hosts[i].SRV.Target != "" {
+			continue
+		}
+		for _, host := range hosts {
+			if host.Type == "A" || host.Type == "AAAA" {
+				hosts[i].SRV.Target = host.Name
+				break
+			}
+		}
+		if hosts[i].SRV.Target == "" {
+			err = fmt.Errorf("Host entry '%v' is an SRV record with no target and there is no A or AAAA record to follow", hosts[i].Name)
+			return
+		}
+	}
+
+	return
+}
+
+//submitSRV returns the SRV data to submit, keeping the existing priority and weight unless set
+func (h Host) submitSRV(existing SRVData) *SRVData {
+	srv := h.SRV
+	if srv.Priority < 0 {
+		srv.Priority = existing.Priority
+	}
+	if srv.Weight < 0 {
+		srv.Weight = existing.Weight
+	}
+	return &srv
+}
+
+//matches reports whether the record already holds what would be submitted for ip
+func (h Host) matches(current hostData, ip string) bool {
+	if h.Type == "SRV" {
+		return current.Data.Port == h.SRV.Port && strings.EqualFold(strings.TrimSuffix(current.Data.Target, "."), h.SRV.Target)
+	}
+	return strings.Trim(current.Content, `"`) == strings.Trim(h.render(ip), `"`)
+}
+
+//key identifies the record in the saved data
+func (h Host) key() string {
+	return h.Type + ":" + strings.ToLower(h.Name)
+}
+
+//render returns the record content with the IP filled in
+func (h Host) render(ip string) string {
+	return strings.Replace(h.Content, ipPlaceholder, ip, -1)
+}
+
+//String describes the entry for logging, with internationalized names in Unicode
+func (h Host) String() string {
+	if h.Type == "A" {
+		return toUnicode(h.Name)
+	}
+	return fmt.Sprintf("%s (%s)", toUnicode(h.Name), h.Type)
+}
@@ -0,0 +1,90 @@
+package ddns
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/jonegerton/go-cloudflare-ddns/fakecf"
+)
+
+func TestParseHost(t *testing.T) {
+
+	tests := []struct {
+		value   string
+		want    Host
+		wantErr bool
+	}{
+		{value: "home", want: Host{Name: "home", Type: "A", Content: ipPlaceholder, SRV: SRVData{Priority: -1, Weight: -1}}},
+		{value: " home ", want: Host{Name: "home", Type: "A", Content: ipPlaceholder, SRV: SRVData{Priority: -1, Weight: -1}}},
+		{value: "home,type=aaaa", want: Host{Name: "home", Type: "AAAA", Content: ipPlaceholder, SRV: SRVData{Priority: -1, Weight: -1}, typeGiven: true}},
+		{value: "txt,type=TXT,content=v=spf1 ip4:{ip} -all", want: Host{Name: "txt", Type: "TXT", Content: "v=spf1 ip4:{ip} -all", SRV: SRVData{Priority: -1, Weight: -1}, typeGiven: true}},
+		{value: "_sip._tcp,type=SRV,port=5060,target=sip.example.com.,priority=10", want: Host{Name: "_sip._tcp", Type: "SRV", Content: ipPlaceholder, SRV: SRVData{Priority: 10, Weight: -1, Port: 5060, Target: "sip.example.com"}, typeGiven: true}},
+		{value: "home,ttl=300,source=stun", want: Host{Name: "home", Type: "A", Content: ipPlaceholder, Source: "stun", TTL: 300, SRV: SRVData{Priority: -1, Weight: -1}}},
+		{value: "home,label.site=london", want: Host{Name: "home", Type: "A", Content: ipPlaceholder, SRV: SRVData{Priority: -1, Weight: -1}, Labels: map[string]string{"site": "london"}}},
+		{value: "", wantErr: true},
+		{value: "home,type", wantErr: true},
+		{value: "home,colour=red", wantErr: true},
+		{value: "home,type=MX", wantErr: true},
+		{value: "home,content=1.2.3.4", wantErr: true},
+		{value: "alias,type=CNAME", wantErr: true},
+		{value: "_sip._tcp,type=SRV", wantErr: true},
+		{value: "_sip._tcp,type=SRV,port=70000", wantErr: true},
+		{value: "home,label.ip=x", wantErr: true},
+		{value: "home,label.bad-name=x", wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			host, err := ParseHost(test.value)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("error %v, want error %v", err, test.wantErr)
+			}
+			if !test.wantErr && !reflect.DeepEqual(host, test.want) {
+				t.Errorf("got %+v, want %+v", host, test.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeName(t *testing.T) {
+
+	tests := []struct {
+		name string
+		zone string
+		want string
+	}{
+		{"home", "example.com", "home.example.com"},
+		{"Home.Example.com", "example.com", "home.example.com"},
+		{"home.example.com.", "example.com", "home.example.com"},
+		{"other.org.", "example.com", "other.org"},
+		{"@", "example.com", "example.com"},
+		{"example.com", "example.com", "example.com"},
+		{"home", "", "home"},
+		{"bücher", "example.com", "xn--bcher-kva.example.com"},
+	}
+
+	for _, test := range tests {
+		if got := normalizeName(test.name, test.zone); got != test.want {
+			t.Errorf("normalizeName(%q, %q) = %q, want %q", test.name, test.zone, got, test.want)
+		}
+	}
+}
+
+func TestNormalizeHostsDropsRepeats(t *testing.T) {
+
+	fake := fakecf.New("203.0.113.10")
+	fake.AddZone("example.com")
+	u := testUpdater(t, fake, DefaultConfig(), WithHosts("home"))
+
+	hosts := []Host{NewHost("home"), NewHost("HOME.example.com."), NewHost("home"), NewHost("www")}
+	hosts[2].Type = "AAAA"
+
+	var names []string
+	for _, host := range u.normalizeHosts(hosts) {
+		names = append(names, host.key())
+	}
+	want := []string{"A:home.example.com", "AAAA:home.example.com", "A:www.example.com"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("got %v, want %v", names, want)
+	}
+}
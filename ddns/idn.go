@@ -0,0 +1,238 @@
+package ddns
+
+import (
+	"errors"
+	"strings"
+	"unicode/utf8"
+)
+
+//Punycode parameters from RFC 3492
+const (
+	punyBase        = 36
+	punyTMin        = 1
+	punyTMax        = 26
+	punySkew        = 38
+	punyDamp        = 700
+	punyInitialBias = 72
+	punyInitialN    = 128
+)
+
+//acePrefix marks a label encoded with punycode
+const acePrefix = "xn--"
+
+//toASCII converts an internationalized domain name to the punycode form the API uses.
+//Names that are already ASCII are returned unchanged.
+func toASCII(name string) string {
+
+	labels := strings.Split(name, ".")
+	for i, label := range labels {
+		if isASCII(label) {
+			continue
+		}
+		labels[i] = acePrefix + punyEncode([]rune(strings.ToLower(label)))
+	}
+
+	return strings.Join(labels, ".")
+}
+
+//toUnicode converts punycode labels back to Unicode for display.
+//Labels that don't decode are left as they are.
+func toUnicode(name string) string {
+
+	labels := strings.Split(name, ".")
+	for i, label := range labels {
+		if !strings.HasPrefix(strings.ToLower(label), acePrefix) {
+			continue
+		}
+		if decoded, err := punyDecode(label[len(acePrefix):]); err == nil {
+			labels[i] = decoded
+		}
+	}
+
+	return strings.Join(labels, ".")
+}
+
+//isASCII reports whether s has only ASCII characters
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+//punyAdapt is the bias adaptation function from RFC 3492 section 6.1
+func punyAdapt(delta int, numPoints int, first bool) int {
+
+	if first {
+		delta /= punyDamp
+	} else {
+		delta /= 2
+	}
+	delta += delta / numPoints
+
+	k := 0
+	for delta > ((punyBase-punyTMin)*punyTMax)/2 {
+		delta /= punyBase - punyTMin
+		k += punyBase
+	}
+
+	return k + (punyBase-punyTMin+1)*delta/(delta+punySkew)
+}
+
+//punyThreshold returns the threshold for digit position k
+func punyThreshold(k int, bias int) int {
+	switch {
+	case k <= bias:
+		return punyTMin
+	case k >= bias+punyTMax:
+		return punyTMax
+	}
+	return k - bias
+}
+
+//punyDigit returns the character for digit d
+func punyDigit(d int) byte {
+	if d < 26 {
+		return byte('a' + d)
+	}
+	return byte('0' + d - 26)
+}
+
+//punyEncode encodes a label with punycode, RFC 3492 section 6.3
+func punyEncode(input []rune) string {
+
+	var out strings.Builder
+	for _, c := range input {
+		if c < 0x80 {
+			out.WriteRune(c)
+		}
+	}
+
+	basic := out.Len()
+	handled := basic
+	if basic > 0 {
+		out.WriteByte('-')
+	}
+
+	n, delta, bias := punyInitialN, 0, punyInitialBias
+
+	for handled < len(input) {
+
+		//The next code point to insert is the smallest not yet handled
+		m := int(utf8.MaxRune) + 1
+		for _, c := range input {
+			if int(c) >= n && int(c) < m {
+				m = int(c)
+			}
+		}
+		delta += (m - n) * (handled + 1)
+		n = m
+
+		for _, c := range input {
+			if int(c) < n {
+				delta++
+			}
+			if int(c) != n {
+				continue
+			}
+
+			q := delta
+			for k := punyBase; ; k += punyBase {
+				t := punyThreshold(k, bias)
+				if q < t {
+					break
+				}
+				out.WriteByte(punyDigit(t + (q-t)%(punyBase-t)))
+				q = (q - t) / (punyBase - t)
+			}
+			out.WriteByte(punyDigit(q))
+
+			bias = punyAdapt(delta, handled+1, handled == basic)
+			delta = 0
+			handled++
+		}
+
+		delta++
+		n++
+	}
+
+	return out.String()
+}
+
+//errBadPunycode is returned for labels that aren't valid punycode
+var errBadPunycode = errors.New("Invalid punycode")
+
+//punyDecode decodes a punycode label, RFC 3492 section 6.2
+func punyDecode(s string) (string, error) {
+
+	//An empty label would turn xn-- into nothing
+	if s == "" {
+		return "", errBadPunycode
+	}
+
+	var output []rune
+
+	pos := 0
+	if b := strings.LastIndexByte(s, '-'); b >= 0 {
+		for _, c := range s[:b] {
+			if c >= 0x80 {
+				return "", errBadPunycode
+			}
+			output = append(output, c)
+		}
+		pos = b + 1
+	}
+
+	n, i, bias := punyInitialN, 0, punyInitialBias
+
+	for pos < len(s) {
+
+		oldI, w := i, 1
+		for k := punyBase; ; k += punyBase {
+			if pos >= len(s) {
+				return "", errBadPunycode
+			}
+
+			c := s[pos]
+			pos++
+
+			var digit int
+			switch {
+			case c >= 'a' && c <= 'z':
+				digit = int(c - 'a')
+			case c >= 'A' && c <= 'Z':
+				digit = int(c - 'A')
+			case c >= '0' && c <= '9':
+				digit = int(c-'0') + 26
+			default:
+				return "", errBadPunycode
+			}
+
+			i += digit * w
+			t := punyThreshold(k, bias)
+			if digit < t {
+				break
+			}
+			w *= punyBase - t
+			if w > utf8.MaxRune {
+				return "", errBadPunycode
+			}
+		}
+
+		bias = punyAdapt(i-oldI, len(output)+1, oldI == 0)
+		n += i / (len(output) + 1)
+		i %= len(output) + 1
+		if n > utf8.MaxRune {
+			return "", errBadPunycode
+		}
+
+		output = append(output, 0)
+		copy(output[i+1:], output[i:])
+		output[i] = rune(n)
+		i++
+	}
+
+	return string(output), nil
+}
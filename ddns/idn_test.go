@@ -0,0 +1,47 @@
+package ddns
+
+import "testing"
+
+func TestIDN(t *testing.T) {
+
+	//Expected forms from RFC 3492's examples and the IDNA test vectors
+	tests := []struct {
+		unicode string
+		ascii   string
+	}{
+		{"example.com", "example.com"},
+		{"bücher.example", "xn--bcher-kva.example"},
+		{"münchen.de", "xn--mnchen-3ya.de"},
+		{"例え.テスト", "xn--r8jz45g.xn--zckzah"},
+		{"пример.рф", "xn--e1afmkfd.xn--p1ai"},
+		{"home.café.example.com", "home.xn--caf-dma.example.com"},
+	}
+
+	for _, test := range tests {
+		if got := toASCII(test.unicode); got != test.ascii {
+			t.Errorf("toASCII(%q) = %q, want %q", test.unicode, got, test.ascii)
+		}
+		if got := toUnicode(test.ascii); got != test.unicode {
+			t.Errorf("toUnicode(%q) = %q, want %q", test.ascii, got, test.unicode)
+		}
+	}
+}
+
+func TestIDNCase(t *testing.T) {
+
+	if got := toASCII("Bücher.example"); got != "xn--bcher-kva.example" {
+		t.Errorf("toASCII lowercases labels it encodes, got %q", got)
+	}
+	if got := toUnicode("XN--bcher-kva.example"); got != "bücher.example" {
+		t.Errorf("toUnicode of an uppercase prefix got %q", got)
+	}
+}
+
+func TestToUnicodeInvalid(t *testing.T) {
+
+	for _, name := range []string{"xn--.example", "xn--bcher-!va.example", "xn--99999999999999.example"} {
+		if got := toUnicode(name); got != name {
+			t.Errorf("toUnicode(%q) = %q, want it left as it is", name, got)
+		}
+	}
+}
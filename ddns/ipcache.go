@@ -0,0 +1,83 @@
+package ddns
+
+import (
+	"context"
+	"net"
+	"sort"
+	"strings"
+	"time"
+)
+
+//cachedIP is an IP detected from a source, used again for later runs while it is trusted, see IPCache
+type cachedIP struct {
+	IP       string
+	Detected time.Time
+
+	//Network is what the local network looked like when it was detected, from localNetwork
+	Network string
+
+	//Window is how long it is trusted for. It halves each time the source gives a new IP without the local network
+	//changing, as the IP is moving, and doubles back up to IPCache each time the IP is confirmed.
+	Window time.Duration
+}
+
+//detectIP gets the WAN IP from the source, using the IP detected by an earlier run while it is within its window and
+//the local network is unchanged. Without IPCache it is always detected.
+func (u *Updater) detectIP(ctx context.Context, spec string) (ip string, err error) {
+
+	if u.cfg.IPCache <= 0 {
+		return u.getWANIP(ctx, spec)
+	}
+
+	network := localNetwork()
+	cached, ok := u.ipCache[spec]
+	networkChanged := ok && cached.Network != network
+	switch {
+	case networkChanged:
+		u.logVerbose("The local network has changed - detecting the IP from %s again.", spec)
+	case ok && time.Since(cached.Detected) < cached.Window:
+		u.logVerbose("Using the IP from %s detected %v ago.", spec, time.Since(cached.Detected).Round(time.Second))
+		return cached.IP, nil
+	}
+
+	ip, err = u.getWANIP(ctx, spec)
+	if err != nil {
+		delete(u.ipCache, spec)
+		return
+	}
+
+	window := u.cfg.IPCache
+	switch {
+	case !ok || networkChanged:
+	case cached.IP != ip:
+		window = cached.Window / 2
+		u.logVerbose("The IP from %s has changed, trusting it for %v.", spec, window)
+	default:
+		window = min(cached.Window*2, u.cfg.IPCache)
+	}
+
+	if u.ipCache == nil {
+		u.ipCache = make(map[string]cachedIP)
+	}
+	u.ipCache[spec] = cachedIP{IP: ip, Detected: time.Now(), Network: network, Window: window}
+
+	return
+}
+
+//localNetwork describes the local network by the addresses of its interfaces, so joining another network, or the
+//router handing out new addresses, is noticed. It is empty if they can't be listed.
+func localNetwork() string {
+
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return ""
+	}
+
+	var list []string
+	for _, addr := range addrs {
+		list = append(list, addr.String())
+	}
+	sort.Strings(list)
+
+	return strings.Join(list, ",")
+}
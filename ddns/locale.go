@@ -0,0 +1,210 @@
+package ddns
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+//Ids of the notification texts, which can be translated with Config.Locale or replaced with Config.NotifyTemplates
+const (
+	msgHost           = "host"
+	msgSingle         = "single"
+	msgSummary        = "summary"
+	msgSummaryFailed  = "summary-failed"
+	msgSummaryChecked = "summary-checked"
+	msgMatches        = "result-matches"
+	msgDrift          = "result-drift"
+	msgUpdated        = "result-updated"
+	msgSkipped        = "result-skipped"
+	msgTunnel         = "result-tunnel"
+	msgStaged         = "result-staged"
+	msgFailed         = "result-failed"
+	msgLate           = "propagation-late"
+	msgRecovered      = "note-recovered"
+	msgReminder       = "note-reminder"
+	msgStale          = eventStale
+	msgStaleRecovered = eventRecovered
+	msgQuarantined    = eventQuarantined
+	msgReleased       = eventReleased
+)
+
+//defaultLocale is the language used unless Config.Locale is set
+const defaultLocale = "en"
+
+//messages are the notification texts for each locale, as text/template templates. The fields each one is given are:
+//
+//	host                            Host, OldIP, NewIP, Result, Note, Propagation and Labels, one line of a message
+//	single                          Lines, a message about one host
+//	summary, summary-failed         Count, Failed and Lines, a message listing hosts
+//	summary-checked                 Count, Failed and Lines, a message listing records checked by -verify-only
+//	result-*                        Error, the outcome of a host
+//	propagation-late                Duration, a record not served by the resolvers in time
+//	note-recovered                  Duration, a host that failed before
+//	note-reminder                   Since and Reminders, a host still failing
+//	stale, stale-recovered          Duration and Since, the records not being brought up to date
+//	source-quarantined              Source, Gave, Expected and Wait, an IP source that keeps disagreeing
+//	source-released                 Source, an IP source that agrees again
+var messages = map[string]map[string]string{
+	"en": {
+		msgHost:           `{{.Host}}: {{.OldIP}} -> {{.NewIP}} {{.Result}}{{with .Note}} ({{.}}){{end}}{{with .Propagation}}, propagation {{.}}{{end}}{{with .Labels}} [{{.}}]{{end}}`,
+		msgSingle:         `go-cloudflare-ddns: {{.Lines}}`,
+		msgSummary:        "go-cloudflare-ddns: {{.Count}} hosts changed\n{{.Lines}}",
+		msgSummaryFailed:  "go-cloudflare-ddns: {{.Count}} hosts changed, {{.Failed}} of them failed\n{{.Lines}}",
+		msgSummaryChecked: "go-cloudflare-ddns: {{.Count}} records checked, {{.Failed}} of them don't match the detected IP\n{{.Lines}}",
+		msgMatches:        `matches`,
+		msgDrift:          `drift: {{.Error}}`,
+		msgUpdated:        `updated`,
+		msgSkipped:        `skipped`,
+		msgTunnel:         `skipped: {{.Error}}`,
+		msgStaged:         `staged`,
+		msgFailed:         `failed: {{.Error}}`,
+		msgLate:           `not served after {{.Duration}}`,
+		msgRecovered:      `recovered after failing for {{.Duration}}`,
+		msgReminder:       `still failing since {{.Since.Format "Mon, 02 Jan 2006 15:04:05 MST"}}, reminder {{.Reminders}}`,
+		msgStale:          `go-cloudflare-ddns: DDNS stale, the records have not been brought up to date for {{.Duration}}, since {{.Since.Format "Mon, 02 Jan 2006 15:04:05 MST"}}`,
+		msgStaleRecovered: `go-cloudflare-ddns: DDNS no longer stale, the records are up to date again after {{.Duration}}`,
+		msgQuarantined:    `go-cloudflare-ddns: IP source {{.Source}} quarantined, it keeps disagreeing with the other sources and last gave {{.Gave}} rather than {{.Expected}}. It is asked again after {{.Wait}}.`,
+		msgReleased:       `go-cloudflare-ddns: IP source {{.Source}} released from quarantine, it agrees with the other sources again.`,
+	},
+	"de": {
+		msgHost:           `{{.Host}}: {{.OldIP}} -> {{.NewIP}} {{.Result}}{{with .Note}} ({{.}}){{end}}{{with .Propagation}}, Verbreitung {{.}}{{end}}{{with .Labels}} [{{.}}]{{end}}`,
+		msgSingle:         `go-cloudflare-ddns: {{.Lines}}`,
+		msgSummary:        "go-cloudflare-ddns: {{.Count}} Hosts geändert\n{{.Lines}}",
+		msgSummaryFailed:  "go-cloudflare-ddns: {{.Count}} Hosts geändert, davon {{.Failed}} fehlgeschlagen\n{{.Lines}}",
+		msgSummaryChecked: "go-cloudflare-ddns: {{.Count}} Einträge geprüft, davon stimmen {{.Failed}} nicht mit der erkannten IP überein\n{{.Lines}}",
+		msgMatches:        `stimmt überein`,
+		msgDrift:          `abweichend: {{.Error}}`,
+		msgUpdated:        `aktualisiert`,
+		msgSkipped:        `übersprungen`,
+		msgTunnel:         `übersprungen: {{.Error}}`,
+		msgStaged:         `vorgemerkt`,
+		msgFailed:         `fehlgeschlagen: {{.Error}}`,
+		msgLate:           `nach {{.Duration}} noch nicht ausgeliefert`,
+		msgRecovered:      `wieder in Ordnung, nachdem es {{.Duration}} lang fehlgeschlagen ist`,
+		msgReminder:       `schlägt seit {{.Since.Format "02.01.2006 15:04 MST"}} fehl, Erinnerung {{.Reminders}}`,
+		msgStale:          `go-cloudflare-ddns: DDNS veraltet, die Einträge wurden {{.Duration}} lang nicht aktualisiert, seit {{.Since.Format "02.01.2006 15:04 MST"}}`,
+		msgStaleRecovered: `go-cloudflare-ddns: DDNS nicht mehr veraltet, die Einträge sind nach {{.Duration}} wieder aktuell`,
+		msgQuarantined:    `go-cloudflare-ddns: IP-Quelle {{.Source}} in Quarantäne, sie widerspricht wiederholt den anderen Quellen und meldete zuletzt {{.Gave}} statt {{.Expected}}. Sie wird nach {{.Wait}} erneut abgefragt.`,
+		msgReleased:       `go-cloudflare-ddns: IP-Quelle {{.Source}} aus der Quarantäne entlassen, sie stimmt wieder mit den anderen Quellen überein.`,
+	},
+	"es": {
+		msgHost:           `{{.Host}}: {{.OldIP}} -> {{.NewIP}} {{.Result}}{{with .Note}} ({{.}}){{end}}{{with .Propagation}}, propagación {{.}}{{end}}{{with .Labels}} [{{.}}]{{end}}`,
+		msgSingle:         `go-cloudflare-ddns: {{.Lines}}`,
+		msgSummary:        "go-cloudflare-ddns: {{.Count}} hosts modificados\n{{.Lines}}",
+		msgSummaryFailed:  "go-cloudflare-ddns: {{.Count}} hosts modificados, {{.Failed}} de ellos con error\n{{.Lines}}",
+		msgSummaryChecked: "go-cloudflare-ddns: {{.Count}} registros comprobados, {{.Failed}} de ellos no coinciden con la IP detectada\n{{.Lines}}",
+		msgMatches:        `coincide`,
+		msgDrift:          `desviación: {{.Error}}`,
+		msgUpdated:        `actualizado`,
+		msgSkipped:        `omitido`,
+		msgTunnel:         `omitido: {{.Error}}`,
+		msgStaged:         `pendiente`,
+		msgFailed:         `error: {{.Error}}`,
+		msgLate:           `no servido tras {{.Duration}}`,
+		msgRecovered:      `recuperado tras fallar durante {{.Duration}}`,
+		msgReminder:       `fallando desde el {{.Since.Format "02/01/2006 15:04 MST"}}, recordatorio {{.Reminders}}`,
+		msgStale:          `go-cloudflare-ddns: DDNS desactualizado, los registros llevan {{.Duration}} sin actualizarse, desde el {{.Since.Format "02/01/2006 15:04 MST"}}`,
+		msgStaleRecovered: `go-cloudflare-ddns: DDNS al día de nuevo, los registros vuelven a estar actualizados tras {{.Duration}}`,
+		msgQuarantined:    `go-cloudflare-ddns: fuente de IP {{.Source}} en cuarentena, discrepa repetidamente de las otras fuentes y su última respuesta fue {{.Gave}} en lugar de {{.Expected}}. Se volverá a consultar tras {{.Wait}}.`,
+		msgReleased:       `go-cloudflare-ddns: fuente de IP {{.Source}} fuera de cuarentena, vuelve a coincidir con las otras fuentes.`,
+	},
+	"fr": {
+		msgHost:           `{{.Host}} : {{.OldIP}} -> {{.NewIP}} {{.Result}}{{with .Note}} ({{.}}){{end}}{{with .Propagation}}, propagation {{.}}{{end}}{{with .Labels}} [{{.}}]{{end}}`,
+		msgSingle:         `go-cloudflare-ddns : {{.Lines}}`,
+		msgSummary:        "go-cloudflare-ddns : {{.Count}} hôtes modifiés\n{{.Lines}}",
+		msgSummaryFailed:  "go-cloudflare-ddns : {{.Count}} hôtes modifiés, dont {{.Failed}} en échec\n{{.Lines}}",
+		msgSummaryChecked: "go-cloudflare-ddns : {{.Count}} enregistrements vérifiés, dont {{.Failed}} ne correspondent pas à l'IP détectée\n{{.Lines}}",
+		msgMatches:        `conforme`,
+		msgDrift:          `écart : {{.Error}}`,
+		msgUpdated:        `mis à jour`,
+		msgSkipped:        `ignoré`,
+		msgTunnel:         `ignoré : {{.Error}}`,
+		msgStaged:         `en attente`,
+		msgFailed:         `échec : {{.Error}}`,
+		msgLate:           `non servi après {{.Duration}}`,
+		msgRecovered:      `rétabli après {{.Duration}} d'échecs`,
+		msgReminder:       `en échec depuis le {{.Since.Format "02/01/2006 15:04 MST"}}, rappel {{.Reminders}}`,
+		msgStale:          `go-cloudflare-ddns : DDNS obsolète, les enregistrements n'ont pas été mis à jour depuis {{.Duration}}, soit depuis le {{.Since.Format "02/01/2006 15:04 MST"}}`,
+		msgStaleRecovered: `go-cloudflare-ddns : DDNS de nouveau à jour, les enregistrements sont à jour après {{.Duration}}`,
+		msgQuarantined:    `go-cloudflare-ddns : source d'IP {{.Source}} mise en quarantaine, elle contredit régulièrement les autres sources et a donné en dernier {{.Gave}} au lieu de {{.Expected}}. Elle sera de nouveau interrogée après {{.Wait}}.`,
+		msgReleased:       `go-cloudflare-ddns : source d'IP {{.Source}} sortie de quarantaine, elle concorde de nouveau avec les autres sources.`,
+	},
+}
+
+//Locales returns the locales notifications can be sent in
+func Locales() (locales []string) {
+	for locale := range messages {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+	return
+}
+
+//loadMessages parses the notification texts for the locale, with any replaced by the templates in the
+//Config.NotifyTemplates file, a JSON object of message ids and templates
+func (u *Updater) loadMessages() (err error) {
+
+	locale := strings.ToLower(strings.Replace(u.cfg.Locale, "_", "-", -1))
+	if locale == "" {
+		locale = defaultLocale
+	}
+	texts, ok := messages[locale]
+	if !ok {
+		//A regional locale, eg de-AT, uses its language
+		language, _, _ := strings.Cut(locale, "-")
+		if texts, ok = messages[language]; !ok {
+			return fmt.Errorf("Locale '%v' is not available (expected one of %v)", u.cfg.Locale, strings.Join(Locales(), ", "))
+		}
+	}
+
+	overrides := map[string]string{}
+	if u.cfg.NotifyTemplates != "" {
+		data, readErr := ioutil.ReadFile(u.cfg.NotifyTemplates)
+		if readErr != nil {
+			return fmt.Errorf("Error reading notify templates: %v", readErr)
+		}
+		if err = json.Unmarshal(data, &overrides); err != nil {
+			return fmt.Errorf("Error parsing notify templates %v: %v", u.cfg.NotifyTemplates, err)
+		}
+	}
+
+	u.templates = make(map[string]*template.Template)
+	for id, text := range texts {
+		if override, ok := overrides[id]; ok {
+			text = override
+		}
+		if u.templates[id], err = template.New(id).Option("missingkey=error").Parse(text); err != nil {
+			return fmt.Errorf("Notify template '%v' is invalid: %v", id, err)
+		}
+	}
+	for id := range overrides {
+		if _, ok := texts[id]; !ok {
+			return fmt.Errorf("Notify templates %v has an unknown message '%v'", u.cfg.NotifyTemplates, id)
+		}
+	}
+
+	return
+}
+
+//message renders the notification text id with data. If a replaced template fails, the English text is used instead,
+//so the notification is still sent.
+func (u *Updater) message(id string, data map[string]interface{}) string {
+
+	var text bytes.Buffer
+	if tmpl := u.templates[id]; tmpl != nil {
+		err := tmpl.Execute(&text, data)
+		if err == nil {
+			return text.String()
+		}
+		u.log.Printf("Error in notify template '%v': %v", id, err)
+	}
+
+	text.Reset()
+	template.Must(template.New(id).Parse(messages[defaultLocale][id])).Execute(&text, data)
+	return text.String()
+}
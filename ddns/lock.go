@@ -0,0 +1,147 @@
+package ddns
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//lockRecordMessage is the response when listing the lock record
+type lockRecordMessage struct {
+	Result []struct {
+		ID      string `json:"id"`
+		Content string `json:"content"`
+	} `json:"result"`
+}
+
+//lockRecordBody is the submission body when creating or updating the lock record
+type lockRecordBody struct {
+	Type    string `json:"type"`
+	Name    string `json:"name"`
+	Content string `json:"content"`
+	TTL     int    `json:"ttl"`
+	Comment string `json:"comment"`
+}
+
+//acquireLock takes or refreshes the lock held in the -lock-record TXT record.
+//The record holds the id of the instance allowed to update and the time it last checked in.
+//The lock is taken over if the holder's heartbeat is older than -lock-stale.
+//If instances created the record at the same moment there are several, and the one with the lowest id holds the
+//lock. Each instance deletes its own other records, and any left by instances that have gone stale.
+//Returns false if another instance holds the lock.
+func (u *Updater) acquireLock(zoneID string) (acquired bool, err error) {
+
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("Error in acquireLock(): %w", err)
+		}
+	}()
+
+	path := fmt.Sprintf("/zones/%s/dns_records?type=TXT&name=%s", zoneID, url.QueryEscape(u.cfg.LockRecord))
+
+	var msg lockRecordMessage
+	if err = u.cfAPI("GET", path, nil, &msg); err != nil {
+		return
+	}
+	now := time.Now()
+	if err = u.deleteExtraLocks(zoneID, &msg, now); err != nil {
+		return
+	}
+
+	body := lockRecordBody{
+		Type:    "TXT",
+		Name:    u.cfg.LockRecord,
+		Content: fmt.Sprintf("holder=%s heartbeat=%d", u.cfg.InstanceID, now.Unix()),
+		TTL:     60,
+		Comment: OwnerMarker,
+	}
+
+	if len(msg.Result) == 0 {
+		u.logVerbose("Creating lock record %v", u.cfg.LockRecord)
+		if err = u.cfAPI("POST", fmt.Sprintf("/zones/%s/dns_records", zoneID), body, nil); err != nil {
+			return
+		}
+	} else {
+		holder, heartbeat := parseLockContent(msg.Result[0].Content)
+		age := now.Sub(heartbeat)
+
+		if holder != u.cfg.InstanceID && age < u.cfg.LockStale {
+			u.log.Printf("Lock %v is held by %v (last heartbeat %v ago) - standing by.", u.cfg.LockRecord, holder, age.Round(time.Second))
+			return
+		}
+		if holder != u.cfg.InstanceID {
+			u.log.Printf("Lock %v held by %v is stale (last heartbeat %v ago) - taking over.", u.cfg.LockRecord, holder, age.Round(time.Second))
+		}
+
+		if err = u.cfAPI("PUT", fmt.Sprintf("/zones/%s/dns_records/%s", zoneID, msg.Result[0].ID), body, nil); err != nil {
+			return
+		}
+	}
+
+	//Read back in case another instance wrote at the same time
+	if err = u.cfAPI("GET", path, nil, &msg); err != nil {
+		return
+	}
+	if len(msg.Result) == 0 {
+		u.log.Printf("Lock record %v has gone - standing by.", u.cfg.LockRecord)
+		return
+	}
+	if err = u.deleteExtraLocks(zoneID, &msg, now); err != nil {
+		return
+	}
+	if holder, _ := parseLockContent(msg.Result[0].Content); holder != u.cfg.InstanceID {
+		u.log.Printf("Lock %v was taken by %v - standing by.", u.cfg.LockRecord, holder)
+		return
+	}
+
+	u.logVerbose("Holding lock %v as %v", u.cfg.LockRecord, u.cfg.InstanceID)
+	acquired = true
+	return
+}
+
+//deleteExtraLocks puts the lock records in order of id, so every instance agrees the first holds the lock, and
+//deletes the others held by this instance or by instances that have gone stale
+func (u *Updater) deleteExtraLocks(zoneID string, msg *lockRecordMessage, now time.Time) (err error) {
+
+	sort.Slice(msg.Result, func(i, j int) bool {
+		return msg.Result[i].ID < msg.Result[j].ID
+	})
+
+	for i := 1; i < len(msg.Result); i++ {
+		extra := msg.Result[i]
+		holder, heartbeat := parseLockContent(extra.Content)
+		if holder != u.cfg.InstanceID && now.Sub(heartbeat) < u.cfg.LockStale {
+			continue
+		}
+		u.logVerbose("Deleting extra lock record %v held by %v", extra.ID, holder)
+		if err = u.cfAPI("DELETE", fmt.Sprintf("/zones/%s/dns_records/%s", zoneID, extra.ID), nil, nil); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+//parseLockContent reads the holder and heartbeat from the lock record content
+func parseLockContent(content string) (holder string, heartbeat time.Time) {
+
+	for _, field := range strings.Fields(strings.Trim(content, `"`)) {
+		kv := strings.SplitN(field, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch kv[0] {
+		case "holder":
+			holder = kv[1]
+		case "heartbeat":
+			if secs, err := strconv.ParseInt(kv[1], 10, 64); err == nil {
+				heartbeat = time.Unix(secs, 0)
+			}
+		}
+	}
+
+	return
+}
@@ -0,0 +1,94 @@
+package ddns
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/jonegerton/go-cloudflare-ddns/fakecf"
+)
+
+func TestParseLockContent(t *testing.T) {
+
+	tests := []struct {
+		content       string
+		wantHolder    string
+		wantHeartbeat int64
+	}{
+		{"holder=a heartbeat=1700000000", "a", 1700000000},
+		{`"heartbeat=1700000000 holder=b"`, "b", 1700000000},
+		{"holder=c heartbeat=soon", "c", 0},
+		{"holder=d junk", "d", 0},
+		{"", "", 0},
+	}
+
+	for _, test := range tests {
+		holder, heartbeat := parseLockContent(test.content)
+		if holder != test.wantHolder {
+			t.Errorf("parseLockContent(%q) holder %q, want %q", test.content, holder, test.wantHolder)
+		}
+		if test.wantHeartbeat == 0 && !heartbeat.IsZero() || test.wantHeartbeat != 0 && heartbeat.Unix() != test.wantHeartbeat {
+			t.Errorf("parseLockContent(%q) heartbeat %v, want %v", test.content, heartbeat, test.wantHeartbeat)
+		}
+	}
+}
+
+func TestAcquireLock(t *testing.T) {
+
+	fresh := time.Now().Add(-time.Minute).Unix()
+	stale := time.Now().Add(-time.Hour).Unix()
+	lock := func(holder string, heartbeat int64) string {
+		return fmt.Sprintf("holder=%s heartbeat=%d", holder, heartbeat)
+	}
+
+	//Records are added in order, so the first has the lowest id
+	tests := []struct {
+		name        string
+		existing    []string
+		want        bool
+		wantHolders []string
+	}{
+		{"no lock", nil, true, []string{"me"}},
+		{"held by another", []string{lock("other", fresh)}, false, []string{"other"}},
+		{"held by another gone stale", []string{lock("other", stale)}, true, []string{"me"}},
+		{"held by this instance", []string{lock("me", stale)}, true, []string{"me"}},
+		{"tie lost", []string{lock("other", fresh), lock("me", fresh)}, false, []string{"other"}},
+		{"tie won", []string{lock("me", fresh), lock("other", fresh)}, true, []string{"me", "other"}},
+		{"tie with stale records", []string{lock("old", stale), lock("other", fresh), lock("older", stale)}, true, []string{"me", "other"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			fake := fakecf.New("203.0.113.10")
+			zoneID := fake.AddZone("example.com")
+			for _, content := range test.existing {
+				fake.AddRecord(zoneID, fakecf.Record{Type: "TXT", Name: "_lock.example.com", Content: content, Comment: OwnerMarker})
+			}
+
+			cfg := DefaultConfig()
+			cfg.LockRecord = "_lock.example.com"
+			cfg.InstanceID = "me"
+			u := testUpdater(t, fake, cfg, WithHosts("home"))
+
+			acquired, err := u.acquireLock(zoneID)
+			if err != nil {
+				t.Fatalf("acquireLock returned %v", err)
+			}
+			if acquired != test.want {
+				t.Errorf("acquired %v, want %v", acquired, test.want)
+			}
+
+			var holders []string
+			for _, record := range fake.Records(zoneID) {
+				holder, _ := parseLockContent(record.Content)
+				holders = append(holders, holder)
+			}
+			sort.Strings(holders)
+			if fmt.Sprint(holders) != fmt.Sprint(test.wantHolders) {
+				t.Errorf("lock records held by %v, want %v", holders, test.wantHolders)
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package ddns
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+)
+
+//applyLowMemory keeps the footprint down for -low-memory, for routers with 64-128 MB of RAM shared with everything else.
+//The garbage collector's settings are for the whole process, so are left to the program using the Updater.
+func (u *Updater) applyLowMemory() {
+
+	//Idle keep-alive connections hold buffers and TLS state between runs
+	u.transport.DisableKeepAlives = true
+
+	u.logVerbose("Low memory mode: connections are closed after each request")
+}
+
+//decodeResponse parses a JSON response body into msg. In -low-memory mode it is decoded as it is read
+//rather than read into a buffer first.
+func (u *Updater) decodeResponse(body io.Reader, msg interface{}) error {
+
+	if u.cfg.LowMemory {
+		return json.NewDecoder(body).Decode(msg)
+	}
+
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, msg)
+}
+
+//listPageSize is how many records to ask for per page when listing. Smaller pages mean smaller responses in -low-memory mode.
+func (u *Updater) listPageSize() int {
+	if u.cfg.LowMemory {
+		return 20
+	}
+	return 100
+}
@@ -0,0 +1,107 @@
+package ddns
+
+import (
+	"fmt"
+	"net/netip"
+	"net/url"
+)
+
+//listedRecord is a record from the list endpoint
+type listedRecord struct {
+	ID      string   `json:"id"`
+	Type    string   `json:"type"`
+	Name    string   `json:"name"`
+	Content string   `json:"content"`
+	Comment string   `json:"comment"`
+	Tags    []string `json:"tags"`
+}
+
+//recordListMessage is a page of records from the list endpoint
+type recordListMessage struct {
+	Result     []listedRecord `json:"result"`
+	ResultInfo struct {
+		Page       int `json:"page"`
+		TotalPages int `json:"total_pages"`
+	} `json:"result_info"`
+}
+
+//findMatchingRecords returns entries for every A record in the zone holding oldIP that isn't already in hosts, or every
+//AAAA record for an IPv6 oldIP. None are returned if newIP is of the other family, as the records couldn't hold it.
+//Used by -update-all-matching so records added in the dashboard follow the IP without being configured. As for
+//configured hosts, records not marked as managed by the tool are left alone unless -take-ownership is set.
+func (u *Updater) findMatchingRecords(saveData *saveDataDocument, hosts []Host, oldIP string, newIP string) (matched []Host, err error) {
+
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("Error in findMatchingRecords(): %v", err)
+		}
+	}()
+
+	old, err := netip.ParseAddr(oldIP)
+	if err != nil {
+		return
+	}
+	recordType := addrRecordType(old)
+	if addr, parseErr := netip.ParseAddr(newIP); parseErr == nil && addr.Is6() != old.Is6() {
+		u.log.Printf("The IP changed from %v to %v, another address family - not updating other %v records holding the previous IP.", oldIP, newIP, recordType)
+		return
+	}
+
+	if err = u.resolveZoneID(saveData); err != nil {
+		return
+	}
+
+	records, err := u.recordsHolding(saveData.ZoneID, recordType, oldIP)
+	if err != nil {
+		return
+	}
+
+	configured := make(map[string]bool)
+	for _, host := range hosts {
+		configured[host.key()] = true
+	}
+
+	for _, record := range records {
+		host := NewHost(record.Name)
+		host.Type = recordType
+		host.Matched = true
+		if configured[host.key()] {
+			continue
+		}
+		if !isOwned(hostData{Comment: record.Comment}) && !u.cfg.TakeOwnership {
+			u.log.Printf("Record %v holds the previous IP %v but is not marked as %v - not updating it. "+
+				"If it should follow the IP, run once with -take-ownership to adopt it.", host, oldIP, OwnerMarker)
+			continue
+		}
+		u.log.Printf("Record %v holds the previous IP %v - it will be updated too.", host, oldIP)
+		matched = append(matched, host)
+	}
+
+	return
+}
+
+//recordsHolding returns every record of recordType in the zone holding ip
+func (u *Updater) recordsHolding(zoneID string, recordType string, ip string) (records []listedRecord, err error) {
+
+	for page := 1; ; page++ {
+		path := fmt.Sprintf("/zones/%s/dns_records?type=%s&content=%s&per_page=%d&page=%d", zoneID, recordType, url.QueryEscape(ip), u.listPageSize(), page)
+
+		var msg recordListMessage
+		if err = u.cfAPI("GET", path, nil, &msg); err != nil {
+			return
+		}
+		records = append(records, msg.Result...)
+
+		if page >= msg.ResultInfo.TotalPages {
+			return
+		}
+	}
+}
+
+//addrRecordType returns the address record type holding addr, A or AAAA
+func addrRecordType(addr netip.Addr) string {
+	if addr.Is6() && !addr.Is4In6() {
+		return "AAAA"
+	}
+	return "A"
+}
@@ -0,0 +1,95 @@
+package ddns
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jonegerton/go-cloudflare-ddns/fakecf"
+)
+
+func TestMatchedRecordsOwnership(t *testing.T) {
+
+	tests := []struct {
+		name          string
+		comment       string
+		takeOwnership bool
+		wantUpdated   bool
+	}{
+		{"not marked", "added in the dashboard", false, false},
+		{"marked", OwnerMarker, false, true},
+		{"adopted with -take-ownership", "added in the dashboard", true, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			fake := fakecf.New("192.0.2.1")
+			zoneID := fake.AddZone("example.com")
+			fake.AddRecord(zoneID, fakecf.Record{Type: "A", Name: "home.example.com", Content: "192.0.2.1", Comment: OwnerMarker})
+			fake.AddRecord(zoneID, fakecf.Record{Type: "A", Name: "other.example.com", Content: "192.0.2.1", Comment: test.comment})
+
+			cfg := DefaultConfig()
+			cfg.UpdateAllMatching = true
+			cfg.TakeOwnership = test.takeOwnership
+			u := testUpdater(t, fake, cfg, WithHosts("home"))
+
+			//The first run saves the IP, and the second finds the records still holding it once it changes
+			if err := u.RunOnce(context.Background()); err != nil {
+				t.Fatalf("First run returned %v", err)
+			}
+			fake.SetIP("203.0.113.10")
+			if err := u.RunOnce(context.Background()); err != nil {
+				t.Fatalf("Second run returned %v", err)
+			}
+
+			if got := recordContent(fake, zoneID, "home.example.com"); got != "203.0.113.10" {
+				t.Errorf("Configured host holds %v, expected the new IP", got)
+			}
+			want := "192.0.2.1"
+			if test.wantUpdated {
+				want = "203.0.113.10"
+			}
+			if got := recordContent(fake, zoneID, "other.example.com"); got != want {
+				t.Errorf("Matched record holds %v, expected %v", got, want)
+			}
+
+			//prune deletes the records marked as managed, which must not include one that only held the same IP
+			owned, err := u.OwnedRecords()
+			if err != nil {
+				t.Fatalf("OwnedRecords returned %v", err)
+			}
+			pruned := false
+			for _, record := range owned {
+				pruned = pruned || record.Name == "other.example.com"
+			}
+			if pruned != test.wantUpdated {
+				t.Errorf("prune would delete the matched record: %v, expected %v", pruned, test.wantUpdated)
+			}
+		})
+	}
+}
+
+func TestUnownedRecordsIncludesMatched(t *testing.T) {
+
+	fake := fakecf.New("192.0.2.1")
+	zoneID := fake.AddZone("example.com")
+	fake.AddRecord(zoneID, fakecf.Record{Type: "A", Name: "home.example.com", Content: "192.0.2.1", Comment: OwnerMarker})
+	fake.AddRecord(zoneID, fakecf.Record{Type: "A", Name: "other.example.com", Content: "192.0.2.1"})
+	fake.AddRecord(zoneID, fakecf.Record{Type: "A", Name: "elsewhere.example.com", Content: "198.51.100.1"})
+
+	cfg := DefaultConfig()
+	cfg.UpdateAllMatching = true
+	u := testUpdater(t, fake, cfg, WithHosts("home"))
+	if err := u.RunOnce(context.Background()); err != nil {
+		t.Fatalf("Run returned %v", err)
+	}
+
+	//-take-ownership lists the records it would adopt, including those holding the saved IP
+	records, err := u.UnownedRecords()
+	if err != nil {
+		t.Fatalf("UnownedRecords returned %v", err)
+	}
+	if len(records) != 1 || records[0].Name != "other.example.com" {
+		t.Errorf("UnownedRecords returned %v, expected other.example.com", records)
+	}
+}
@@ -0,0 +1,28 @@
+package ddns
+
+import (
+	"fmt"
+	"strings"
+)
+
+//checkMaxChanges stops a run that would change more records than MaxChanges, before anything is sent, unless
+//OverrideMaxChanges is set. It guards against a selection that is wider than meant, such as -update-all-matching
+//finding every record in the zone holding a shared IP, rewriting the whole zone.
+func (u *Updater) checkMaxChanges(changed []Host) error {
+
+	if u.cfg.MaxChanges == 0 || len(changed) <= u.cfg.MaxChanges {
+		return nil
+	}
+	if u.cfg.OverrideMaxChanges {
+		u.log.Printf("Changing %d records, more than -max-changes of %d, as confirmed with -override-max-changes.", len(changed), u.cfg.MaxChanges)
+		return nil
+	}
+
+	names := make([]string, 0, len(changed))
+	for _, host := range changed {
+		names = append(names, host.String())
+	}
+
+	return fmt.Errorf("This run would change %d records, more than -max-changes of %d, so nothing was changed. "+
+		"Check these are the records meant, then run with -override-max-changes, or raise -max-changes:\n  - %v", len(changed), u.cfg.MaxChanges, strings.Join(names, "\n  - "))
+}
@@ -0,0 +1,223 @@
+package ddns
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+//NotifyChannel is a webhook to send update notifications to, parsed from a -notify value of the form:
+//url[,mode=digest|immediate]
+//Digest channels get one message per run listing every host, immediate channels one message per host.
+type NotifyChannel struct {
+	URL    string
+	Digest bool
+}
+
+//notificationMessage is the JSON posted to a channel. Text is enough for Slack style incoming webhooks,
+//Results is there for anything that wants the detail. Event is set for messages that aren't about updates, eg stale.
+type notificationMessage struct {
+	Text    string               `json:"text"`
+	Run     string               `json:"run"`
+	Event   string               `json:"event,omitempty"`
+	Failed  int                  `json:"failed"`
+	Results []notificationResult `json:"results"`
+}
+
+//notificationResult is the outcome of one host in a notification
+type notificationResult struct {
+	Host   string `json:"host"`
+	Type   string `json:"type"`
+	OldIP  string `json:"oldIP,omitempty"`
+	NewIP  string `json:"newIP"`
+	Result string `json:"result"`
+	Error  string `json:"error,omitempty"`
+	Note   string `json:"note,omitempty"`
+
+	Propagation string `json:"propagation,omitempty"`
+
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+//ParseNotifyChannels parses the -notify values
+func ParseNotifyChannels(values []string) (channels []NotifyChannel, err error) {
+
+	for _, value := range values {
+		parts := strings.Split(value, ",")
+		channel := NotifyChannel{URL: strings.TrimSpace(parts[0]), Digest: true}
+
+		if !strings.HasPrefix(channel.URL, "http://") && !strings.HasPrefix(channel.URL, "https://") {
+			err = fmt.Errorf("Notify channel '%v' must be an http(s) URL", value)
+			return
+		}
+
+		for _, part := range parts[1:] {
+			kv := strings.SplitN(part, "=", 2)
+			if len(kv) != 2 || strings.TrimSpace(kv[0]) != "mode" {
+				err = fmt.Errorf("Notify channel '%v' has an unknown option '%v'", value, part)
+				return
+			}
+			switch strings.TrimSpace(kv[1]) {
+			case "digest":
+				channel.Digest = true
+			case "immediate":
+				channel.Digest = false
+			default:
+				err = fmt.Errorf("Notify channel '%v' has an invalid mode '%v' (expected digest or immediate)", value, kv[1])
+				return
+			}
+		}
+
+		channels = append(channels, channel)
+	}
+
+	return
+}
+
+//notifyImmediate sends a host's result to the channels that want each update as it happens
+func (u *Updater) notifyImmediate(r hostResult) {
+	if !r.Notify {
+		return
+	}
+	for _, channel := range u.cfg.Notify {
+		if !channel.Digest {
+			u.sendNotification(channel, []hostResult{r})
+		}
+	}
+}
+
+//notifyDigest sends the run's results as a single message to the digest channels,
+//leaving out failures already notified in earlier runs
+func (u *Updater) notifyDigest(all []hostResult) {
+	var results []hostResult
+	for _, r := range all {
+		if r.Notify {
+			results = append(results, r)
+		}
+	}
+	if len(results) == 0 {
+		return
+	}
+	for _, channel := range u.cfg.Notify {
+		if channel.Digest {
+			u.sendNotification(channel, results)
+		}
+	}
+}
+
+//resultText describes the outcome of a host for a notification, as hostResult.result does in the locale
+func (u *Updater) resultText(r hostResult) string {
+	data := map[string]interface{}{"Error": errorText(r.Err)}
+	switch {
+	case r.Checked && r.Err == nil:
+		return u.message(msgMatches, data)
+	case r.Checked:
+		return u.message(msgDrift, data)
+	case r.Err == nil:
+		return u.message(msgUpdated, data)
+	case errors.Is(r.Err, errSkipped):
+		return u.message(msgSkipped, data)
+	case errors.Is(r.Err, errTunnel):
+		return u.message(msgTunnel, data)
+	case errors.Is(r.Err, errStaged):
+		return u.message(msgStaged, data)
+	}
+	return u.message(msgFailed, data)
+}
+
+//propagationText describes how long the host's record took to reach the resolvers for a notification, in the locale
+func (u *Updater) propagationText(r hostResult) string {
+	if r.Propagation != 0 && !r.Propagated {
+		return u.message(msgLate, map[string]interface{}{"Duration": r.Propagation.Round(time.Second)})
+	}
+	return r.propagationText()
+}
+
+//errorText returns err's message, or nothing if there is no error
+func errorText(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+//sendNotification posts results to the channel. Failures are logged rather than failing the run,
+//as the records have already been updated by this point.
+func (u *Updater) sendNotification(channel NotifyChannel, results []hostResult) {
+
+	msg := notificationMessage{Run: u.runID, Failed: countFailed(results)}
+
+	var lines []string
+	for _, r := range results {
+		msg.Results = append(msg.Results, notificationResult{
+			Host:   r.Host.Name,
+			Type:   r.Host.Type,
+			OldIP:  r.OldIP,
+			NewIP:  r.NewIP,
+			Result: r.result(),
+			Error:  errorText(r.Err),
+			Note:   r.Note,
+
+			Propagation: r.propagationText(),
+
+			Labels: r.Host.Labels,
+		})
+		lines = append(lines, u.message(msgHost, map[string]interface{}{
+			"Host":        r.Host.String(),
+			"OldIP":       r.OldIP,
+			"NewIP":       r.NewIP,
+			"Result":      u.resultText(r),
+			"Note":        r.Note,
+			"Propagation": u.propagationText(r),
+			"Labels":      strings.Join(r.Host.labelPairs(), " "),
+		}))
+	}
+
+	summary := map[string]interface{}{"Count": len(results), "Failed": msg.Failed, "Lines": strings.Join(lines, "\n")}
+	switch {
+	case len(results) == 1:
+		msg.Text = u.message(msgSingle, summary)
+	case results[0].Checked:
+		msg.Text = u.message(msgSummaryChecked, summary)
+	case msg.Failed > 0:
+		msg.Text = u.message(msgSummaryFailed, summary)
+	default:
+		msg.Text = u.message(msgSummary, summary)
+	}
+
+	u.postNotification(channel, msg)
+}
+
+//postNotification posts msg to the channel, logging any failure
+func (u *Updater) postNotification(channel NotifyChannel, msg notificationMessage) {
+
+	body, _ := json.Marshal(msg)
+
+	client := &http.Client{
+		Timeout:   time.Second * 10,
+		Transport: u.transport,
+	}
+
+	//Webhook URLs are secrets in themselves, and the log is kept for support bundles, so only the host is logged
+	resp, err := client.Post(channel.URL, "application/json", bytes.NewBuffer(body))
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			urlErr.URL = redactWebhook(urlErr.URL)
+		}
+		u.log.Printf("Error sending notification: %v", err)
+		return
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		u.log.Printf("Error sending notification: %v returned status %d", redactWebhook(channel.URL), resp.StatusCode)
+		return
+	}
+	u.logVerbose("Notification sent to %v", redactWebhook(channel.URL))
+}
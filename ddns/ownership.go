@@ -0,0 +1,145 @@
+package ddns
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+//OwnerMarker is added to the comment of every record the tool updates, and marks the records it may change
+const OwnerMarker = "managed by go-cloudflare-ddns"
+
+//isOwned reports whether the record carries the ownership marker
+func isOwned(hostData hostData) bool {
+	return strings.Contains(hostData.Comment, OwnerMarker)
+}
+
+//checkOwnership refuses to update records that the tool hasn't created or adopted,
+//unless -take-ownership is set
+func (u *Updater) checkOwnership(hostData hostData, host Host) error {
+
+	if isOwned(hostData) {
+		return nil
+	}
+
+	if !u.cfg.TakeOwnership {
+		return fmt.Errorf("Record %v is not marked as %v in its comment - not updating it. "+
+			"If this is the right record, run once with -take-ownership to adopt it", host, OwnerMarker)
+	}
+
+	u.log.Printf("Taking ownership of record %v", host)
+	return nil
+}
+
+//UnownedRecords returns the records of the host entries that aren't marked as managed by the tool, which -take-ownership
+//would adopt and update, along with those -update-all-matching would find holding the saved IP. Records that don't
+//exist yet and records managed by infrastructure as code aren't included.
+func (u *Updater) UnownedRecords() (records []Record, err error) {
+
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("Error in UnownedRecords(): %v", err)
+		}
+	}()
+
+	if err = u.checkCredentials(); err != nil {
+		return
+	}
+
+	saveData, err := u.getSaveData()
+	if err != nil {
+		return
+	}
+	if err = u.resolveZoneID(&saveData); err != nil {
+		return
+	}
+
+	for _, host := range u.hosts {
+		hostData, getErr := u.getHostData(saveData.ZoneID, host)
+		if errors.Is(getErr, errRecordNotFound) {
+			continue
+		}
+		if getErr != nil {
+			return nil, getErr
+		}
+		if isOwned(hostData) || (u.iacManager(hostData.Comment, hostData.Tags) != "" && !u.cfg.OverrideIaC) {
+			continue
+		}
+		records = append(records, Record{ID: hostData.ID, Type: host.Type, Name: host.Name, Content: hostData.Content})
+	}
+
+	saved, parseErr := netip.ParseAddr(saveData.IP)
+	if !u.cfg.UpdateAllMatching || parseErr != nil {
+		return
+	}
+
+	configured := make(map[string]bool)
+	for _, host := range u.hosts {
+		configured[host.key()] = true
+	}
+
+	holding, err := u.recordsHolding(saveData.ZoneID, addrRecordType(saved), saveData.IP)
+	if err != nil {
+		return
+	}
+	for _, record := range holding {
+		host := NewHost(record.Name)
+		host.Type = record.Type
+		if configured[host.key()] || isOwned(hostData{Comment: record.Comment}) ||
+			(u.iacManager(record.Comment, record.Tags) != "" && !u.cfg.OverrideIaC) {
+			continue
+		}
+		records = append(records, Record{ID: record.ID, Type: record.Type, Name: record.Name, Content: record.Content})
+	}
+
+	return
+}
+
+//iacManager returns the infrastructure as code tool the record's comment or tags say manages it, if any
+func (u *Updater) iacManager(comment string, tags []string) string {
+
+	for _, marker := range u.cfg.IaCMarkers {
+		marker = strings.ToLower(marker)
+		if strings.Contains(strings.ToLower(comment), marker) {
+			return marker
+		}
+		for _, tag := range tags {
+			if strings.Contains(strings.ToLower(tag), marker) {
+				return marker
+			}
+		}
+	}
+
+	return ""
+}
+
+//checkIaC refuses to update records managed by Terraform or similar, as each run of the tool would undo the other,
+//unless -override-iac is set
+func (u *Updater) checkIaC(hostData hostData, host Host) error {
+
+	manager := u.iacManager(hostData.Comment, hostData.Tags)
+	if manager == "" {
+		return nil
+	}
+
+	if !u.cfg.OverrideIaC {
+		return fmt.Errorf("Record %v looks to be managed by %v (from its comment or tags) - not updating it. "+
+			"Change it there instead, or set -override-iac to update it anyway", host, manager)
+	}
+
+	u.log.Printf("Updating record %v although it looks to be managed by %v", host, manager)
+	return nil
+}
+
+//ownedComment returns the record comment with the ownership marker added
+func ownedComment(comment string) string {
+
+	if strings.Contains(comment, OwnerMarker) {
+		return comment
+	}
+	if strings.TrimSpace(comment) == "" {
+		return OwnerMarker
+	}
+	return comment + "; " + OwnerMarker
+}
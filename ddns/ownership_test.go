@@ -0,0 +1,109 @@
+package ddns
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/jonegerton/go-cloudflare-ddns/fakecf"
+)
+
+func TestOwnedComment(t *testing.T) {
+
+	tests := []struct {
+		comment string
+		want    string
+	}{
+		{"", OwnerMarker},
+		{"  ", OwnerMarker},
+		{"home router", "home router; " + OwnerMarker},
+		{OwnerMarker, OwnerMarker},
+		{"home router; " + OwnerMarker, "home router; " + OwnerMarker},
+	}
+
+	for _, test := range tests {
+		if got := ownedComment(test.comment); got != test.want {
+			t.Errorf("ownedComment(%q) = %q, want %q", test.comment, got, test.want)
+		}
+	}
+}
+
+func TestIaCManager(t *testing.T) {
+
+	u := &Updater{cfg: DefaultConfig()}
+
+	tests := []struct {
+		comment string
+		tags    []string
+		want    string
+	}{
+		{"", nil, ""},
+		{"Managed by Terraform", nil, "terraform"},
+		{"", []string{"env:prod", "tool:pulumi"}, "pulumi"},
+		{OwnerMarker, []string{"env:prod"}, ""},
+	}
+
+	for _, test := range tests {
+		if got := u.iacManager(test.comment, test.tags); got != test.want {
+			t.Errorf("iacManager(%q, %v) = %q, want %q", test.comment, test.tags, got, test.want)
+		}
+	}
+}
+
+func TestRecordOwnership(t *testing.T) {
+
+	tests := []struct {
+		name          string
+		comment       string
+		tags          []string
+		takeOwnership bool
+		overrideIaC   bool
+		wantUpdated   bool
+		wantUnowned   bool
+	}{
+		{name: "marked", comment: OwnerMarker, wantUpdated: true},
+		{name: "not marked", comment: "added by hand", wantUnowned: true},
+		{name: "adopted", comment: "added by hand", takeOwnership: true, wantUpdated: true, wantUnowned: true},
+		{name: "managed by terraform", comment: OwnerMarker, tags: []string{"terraform"}},
+		{name: "terraform overridden", comment: OwnerMarker, tags: []string{"terraform"}, overrideIaC: true, wantUpdated: true},
+		{name: "unowned terraform", comment: "terraform", takeOwnership: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			fake := fakecf.New("203.0.113.10")
+			zoneID := fake.AddZone("example.com")
+			fake.AddRecord(zoneID, fakecf.Record{Type: "A", Name: "home.example.com", Content: "192.0.2.1", Comment: test.comment, Tags: test.tags})
+
+			cfg := DefaultConfig()
+			cfg.TakeOwnership = test.takeOwnership
+			cfg.OverrideIaC = test.overrideIaC
+			u := testUpdater(t, fake, cfg, WithHosts("home"))
+
+			unowned, err := u.UnownedRecords()
+			if err != nil {
+				t.Fatalf("UnownedRecords returned %v", err)
+			}
+			if (len(unowned) == 1) != test.wantUnowned {
+				t.Errorf("UnownedRecords returned %v, want the record listed %v", unowned, test.wantUnowned)
+			}
+
+			runErr := u.RunOnce(context.Background())
+			if test.wantUpdated && runErr != nil {
+				t.Fatalf("Run returned %v", runErr)
+			}
+			if !test.wantUpdated && runErr == nil {
+				t.Error("Run didn't fail for a record it may not change")
+			}
+
+			records := fake.Records(zoneID)
+			if updated := records[0].Content == "203.0.113.10"; updated != test.wantUpdated {
+				t.Errorf("Record holds %v, want updated %v", records[0].Content, test.wantUpdated)
+			}
+			if test.wantUpdated && !strings.Contains(records[0].Comment, OwnerMarker) {
+				t.Errorf("Updated record's comment %q isn't marked", records[0].Comment)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package ddns
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+//protectedPayloadFields are the fields of a record payload the utility relies on, so they can't be changed by
+//Config.PayloadPatch or the MutatePayload hook
+var protectedPayloadFields = []string{"type", "name", "content", "data", "comment"}
+
+//parsePayloadPatch parses Config.PayloadPatch, a JSON merge patch for the record payload
+func parsePayloadPatch(text string) (patch map[string]interface{}, err error) {
+
+	if text == "" {
+		return
+	}
+	if err = json.Unmarshal([]byte(text), &patch); err != nil || patch == nil {
+		return nil, fmt.Errorf("Payload patch must be a JSON object, eg {\"proxied\": true}: %v", text)
+	}
+	for _, field := range protectedPayloadFields {
+		if _, ok := patch[field]; ok {
+			return nil, fmt.Errorf("Payload patch can't change the record's %v, as the utility sets it", field)
+		}
+	}
+
+	return
+}
+
+//mergePatch applies a JSON merge patch (RFC 7396) to target: members set to null are removed, objects are merged
+//and anything else replaces what was there
+func mergePatch(target map[string]interface{}, patch map[string]interface{}) {
+	for key, value := range patch {
+		if value == nil {
+			delete(target, key)
+			continue
+		}
+		if patchObject, ok := value.(map[string]interface{}); ok {
+			targetObject, ok := target[key].(map[string]interface{})
+			if !ok {
+				targetObject = make(map[string]interface{})
+			}
+			mergePatch(targetObject, patchObject)
+			target[key] = targetObject
+			continue
+		}
+		target[key] = value
+	}
+}
+
+//recordPayload returns what is sent to Cloudflare to create or update host's record, body with Config.PayloadPatch and
+//then the MutatePayload hook applied. Without either, body is sent as it is.
+func (u *Updater) recordPayload(host Host, body updateRequestBody) (payload interface{}, err error) {
+
+	if u.payloadPatch == nil && u.hooks.MutatePayload == nil {
+		return body, nil
+	}
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		return
+	}
+	var fields map[string]interface{}
+	if err = json.Unmarshal(data, &fields); err != nil {
+		return
+	}
+	protected := make(map[string]interface{})
+	for _, field := range protectedPayloadFields {
+		protected[field] = fields[field]
+	}
+
+	mergePatch(fields, u.payloadPatch)
+	if u.hooks.MutatePayload != nil {
+		if err = u.hooks.MutatePayload(host, fields); err != nil {
+			return nil, fmt.Errorf("Payload hook failed for %v: %v", host, err)
+		}
+	}
+
+	for field, value := range protected {
+		if !reflect.DeepEqual(fields[field], value) {
+			return nil, fmt.Errorf("Payload hook changed the %v of %v, which the utility sets", field, host)
+		}
+	}
+	if data, err = json.Marshal(fields); err != nil {
+		return
+	}
+	u.logVerbose("Payload for %v: %s", host, data)
+
+	return fields, nil
+}
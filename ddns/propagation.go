@@ -0,0 +1,140 @@
+package ddns
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+)
+
+//propagationPoll is how often each resolver is asked again while waiting for a new IP to propagate
+const propagationPoll = time.Second * 5
+
+//propagationCheckable reports whether the result is worth checking: a successful update of an address record that isn't proxied.
+//Resolvers answer proxied records with Cloudflare's addresses, so they never serve the new IP.
+func propagationCheckable(r hostResult) bool {
+	return r.Err == nil && !r.Proxied && (r.Host.Type == "A" || r.Host.Type == "AAAA")
+}
+
+//checkPropagation polls the -propagation-resolvers after the updates until each serves the new IP of every updated host,
+//or -propagation-timeout passes. How long each host took is set on its result and counted in the statistics.
+func (u *Updater) checkPropagation(ctx context.Context, saveData *saveDataDocument, results []hostResult) {
+
+	if u.cfg.PropagationTimeout <= 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, u.cfg.PropagationTimeout)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for i := range results {
+		if !propagationCheckable(results[i]) {
+			continue
+		}
+		wg.Add(1)
+		go func(r *hostResult) {
+			defer wg.Done()
+			r.Propagation, r.Propagated = u.waitForPropagation(ctx, r.Host, r.NewIP)
+		}(&results[i])
+	}
+	wg.Wait()
+
+	for _, r := range results {
+		switch {
+		case r.Propagation == 0:
+		case r.Propagated:
+			u.log.Printf("%v is served by %v after %v", r.Host, strings.Join(u.cfg.PropagationResolvers, ", "), r.Propagation.Round(time.Second))
+			u.countPropagation(saveData, r)
+		default:
+			u.log.Printf("%v was not served by all of %v within %v", r.Host, strings.Join(u.cfg.PropagationResolvers, ", "), u.cfg.PropagationTimeout)
+			u.countPropagation(saveData, r)
+		}
+	}
+}
+
+//waitForPropagation asks every resolver for host until they all answer with ip, returning how long that took
+//from the update. If ctx ends first the time waited is returned with propagated false.
+func (u *Updater) waitForPropagation(ctx context.Context, host Host, ip string) (took time.Duration, propagated bool) {
+
+	started := time.Now()
+	pending := append([]string(nil), u.cfg.PropagationResolvers...)
+
+	for {
+		var still []string
+		for _, resolver := range pending {
+			if !resolverServes(ctx, resolver, host, ip) {
+				still = append(still, resolver)
+			}
+		}
+		if pending = still; len(pending) == 0 {
+			return max(time.Since(started), time.Millisecond), true
+		}
+		u.logVerbose("Waiting for %v to serve %v for %v", strings.Join(pending, ", "), ip, host)
+
+		select {
+		case <-time.After(propagationPoll):
+		case <-ctx.Done():
+			return time.Since(started), false
+		}
+	}
+}
+
+//resolverServes reports whether the resolver answers a query for host with ip
+func resolverServes(ctx context.Context, resolver string, host Host, ip string) bool {
+
+	r := &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			d := net.Dialer{Timeout: time.Second * 5}
+			return d.DialContext(ctx, "udp", net.JoinHostPort(resolver, "53"))
+		},
+	}
+
+	network := "ip4"
+	if host.Type == "AAAA" {
+		network = "ip6"
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+
+	addrs, err := r.LookupNetIP(ctx, network, host.Name)
+	if err != nil {
+		return false
+	}
+	want, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	for _, addr := range addrs {
+		if addr.Unmap() == want {
+			return true
+		}
+	}
+	return false
+}
+
+//propagationText describes the result of the propagation check for reports and notifications, empty if it wasn't checked
+func (r hostResult) propagationText() string {
+	switch {
+	case r.Propagation == 0:
+		return ""
+	case r.Propagated:
+		return r.Propagation.Round(time.Second).String()
+	}
+	return fmt.Sprintf("not served after %v", r.Propagation.Round(time.Second))
+}
+
+//validPropagationResolvers checks the -propagation-resolvers are IP addresses
+func validPropagationResolvers(resolvers []string) error {
+	for _, resolver := range resolvers {
+		if _, err := netip.ParseAddr(resolver); err != nil {
+			return fmt.Errorf("Propagation resolver '%v' is not an IP address", resolver)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package ddns
+
+import (
+	"fmt"
+	"net/url"
+)
+
+//Record is a DNS record in the zone
+type Record struct {
+	ID      string
+	Type    string
+	Name    string
+	Content string
+}
+
+//String describes the record for listing
+func (r Record) String() string {
+	return fmt.Sprintf("%-6s %s %s", r.Type, toUnicode(r.Name), r.Content)
+}
+
+//OwnedRecords returns the records in the zone marked as managed by the tool, whether or not they are in the host list
+func (u *Updater) OwnedRecords() (records []Record, err error) {
+
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("Error in OwnedRecords(): %v", err)
+		}
+	}()
+
+	if err = u.checkCredentials(); err != nil {
+		return
+	}
+
+	saveData, err := u.getSaveData()
+	if err != nil {
+		return
+	}
+	if err = u.resolveZoneID(&saveData); err != nil {
+		return
+	}
+
+	for page := 1; ; page++ {
+		path := fmt.Sprintf("/zones/%s/dns_records?comment.contains=%s&per_page=%d&page=%d", saveData.ZoneID, url.QueryEscape(OwnerMarker), u.listPageSize(), page)
+
+		var msg recordListMessage
+		if err = u.cfAPI("GET", path, nil, &msg); err != nil {
+			return
+		}
+
+		for _, record := range msg.Result {
+			if !isOwned(hostData{Comment: record.Comment}) {
+				continue
+			}
+			if manager := u.iacManager(record.Comment, record.Tags); manager != "" && !u.cfg.OverrideIaC {
+				u.log.Printf("Leaving record %v %v as it looks to be managed by %v (set -override-iac to include it)", record.Type, toUnicode(record.Name), manager)
+				continue
+			}
+			records = append(records, Record{ID: record.ID, Type: record.Type, Name: record.Name, Content: record.Content})
+		}
+
+		if page >= msg.ResultInfo.TotalPages {
+			return
+		}
+	}
+}
+
+//DeleteRecords deletes records from the zone and forgets them in the saved data.
+//Every record is tried, and the ones that couldn't be deleted are returned in the error.
+func (u *Updater) DeleteRecords(records []Record) (err error) {
+
+	if err = u.checkCredentials(); err != nil {
+		return
+	}
+
+	unlock, err := u.store.Lock()
+	if err != nil {
+		return
+	}
+	defer unlock()
+
+	saveData, err := u.getSaveData()
+	if err != nil {
+		return
+	}
+	if err = u.resolveZoneID(&saveData); err != nil {
+		return
+	}
+
+	var failed []error
+	for _, record := range records {
+		host := NewHost(record.Name)
+		host.Type = record.Type
+
+		deleteErr := u.cfAPI("DELETE", fmt.Sprintf("/zones/%s/dns_records/%s", saveData.ZoneID, record.ID), nil, nil)
+		u.recordChange(&saveData, changeEntry{ID: newChangeID(), Action: changeDelete, Type: record.Type, Name: record.Name, RecordID: record.ID, Old: record.Content}, deleteErr)
+		if deleteErr != nil {
+			failed = append(failed, &HostError{Host: host, Err: deleteErr})
+			continue
+		}
+		u.log.Printf("Deleted record %v", host)
+		u.cache.remove(recordCacheKey(saveData.ZoneID, host))
+		delete(saveData.Hosts, host.key())
+	}
+
+	if err = u.setSaveData(saveData); err != nil {
+		return
+	}
+
+	if len(failed) > 0 {
+		err = joinHostErrors(failed, len(records))
+	}
+	return
+}
@@ -0,0 +1,113 @@
+package ddns
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+//discoveryData records what was found in Cloudflare on first run, shown by the status command
+type discoveryData struct {
+	Time    time.Time          `json:"time"`
+	Zone    string             `json:"zone"`
+	ZoneID  string             `json:"zoneID"`
+	Records []discoveredRecord `json:"records"`
+}
+
+//discoveredRecord is a record as it was found on first run
+type discoveredRecord struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	ID      string `json:"id,omitempty"`
+	Content string `json:"content,omitempty"`
+	Found   bool   `json:"found"`
+	Current bool   `json:"current"`
+
+	//Tunnel is the id of the Cloudflare Tunnel serving a host that has no record of its own
+	Tunnel string `json:"tunnel,omitempty"`
+}
+
+//reconcileFromRecords fills in the saved IP for each host whose record already holds the current value.
+//Used when there is no saved data, so deploying to a new machine doesn't rewrite every record.
+//Hosts whose records are missing or hold something else are left to be updated as normal.
+//What was found is logged as a summary and kept in the saved data for the status command.
+func (u *Updater) reconcileFromRecords(saveData *saveDataDocument, hosts []Host, ips map[string]string) (err error) {
+
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("Error in reconcileFromRecords(): %v", err)
+		}
+	}()
+
+	u.log.Print("No saved data - checking what the records currently hold.")
+
+	if err = u.resolveZoneID(saveData); err != nil {
+		return
+	}
+
+	discovery := &discoveryData{
+		Time:   time.Now(),
+		Zone:   toUnicode(u.cfg.Zone),
+		ZoneID: saveData.ZoneID,
+	}
+
+	for _, host := range hosts {
+		ip := ips[u.sourceOf(host)]
+		record := discoveredRecord{Name: host.Name, Type: host.Type}
+
+		hostData, getErr := u.getHostData(saveData.ZoneID, host)
+		if getErr != nil && !errors.Is(getErr, errRecordNotFound) {
+			err = getErr
+			return
+		}
+
+		if getErr != nil {
+			if record.Tunnel, err = u.tunnelFor(saveData.ZoneID, host); err != nil {
+				return
+			}
+		} else {
+			record.Found = true
+			record.ID = hostData.ID
+			record.Content = hostData.Content
+			if host.Type == "SRV" {
+				record.Content = fmt.Sprintf("%d %d %d %s", hostData.Data.Priority, hostData.Data.Weight, hostData.Data.Port, hostData.Data.Target)
+			}
+
+			if host.matches(hostData, ip) {
+				record.Current = true
+				saveData.setHostIP(host, ip)
+			}
+		}
+
+		discovery.Records = append(discovery.Records, record)
+	}
+
+	saveData.Discovery = discovery
+	u.logDiscovery(discovery, ips, hosts)
+
+	return
+}
+
+//logDiscovery prints a summary of what was found on first run and what will happen to each record
+func (u *Updater) logDiscovery(discovery *discoveryData, ips map[string]string, hosts []Host) {
+
+	u.log.Printf("First run: found zone %v with id %v.", discovery.Zone, discovery.ZoneID)
+
+	for i, record := range discovery.Records {
+		host := hosts[i]
+		switch {
+		case record.Tunnel != "" && u.cfg.TunnelMode == tunnelModeOrigin:
+			u.log.Printf("  %v: served through Cloudflare Tunnel %v - its origin will be updated if it is a public IP.", host, record.Tunnel)
+		case record.Tunnel != "":
+			u.log.Printf("  %v: served through Cloudflare Tunnel %v - skipped unless -tunnel-mode=%v.", host, record.Tunnel, tunnelModeOrigin)
+		case !record.Found:
+			u.log.Printf("  %v: not found - create it in Cloudflare, updates will fail until it exists.", host)
+		case record.Current:
+			u.log.Printf("  %v: id %v, holds %v - already up to date.", host, record.ID, record.Content)
+		default:
+			u.log.Printf("  %v: id %v, holds %v - will be updated to %v.", host, record.ID, record.Content, host.render(ips[u.sourceOf(host)]))
+		}
+	}
+
+	u.log.Print("These records will be managed from now on. Run with the status command to see this again.")
+}
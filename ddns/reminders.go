@@ -0,0 +1,70 @@
+package ddns
+
+import (
+	"time"
+
+	"github.com/jonegerton/go-cloudflare-ddns/schedule"
+)
+
+//notifyAlert is a host failure that has been notified, kept in the saved data so the same failure
+//in later runs only sends reminders
+type notifyAlert struct {
+	Error     string    `json:"error"`
+	Since     time.Time `json:"since"`
+	LastSent  time.Time `json:"lastSent"`
+	Reminders int       `json:"reminders,omitempty"`
+}
+
+//reminderDue returns how long after the last message the next reminder is due, doubling with each one sent
+func (u *Updater) reminderDue(alert notifyAlert) time.Duration {
+	return schedule.Backoff{Initial: u.cfg.NotifyRemind, Max: u.cfg.NotifyRemindMax}.Delay(alert.Reminders + 1)
+}
+
+//checkRepeat decides whether a host's result is worth notifying, given what was notified in earlier runs.
+//A failure with the same error as the last one notified for the host is held back until a reminder is due,
+//and a success after failures says the host has recovered. r is returned with Notify set and any note to add.
+func (u *Updater) checkRepeat(saveData *saveDataDocument, r hostResult) hostResult {
+
+	r.Notify = true
+	if len(u.cfg.Notify) == 0 || u.cfg.NotifyRemind <= 0 || isSkip(r.Err) {
+		return r
+	}
+
+	now := time.Now()
+	key := r.Host.key()
+	alert, alerted := saveData.NotifyAlerts[key]
+
+	switch {
+	case r.Err == nil && alerted:
+		r.Note = u.message(msgRecovered, map[string]interface{}{"Duration": now.Sub(alert.Since).Round(time.Minute)})
+		delete(saveData.NotifyAlerts, key)
+		return r
+
+	case r.Err == nil:
+		return r
+
+	case alerted && alert.Error == r.Err.Error():
+		if now.Sub(alert.LastSent) < u.reminderDue(alert) {
+			r.Notify = false
+			u.logVerbose("Not notifying the failure of %v again, it has been failing the same way since %v", r.Host, alert.Since.Format(time.RFC1123))
+			return r
+		}
+		alert.Reminders++
+		r.Note = u.message(msgReminder, map[string]interface{}{"Since": alert.Since, "Reminders": alert.Reminders})
+
+	case alerted:
+		//A different failure is notified straight away, but the host has still been failing since the first
+		alert = notifyAlert{Error: r.Err.Error(), Since: alert.Since}
+
+	default:
+		alert = notifyAlert{Error: r.Err.Error(), Since: now}
+	}
+
+	alert.LastSent = now
+	if saveData.NotifyAlerts == nil {
+		saveData.NotifyAlerts = make(map[string]notifyAlert)
+	}
+	saveData.NotifyAlerts[key] = alert
+
+	return r
+}
@@ -0,0 +1,284 @@
+package ddns
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+//errSkipped marks hosts that weren't attempted because the run was cancelled
+var errSkipped = errors.New("skipped as the run was cancelled")
+
+//isSkip reports whether err is a host being skipped rather than failing,
+//as the run was cancelled, the host is served through a Cloudflare Tunnel or its change was only staged
+func isSkip(err error) bool {
+	return errors.Is(err, errSkipped) || errors.Is(err, errTunnel) || errors.Is(err, errStaged)
+}
+
+//HostError is the failure of one host's update
+type HostError struct {
+	Host Host
+	Err  error
+}
+
+func (e *HostError) Error() string {
+	return fmt.Sprintf("%v: %v", e.Host, e.Err)
+}
+
+func (e *HostError) Unwrap() error {
+	return e.Err
+}
+
+//HostErrors is returned by RunOnce when several hosts fail to update. Like an errors.Join error it unwraps
+//to each host's HostError, so errors.Is and errors.As look through all of them.
+type HostErrors struct {
+	Errs  []error
+	Total int
+}
+
+//Error lists the failures one per line under a summary
+func (e *HostErrors) Error() string {
+	lines := []string{fmt.Sprintf("%d of %d hosts failed to update:", len(e.Errs), e.Total)}
+	for _, err := range e.Errs {
+		lines = append(lines, "  - "+err.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (e *HostErrors) Unwrap() []error {
+	return e.Errs
+}
+
+//joinHostErrors returns the error for a run where errs of total hosts failed.
+//A single host's error is returned as it is, as there is nothing to group.
+func joinHostErrors(errs []error, total int) error {
+	if len(errs) == 1 {
+		return errs[0]
+	}
+	return &HostErrors{Errs: errs, Total: total}
+}
+
+//hostResult is the outcome of updating one host, for the run report
+type hostResult struct {
+	Host     Host
+	OpID     string
+	OldIP    string
+	NewIP    string
+	Started  time.Time
+	Duration time.Duration
+	Err      error
+
+	//Proxied is whether the record is proxied through Cloudflare. Propagation is how long after the update
+	//the propagation check waited, and Propagated whether the resolvers were all serving the new IP by then.
+	Proxied     bool
+	Propagation time.Duration
+	Propagated  bool
+
+	//Notify is false for a failure already notified in an earlier run, and Note is added to its notification
+	Notify bool
+	Note   string
+
+	//Checked is set when the record was only checked against the IP by -verify-only, rather than updated
+	Checked bool
+}
+
+//newHostResult records the outcome of a host update started at started
+func newHostResult(host Host, opID string, oldIP string, newIP string, started time.Time, err error) hostResult {
+	return hostResult{
+		Host:     host,
+		OpID:     opID,
+		OldIP:    oldIP,
+		NewIP:    newIP,
+		Started:  started,
+		Duration: time.Since(started),
+		Err:      err,
+		Notify:   true,
+	}
+}
+
+//result describes the outcome in a word or two, followed by the error if there was one
+func (r hostResult) result() string {
+	switch {
+	case r.Checked && r.Err == nil:
+		return "matches"
+	case r.Checked:
+		return "drift: " + r.Err.Error()
+	case r.Err == nil:
+		return "updated"
+	case errors.Is(r.Err, errSkipped):
+		return "skipped"
+	case errors.Is(r.Err, errTunnel):
+		return "skipped: " + r.Err.Error()
+	case errors.Is(r.Err, errStaged):
+		return "staged"
+	}
+	return "failed: " + r.Err.Error()
+}
+
+//writeReport writes the run's results to -report. The file is CSV, a Markdown table if the path ends in .md,
+//or JSON if it ends in .json.
+//{run} in the path is replaced with the run id, so a file can be kept for every run.
+func (u *Updater) writeReport(results []hostResult) (err error) {
+
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("Error in writeReport(): %v", err)
+		}
+	}()
+
+	path := strings.Replace(u.cfg.ReportPath, "{run}", u.runID, -1)
+
+	header := []string{"run", "operation", "time", "host", "type", "old ip", "new ip", "result", "duration", "propagation"}
+	var rows [][]string
+	for _, r := range results {
+		rows = append(rows, []string{
+			u.runID,
+			r.OpID,
+			r.Started.Format(time.RFC3339),
+			r.Host.Name,
+			r.Host.Type,
+			r.OldIP,
+			r.NewIP,
+			r.result(),
+			r.Duration.Round(time.Millisecond).String(),
+			r.propagationText(),
+		})
+	}
+
+	var buf bytes.Buffer
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".md":
+		writeMarkdownTable(&buf, header, rows)
+	case ".json":
+		if err = u.writeJSONReport(&buf, results); err != nil {
+			return
+		}
+	default:
+		w := csv.NewWriter(&buf)
+		w.Write(header)
+		w.WriteAll(rows)
+		if err = w.Error(); err != nil {
+			return
+		}
+	}
+
+	if err = ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		return
+	}
+	u.logVerbose("Report written to %s", path)
+
+	return
+}
+
+//jsonReport is the -report output for .json paths
+type jsonReport struct {
+	Run     string           `json:"run"`
+	Total   int              `json:"total"`
+	Failed  int              `json:"failed"`
+	Results []jsonHostResult `json:"results"`
+}
+
+//jsonHostResult is the outcome of one host in a JSON report. Error is only set for hosts that failed or were skipped.
+type jsonHostResult struct {
+	Operation string `json:"operation,omitempty"`
+	Time      string `json:"time"`
+	Host      string `json:"host"`
+	Type      string `json:"type"`
+	OldIP     string `json:"oldIP,omitempty"`
+	NewIP     string `json:"newIP"`
+	Result    string `json:"result"`
+	Error     string `json:"error,omitempty"`
+	Duration  string `json:"duration"`
+
+	//Propagation is how long the resolvers took to serve the new IP, in seconds, and Propagated false if they hadn't by the timeout
+	Propagation float64 `json:"propagation,omitempty"`
+	Propagated  *bool   `json:"propagated,omitempty"`
+
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+//writeJSONReport writes results as a JSON document, with the error of each failed host kept separate from its result
+func (u *Updater) writeJSONReport(buf *bytes.Buffer, results []hostResult) error {
+
+	report := jsonReport{Run: u.runID, Total: len(results), Failed: countFailed(results)}
+	for _, r := range results {
+		jr := jsonHostResult{
+			Operation: r.OpID,
+			Time:      r.Started.Format(time.RFC3339),
+			Host:      r.Host.Name,
+			Type:      r.Host.Type,
+			OldIP:     r.OldIP,
+			NewIP:     r.NewIP,
+			Result:    "updated",
+			Duration:  r.Duration.Round(time.Millisecond).String(),
+			Labels:    r.Host.Labels,
+		}
+		if r.Propagation > 0 {
+			jr.Propagation = r.Propagation.Round(time.Millisecond).Seconds()
+			jr.Propagated = &r.Propagated
+		}
+		if r.Err != nil {
+			jr.Result = "failed"
+			if isSkip(r.Err) {
+				jr.Result = "skipped"
+			}
+			if errors.Is(r.Err, errStaged) {
+				jr.Result = "staged"
+			}
+			jr.Error = r.Err.Error()
+		}
+		report.Results = append(report.Results, jr)
+	}
+
+	enc := json.NewEncoder(buf)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
+
+//countFailed returns how many of results failed, not counting hosts skipped
+func countFailed(results []hostResult) (n int) {
+	for _, r := range results {
+		if r.Err != nil && !isSkip(r.Err) {
+			n++
+		}
+	}
+	return
+}
+
+//writeMarkdownTable writes rows as a Markdown table, escaping characters that would break it
+func writeMarkdownTable(buf *bytes.Buffer, header []string, rows [][]string) {
+
+	escape := strings.NewReplacer("|", `\|`, "\n", " ", "\r", "")
+
+	writeRow := func(cells []string) {
+		buf.WriteString("|")
+		for _, cell := range cells {
+			fmt.Fprintf(buf, " %s |", escape.Replace(cell))
+		}
+		buf.WriteString("\n")
+	}
+
+	writeRow(header)
+	buf.WriteString("|" + strings.Repeat(" --- |", len(header)) + "\n")
+	for _, row := range rows {
+		writeRow(row)
+	}
+}
+
+//reportPathUsable checks the directory for -report exists, so problems show up before any updates are made
+func (u *Updater) reportPathUsable() error {
+	dir := strings.Replace(u.cfg.ReportPath, "{run}", "", -1)
+	if i := strings.LastIndexAny(dir, `/\`); i >= 0 {
+		if _, err := os.Stat(dir[:i+1]); err != nil {
+			return fmt.Errorf("Report directory for '%v' does not exist", u.cfg.ReportPath)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package ddns
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jonegerton/go-cloudflare-ddns/schedule"
+)
+
+//retryDelay is the wait before the first retry, doubling on each attempt
+var retryDelay = time.Second * 5
+
+//retryableError is returned for API responses that may succeed if sent again
+type retryableError struct {
+	StatusCode int
+	RetryAfter time.Duration
+}
+
+func (e *retryableError) Error() string {
+	return fmt.Sprintf("Cloudflare API returned status %d", e.StatusCode)
+}
+
+//sendIPUpdateWithRetry sends the update, retrying transient failures.
+//A timed out PUT may still have been applied, so the record is fetched again before each retry
+//and the write is skipped if it already holds the new content.
+func (u *Updater) sendIPUpdateWithRetry(hostData hostData, zoneID string, host Host, ip string, changeID string) (err error) {
+
+	backoff := schedule.Backoff{Initial: retryDelay}
+
+	for attempt := 0; ; attempt++ {
+
+		err = u.sendIPUpdate(hostData, zoneID, host, ip, changeID)
+		if err == nil || attempt >= u.cfg.Retries || !isRetryable(err) {
+			return
+		}
+
+		//Respect the server's wait if it gave one
+		wait := backoff.Delay(attempt + 1)
+		var retryErr *retryableError
+		if errors.As(err, &retryErr) && retryErr.RetryAfter > 0 {
+			wait = retryErr.RetryAfter
+		}
+
+		u.log.Printf("Update of %v failed, retrying in %v: %v", host, wait, err)
+		select {
+		case <-time.After(wait):
+		case <-u.runContext().Done():
+			return
+		}
+
+		//The cached record is from before the write, so wouldn't show it being applied
+		u.cache.remove(recordCacheKey(zoneID, host))
+		current, fetchErr := u.getHostData(zoneID, host)
+		if fetchErr != nil {
+			u.logVerbose("Could not re-check %v before retrying: %v", host, fetchErr)
+			continue
+		}
+		if host.matches(current, ip) {
+			u.logVerbose("Update of %v was applied despite the error - not sending again", host)
+			return nil
+		}
+		//The record noting this change's id means the write was applied, even if something else has changed it since
+		if strings.Contains(current.Comment, changeNote+changeID) {
+			u.logVerbose("Update of %v was applied despite the error, but the record has changed since - not sending again", host)
+			return nil
+		}
+		hostData = current
+	}
+}
+
+//isRetryable reports whether err is a transient API or network failure
+func isRetryable(err error) bool {
+
+	var retryErr *retryableError
+	if errors.As(err, &retryErr) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+//parseRetryAfter reads a Retry-After header, which is either seconds or an HTTP date
+func parseRetryAfter(value string) time.Duration {
+
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if t, err := time.Parse(time.RFC1123, value); err == nil {
+		if wait := time.Until(t); wait > 0 {
+			return wait
+		}
+	}
+
+	return 0
+}
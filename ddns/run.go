@@ -0,0 +1,952 @@
+package ddns
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+//saveDataDocument defines the structure of the save json file
+type saveDataDocument struct {
+	IP     string `json:"ip"`
+	ZoneID string `json:"zoneID"`
+	//Zone is the zone name the data was saved for, so data saved for another zone isn't used by mistake
+	Zone string `json:"zone,omitempty"`
+	//ZoneIDExpires is when the zone id is next looked up, see -zone-cache-ttl
+	ZoneIDExpires time.Time `json:"zoneIDExpires,omitzero"`
+	//ZonePlan is the zone's plan, only looked up when needed to check a TTL
+	ZonePlan string            `json:"zonePlan,omitempty"`
+	Hosts    map[string]string `json:"hosts,omitempty"`
+	//ArchivedHosts are the saved state of hosts removed from the host list, by the same key as Hosts
+	ArchivedHosts map[string]archivedHost `json:"archivedHosts,omitempty"`
+
+	RunsSinceVerify int       `json:"runsSinceVerify,omitempty"`
+	FailingSince    time.Time `json:"failingSince,omitzero"`
+
+	WriteFailures int       `json:"writeFailures,omitempty"`
+	CooldownUntil time.Time `json:"cooldownUntil,omitzero"`
+
+	Discovery *discoveryData `json:"discovery,omitempty"`
+
+	Diagnostics *diagnosticsData `json:"diagnostics,omitempty"`
+
+	Stats *statsData `json:"stats,omitempty"`
+
+	//Changes is the history of changes made to records, see recordChange
+	Changes []changeEntry `json:"changes,omitempty"`
+
+	//StableIPs tracks new IPs for the stable IP filters, by filter and IP source
+	StableIPs map[string]stableIP `json:"stableIPs,omitempty"`
+	//SourceTrust is how far each IP source is trusted when used with -wan-ip-peer, by source
+	SourceTrust map[string]sourceTrust `json:"sourceTrust,omitempty"`
+
+	NotifyAlerts map[string]notifyAlert `json:"notifyAlerts,omitempty"`
+
+	//Capabilities are what the credentials were last found to be allowed to do
+	Capabilities *capabilities `json:"capabilities,omitempty"`
+}
+
+//isEmpty reports whether there is no saved data, as on first run
+func (d saveDataDocument) isEmpty() bool {
+	return d.IP == "" && d.ZoneID == "" && len(d.Hosts) == 0
+}
+
+//hostIP returns the IP last published for host.
+//Hosts saved before IPs were tracked per host use the saved WAN IP.
+func (u *Updater) hostIP(d saveDataDocument, host Host) string {
+	if ip, ok := d.Hosts[host.key()]; ok {
+		return ip
+	}
+	if u.sourceOf(host) == u.cfg.IPSource {
+		return d.IP
+	}
+	return ""
+}
+
+//sourceOf returns the IP source for host
+func (u *Updater) sourceOf(host Host) string {
+	if host.Source != "" {
+		return host.Source
+	}
+	return u.cfg.IPSource
+}
+
+//setHostIP records the IP published for host
+func (d *saveDataDocument) setHostIP(host Host, ip string) {
+	if d.Hosts == nil {
+		d.Hosts = make(map[string]string)
+	}
+	d.Hosts[host.key()] = ip
+}
+
+//hostData is the excerpt of a larger response to return the ID only.
+//plus a couple of things that have to be echoed back when PUTting updates
+type hostData struct {
+	ID      string   `json:"id"`
+	Content string   `json:"content"`
+	TTL     int      `json:"ttl"`
+	Proxied bool     `json:"proxied"`
+	Comment string   `json:"comment"`
+	Tags    []string `json:"tags"`
+	Data    SRVData  `json:"data"`
+}
+
+//hostResponseMessage is the envelope response that includes the hostData
+type hostInfoResponseMessage struct {
+	Result []hostData `json:"result"`
+}
+
+//zoneInfoResponseMessage is the envelope response that includes the zone id
+type zoneInfoResponseMessage struct {
+	Result []zoneInfo `json:"result"`
+}
+
+//zoneInfo is a zone matching the zone name, with enough detail to tell apart zones with the same name
+type zoneInfo struct {
+	ID      string `json:"id"`
+	Status  string `json:"status"`
+	Account struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"account"`
+}
+
+// updateRequestBody is the submission body to
+// data="{\"type\":\"A\",\"name\":\"$cfhost\",\"content\":\"$WAN_IP\",\"ttl\":$cfttl,\"proxied\":$cfproxied}"
+type updateRequestBody struct {
+	Type    string   `json:"type"`
+	Name    string   `json:"name"`
+	Content string   `json:"content,omitempty"`
+	Data    *SRVData `json:"data,omitempty"`
+	TTL     int      `json:"ttl"`
+	Proxied bool     `json:"proxied"`
+	Comment string   `json:"comment,omitempty"`
+}
+
+// updateResponseMessage
+type updateResponseMessage struct {
+	Result struct {
+		Content string  `json:"content"`
+		Data    SRVData `json:"data"`
+	} `json:"result"`
+}
+
+//RunOnce checks the WAN IP once and updates the hosts if it has changed
+func (u *Updater) RunOnce(ctx context.Context) (err error) {
+
+	if err = u.checkRequired(); err != nil {
+		return
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.ctx = ctx
+	defer func() {
+		u.ctx = nil
+	}()
+
+	u.startRun()
+	u.resetTransportStats()
+	defer u.logTransportStats()
+	hosts := u.hosts
+
+	if u.cfg.VerifyOnly {
+		return u.verifyOnce(ctx)
+	}
+
+	//Stop overlapping runs, eg from cron, working from the same saved data
+	unlock, err := u.store.Lock()
+	if err != nil {
+		return
+	}
+	defer unlock()
+
+	//Get saved data
+	saveData, err := u.getSaveData()
+	if err != nil {
+		return
+	}
+
+	//Leave Cloudflare alone for a while after writes keep failing, eg with a revoked token
+	if u.coolingDown(saveData) {
+		return
+	}
+
+	//Find what the credentials may do before relying on it. Credentials that can't edit the records only check them.
+	//This can look up the zone id, so first note whether there was any saved data.
+	firstRun := saveData.isEmpty()
+	capsChanged, err := u.checkCapabilities(&saveData)
+	if err != nil {
+		return
+	}
+	if !saveData.Capabilities.EditRecords {
+		if capsChanged {
+			if err = u.setSaveData(saveData); err != nil {
+				return
+			}
+		}
+		return u.verifyWith(ctx, saveData)
+	}
+
+	//Note new IPs, outages and whether the records were left up to date once the run is done
+	previousIP := saveData.IP
+	reconciled := false
+	defer func() {
+		u.recordRun(&saveData, previousIP, err, reconciled)
+		if u.cfg.StatusPageDir != "" {
+			if pageErr := u.writeStatusPage(saveData); pageErr != nil {
+				u.log.Print(pageErr)
+			}
+		}
+	}()
+
+	//Get the WAN IP from each source in use
+	ips, trustChanged, err := u.getWANIPs(ctx, &saveData, hosts)
+	filtersChanged := false
+	if err == nil && u.cfg.SimulateIP == "" {
+		filtersChanged, err = u.applyIPFilters(&saveData, ips)
+	}
+	failingOver := false
+	if u.cfg.FailoverIP != "" {
+		ips, failingOver, err = u.applyFailover(&saveData, hosts, ips, err)
+	}
+	if err != nil {
+		return
+	}
+
+	//Address records follow the family of the IP, so an IPv6 answer updates AAAA rather than A
+	hosts = u.routeByFamily(hosts, ips)
+
+	//Only one instance updates when several share a lock.
+	//The lock is refreshed on every run so standby instances can see this one is alive.
+	if u.cfg.LockRecord != "" {
+		if err = u.resolveZoneID(&saveData); err != nil {
+			return
+		}
+		acquired, lockErr := u.acquireLock(saveData.ZoneID)
+		if errors.Is(lockErr, errZoneInvalid) {
+			if err = u.reresolveZoneID(&saveData); err != nil {
+				return
+			}
+			acquired, lockErr = u.acquireLock(saveData.ZoneID)
+		}
+		if lockErr != nil || !acquired {
+			//Standing by isn't stale, the instance holding the lock keeps the records up to date
+			reconciled = lockErr == nil
+			return lockErr
+		}
+	}
+
+	//With no saved data, eg on a new machine, start from what the records hold now
+	//rather than assuming everything has changed
+	stateChanged := filtersChanged || capsChanged || trustChanged
+	if firstRun {
+		if err = u.reconcileFromRecords(&saveData, hosts, ips); err != nil {
+			return
+		}
+		stateChanged = true
+	}
+
+	//Hosts taken out of the list keep their state in the archive, in case they are added back
+	if u.archiveRemovedHosts(&saveData, hosts, time.Now()) {
+		stateChanged = true
+	}
+
+	//Verify work is needed
+	var changed []Host
+	for _, host := range hosts {
+		if strings.Compare(ips[u.sourceOf(host)], u.hostIP(saveData, host)) != 0 {
+			changed = append(changed, host)
+		}
+	}
+
+	//Every few runs check the records still hold the right value, even when nothing has changed
+	if len(changed) == 0 && u.cfg.VerifyEvery > 0 {
+		saveData.RunsSinceVerify++
+		if saveData.RunsSinceVerify >= u.cfg.VerifyEvery {
+			if changed, err = u.verifyRecords(&saveData, hosts, ips); err != nil {
+				return
+			}
+			saveData.RunsSinceVerify = 0
+		}
+		stateChanged = true
+	}
+
+	//Also update any other records still holding the previous IP
+	if ip, ok := ips[u.cfg.IPSource]; ok && u.cfg.UpdateAllMatching && saveData.IP != "" && strings.Compare(ip, saveData.IP) != 0 {
+		matched, matchErr := u.findMatchingRecords(&saveData, hosts, saveData.IP, ip)
+		if matchErr != nil {
+			return matchErr
+		}
+		changed = append(changed, matched...)
+	}
+
+	if len(changed) == 0 {
+		if stateChanged {
+			if ip, ok := ips[u.cfg.IPSource]; ok {
+				saveData.IP = ip
+			}
+			if err = u.setSaveData(saveData); err != nil {
+				return
+			}
+		}
+		u.log.Print("IP address unchanged - nothing to do.")
+		reconciled = true
+		return
+	}
+
+	//The checks below are of a detected IP, so are skipped for the failover and simulated IPs
+	if ip, ok := ips[u.cfg.IPSource]; ok && !failingOver && u.cfg.SimulateIP == "" && strings.Compare(ip, saveData.IP) != 0 {
+
+		//Cross-check with a second method before sending anything
+		if u.cfg.ConfirmWith != "" {
+			if err = u.confirmWANIP(ctx, ip); err != nil {
+				return
+			}
+			u.logVerbose("WAN IP confirmed using: %s", u.cfg.ConfirmWith)
+		}
+
+		//Don't publish an address that can't reach us
+		if u.cfg.CGNATCheck {
+			behindCGNAT, cgnatErr := u.checkCGNAT(ctx, ip)
+			if cgnatErr != nil {
+				u.log.Printf("Could not check for CGNAT, continuing with update: %v", cgnatErr)
+			} else if behindCGNAT {
+				return
+			}
+		}
+	}
+
+	//Don't publish an address that isn't serving yet
+	if u.cfg.HealthCheckPort > 0 {
+		if changed = u.healthCheckHosts(changed, ips); len(changed) == 0 {
+			return
+		}
+	}
+
+	//Outside the update windows only hosts whose old IP has stopped working are changed
+	deferred := false
+	if !u.inUpdateWindow(time.Now()) {
+		due := u.windowHosts(saveData, changed)
+		deferred = len(due) < len(changed)
+		if changed = due; len(changed) == 0 {
+			return
+		}
+	}
+
+	//A selection wider than meant is stopped before anything is sent
+	if err = u.checkMaxChanges(changed); err != nil {
+		return
+	}
+
+	u.log.Print("New IP address or IP address changed.")
+
+	//Get zoneid if not already resolved
+	if err = u.resolveZoneID(&saveData); err != nil {
+		u.startCooldown(&saveData)
+		if saveErr := u.setSaveData(saveData); saveErr != nil {
+			u.log.Print(saveErr)
+		}
+		return
+	}
+
+	//Catch TTLs the zone's plan doesn't allow before sending anything
+	if err = u.checkTTLs(&saveData, changed); err != nil {
+		return
+	}
+
+	//Record what happened to each host for the report and notifications
+	var results []hostResult
+	record := func(r hostResult) {
+		r = u.checkRepeat(&saveData, r)
+		results = append(results, r)
+		u.countUpdate(&saveData, r)
+		u.hostDone(r)
+		u.notifyImmediate(r)
+	}
+	defer func() {
+		if u.cfg.ReportPath != "" && len(results) > 0 {
+			if reportErr := u.writeReport(results); reportErr != nil {
+				u.log.Print(reportErr)
+			}
+		}
+		u.notifyDigest(results)
+	}()
+
+	//A failing host doesn't stop the others, its error is collected and returned with the rest
+	var failed []error
+	staged := false
+	for i, host := range changed {
+
+		ip := ips[u.sourceOf(host)]
+
+		//Stop between hosts if cancelled, leaving the rest for the next run
+		if ctx.Err() != nil {
+			record(newHostResult(host, "", u.hostIP(saveData, host), ip, time.Now(), errSkipped))
+			continue
+		}
+
+		opID := u.startOperation(i+1, host)
+		u.logVerbose("Updating IP for host: %s (operation %s)", host, opID)
+
+		started := time.Now()
+		updated, hostErr := u.updateHost(&saveData, host, ip)
+		result := newHostResult(host, opID, u.hostIP(saveData, host), ip, started, hostErr)
+		result.Proxied = updated.Proxied
+		record(result)
+		u.endOperation()
+
+		if errors.Is(hostErr, errStaged) {
+			staged = true
+			continue
+		}
+		if isSkip(hostErr) {
+			u.log.Printf("Skipping %v: %v", host, hostErr)
+			saveData.setHostIP(host, ip)
+			continue
+		}
+		if hostErr != nil {
+			failed = append(failed, &HostError{Host: host, Err: hostErr})
+			continue
+		}
+		if !host.Matched {
+			saveData.setHostIP(host, ip)
+		}
+	}
+
+	//Wait for the new IPs to reach public resolvers, if asked to
+	u.checkPropagation(ctx, &saveData, results)
+
+	//Hosts without an IP of their own fall back to the saved WAN IP, so it is only saved once they all have it
+	if ip, ok := ips[u.cfg.IPSource]; ok && len(failed) == 0 && !deferred && !staged && ctx.Err() == nil {
+		saveData.IP = ip
+	}
+
+	//Every host failing points at Cloudflare or the credentials rather than the hosts, so back off
+	if len(failed) == len(changed) {
+		u.startCooldown(&saveData)
+	} else {
+		u.endCooldown(&saveData)
+	}
+
+	//Persist what did update, so it isn't sent again next run
+	err = u.setSaveData(saveData)
+	if err != nil {
+		return
+	}
+
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	if len(failed) > 0 {
+		err = joinHostErrors(failed, len(changed))
+		return
+	}
+
+	if staged {
+		u.log.Print("Changes staged in the record comments.")
+		return
+	}
+	u.log.Print("IP address update complete.")
+	reconciled = !deferred
+
+	return
+}
+
+//updateHost updates the record for host to hold ip, returning what the record now holds.
+//Nothing is returned for hosts served through a tunnel, which have no record.
+func (u *Updater) updateHost(saveData *saveDataDocument, host Host, ip string) (updated hostData, err error) {
+
+	if err = u.simulatedFailure(failAtUpdate); err != nil {
+		return
+	}
+
+	//Get the hostData for the host record to update, as this also gets the ttl/proxied flag, which are required on the api.
+	//It is only cached for -record-cache-ttl, as there's a risk of setting it to an old value if it's changed in the dashboard
+	hostData, err := u.getHostData(saveData.ZoneID, host)
+	if errors.Is(err, errZoneInvalid) {
+		if err = u.reresolveZoneID(saveData); err != nil {
+			return
+		}
+		hostData, err = u.getHostData(saveData.ZoneID, host)
+	}
+	if errors.Is(err, errRecordNotFound) {
+		//Hostnames routed to a Cloudflare Tunnel have a CNAME to the tunnel instead of an address record
+		tunnelID, tunnelErr := u.tunnelFor(saveData.ZoneID, host)
+		if tunnelErr != nil {
+			return updated, tunnelErr
+		}
+		if tunnelID != "" && u.cfg.Staged {
+			return updated, fmt.Errorf("%w: not staged, as it is served through tunnel %v so has no record to note it on", errStaged, tunnelID)
+		}
+		if tunnelID != "" {
+			return updated, u.updateTunnel(saveData, host, tunnelID, ip)
+		}
+	}
+	if err != nil {
+		return
+	}
+	u.logVerbose("HostID is: %s", hostData.ID)
+
+	//Only touch records this utility manages, and not ones another tool manages too
+	if err = u.checkOwnership(hostData, host); err != nil {
+		return
+	}
+	if err = u.checkIaC(hostData, host); err != nil {
+		return
+	}
+
+	//Staged changes are only noted on the record, for review in the dashboard
+	if u.cfg.Staged {
+		return hostData, u.stageUpdate(saveData.ZoneID, hostData, host, ip)
+	}
+
+	//Submit to cloudflare, keeping what the record now holds so it needn't be fetched again soon.
+	//After a failure it may hold anything, so it's fetched next time.
+	//The change is noted in the history whether or not it succeeds, as a timed out change may still have been made.
+	changeID := newChangeID()
+	u.logVerbose("Change id is: %s", changeID)
+	err = u.sendIPUpdateWithRetry(hostData, saveData.ZoneID, host, ip, changeID)
+	old := hostData.Content
+	if host.Type == "SRV" {
+		old = hostData.Data.Target
+	}
+	u.recordChange(saveData, changeEntry{ID: changeID, Action: changeUpdate, Type: host.Type, Name: host.Name, RecordID: hostData.ID, Old: old, New: host.render(ip)}, err)
+	if err != nil {
+		u.cache.remove(recordCacheKey(saveData.ZoneID, host))
+		return
+	}
+	updated = hostData.updated(host, ip, changeID)
+	u.cacheRecord(saveData.ZoneID, host, updated)
+	return
+}
+
+//resolveZoneID sets the zone id in the saved data, looking it up if it hasn't been within -zone-cache-ttl
+func (u *Updater) resolveZoneID(saveData *saveDataDocument) (err error) {
+
+	if err = u.simulatedFailure(failAtZone); err != nil {
+		return
+	}
+
+	//A zone id given in the settings skips the lookup
+	if u.cfg.ZoneID != "" {
+		saveData.ZoneID = u.cfg.ZoneID
+		return
+	}
+
+	if zoneID, ok := u.cache.get(u.zoneCacheKey()); ok {
+		saveData.ZoneID = zoneID.(string)
+		return
+	}
+
+	//The saved id is the cache entry kept from an earlier process, eg the last run from cron.
+	//Credentials that can't read the zone can't look it up again, so keep using it.
+	if saveData.ZoneID != "" && !saveData.canReadZone() {
+		u.cache.set(u.zoneCacheKey(), saveData.ZoneID, u.cfg.ZoneCacheTTL)
+		return
+	}
+	if saveData.ZoneID != "" && time.Now().Before(saveData.ZoneIDExpires) {
+		u.cache.set(u.zoneCacheKey(), saveData.ZoneID, time.Until(saveData.ZoneIDExpires))
+		return
+	}
+
+	u.logVerbose("Getting zoneid for zone: %s", toUnicode(u.cfg.Zone))
+	zoneID, err := u.getZoneID()
+	if err != nil {
+		return
+	}
+	u.logVerbose("ZoneID is: %s", zoneID)
+
+	if zoneID != saveData.ZoneID {
+		saveData.ZonePlan = ""
+	}
+	saveData.ZoneID = zoneID
+	saveData.ZoneIDExpires = time.Now().Add(u.cfg.ZoneCacheTTL)
+	u.cache.set(u.zoneCacheKey(), zoneID, u.cfg.ZoneCacheTTL)
+
+	return
+}
+
+func (u *Updater) logVerbose(format string, a ...interface{}) {
+	if !u.cfg.Verbose {
+		return
+	}
+
+	u.log.Printf(format, a...)
+}
+
+//getWANIPs gets the WAN IP from each source used by the hosts, keyed by source.
+//changed is true if the trust in the -wan-ip-peer sources changed in the saved data, so it needs saving.
+func (u *Updater) getWANIPs(ctx context.Context, saveData *saveDataDocument, hosts []Host) (ips map[string]string, changed bool, err error) {
+
+	if err = u.simulatedFailure(failAtDetection); err != nil {
+		return
+	}
+	if u.cfg.SimulateIP != "" {
+		ips = u.simulatedIPs(hosts)
+		for spec, ip := range ips {
+			u.ipDetected(spec, ip)
+		}
+		return
+	}
+
+	ips = make(map[string]string)
+
+	//Matching records are found using the previous IP from the default source
+	var specs []string
+	if u.cfg.UpdateAllMatching {
+		specs = append(specs, u.cfg.IPSource)
+	}
+	for _, host := range hosts {
+		specs = append(specs, u.sourceOf(host))
+	}
+
+	for _, spec := range specs {
+		if _, done := ips[spec]; done {
+			continue
+		}
+
+		//With peers the default source's IP is the one most of the sources agree on
+		var ip string
+		if spec == u.cfg.IPSource && len(u.cfg.PeerSources) > 0 {
+			var trustChanged bool
+			ip, trustChanged, err = u.consensusIP(ctx, saveData)
+			changed = changed || trustChanged
+			if err != nil {
+				return nil, changed, err
+			}
+		} else {
+			if ip, err = u.detectIP(ctx, spec); err != nil {
+				return nil, changed, err
+			}
+			u.logVerbose("WAN IP from %s is: %s", spec, ip)
+		}
+		u.ipDetected(spec, ip)
+
+		ips[spec] = ip
+	}
+
+	return
+}
+
+func (u *Updater) getWANIP(ctx context.Context, spec string) (ip string, err error) {
+
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("Error in getWANIP(): %w", err)
+		}
+	}()
+
+	source, err := u.newSource(spec)
+	if err != nil {
+		return
+	}
+
+	addr, err := source.Detect(ctx)
+	if err != nil {
+		err = clockHint(err)
+		return
+	}
+	if err = u.checkFamily(source, addr); err != nil {
+		return
+	}
+
+	ip = addr.String()
+	return
+}
+
+func (u *Updater) getSaveData() (saveData saveDataDocument, err error) {
+
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("Error in getSavedData(): %v", err)
+		}
+	}()
+
+	//check for saved data
+	data, readErr := u.store.Load()
+	if readErr != nil || data == nil {
+		u.log.Printf("Could not read saved data from %v (this is ok on first run. at other times check file permissions etc)", u.store)
+		return
+	}
+
+	//Unencrypted data is still read when a key is given, and is encrypted on the next save
+	if isEncryptedState(data) {
+		key, keyErr := u.loadStateKey()
+		if keyErr != nil {
+			err = keyErr
+			return
+		}
+		if data, err = decryptState(key, data); err != nil {
+			return
+		}
+	}
+
+	if err = json.Unmarshal(data, &saveData); err != nil {
+		err = fmt.Errorf("Error parsing host details response: %v", err)
+		return
+	}
+
+	//Each zone's saved data is kept apart, as using another's would publish or skip the wrong changes
+	if saveData.Zone != "" && u.cfg.Zone != "" && !strings.EqualFold(saveData.Zone, u.cfg.Zone) {
+		err = fmt.Errorf("The saved data in %v is for zone %v, not %v. Give each zone its own -profile, or delete the file to start again", u.store, saveData.Zone, u.cfg.Zone)
+		return
+	}
+	u.diag.seed(saveData.Diagnostics)
+	return
+
+}
+
+func (u *Updater) setSaveData(saveData saveDataDocument) (err error) {
+
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("Error in setSaveData(): %v", err)
+
+		}
+	}()
+
+	if diag := u.diag.snapshot(); diag != nil {
+		saveData.Diagnostics = diag
+	}
+	if u.cfg.Zone != "" {
+		saveData.Zone = u.cfg.Zone
+	}
+
+	data, err := json.Marshal(saveData)
+	if err != nil {
+		err = fmt.Errorf("Error preparsing saveData: %v", err)
+		return
+	}
+
+	key, err := u.loadStateKey()
+	if err != nil {
+		return
+	}
+	if key != nil {
+		if data, err = encryptState(key, data); err != nil {
+			return
+		}
+	}
+
+	//Persist the IP only once upload has succeeded (incase retry is required)
+	if err = u.store.Save(data); err != nil {
+		err = fmt.Errorf("Failed to save data to %v: %v", u.store, err)
+	}
+
+	return
+}
+
+func (u *Updater) getHostData(zoneID string, host Host) (hostData hostData, err error) {
+
+	//Example curl request
+	// curl -X GET "https://api.cloudflare.com/client/v4/zones/$cfzonekey/dns_records?type=A&name=$cfhost" \
+	// 	-H "X-Auth-Key: $cfkey " \
+	// 	-H "X-Auth-Email: $cfuser" \
+	// 	-H "Content-Type: application/json" > ./cf-ddns.json
+
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("Error in getHostData(): %w", err)
+		}
+	}()
+
+	if cached, ok := u.cachedRecord(zoneID, host); ok {
+		u.logVerbose("Using cached details of %v", host)
+		return cached, nil
+	}
+
+	//A zone that has been deleted and added again has a new id, which cfAPI tells apart from a request it rejected
+	//for other reasons, eg a name Cloudflare doesn't accept
+	var msg hostInfoResponseMessage
+	path := fmt.Sprintf("/zones/%s/dns_records?type=%s&name=%s", zoneID, host.Type, url.QueryEscape(host.Name))
+	if err = u.cfAPI("GET", path, nil, &msg); err != nil {
+		return
+	}
+	if len(msg.Result) == 0 || msg.Result[0].ID == "" {
+		err = errRecordNotFound
+		return
+	}
+	hostData = msg.Result[0]
+	u.cacheRecord(zoneID, host, hostData)
+
+	return
+
+}
+
+func (u *Updater) getZoneID() (zoneID string, err error) {
+
+	//Example curl request
+	// curl -X GET "https://api.cloudflare.com/client/v4/zones/?name=$cfhost" \
+	// 	-H "X-Auth-Key: $cfkey " \
+	// 	-H "X-Auth-Email: $cfuser" \
+	// 	-H "Content-Type: application/json" > ./cf-ddns.json
+
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("Error in getZoneID(): %v", err)
+		}
+	}()
+
+	url := fmt.Sprintf("%s/zones/?name=%s", u.cfg.APIBase, u.cfg.Zone)
+
+	//Only look in one account when the same zone name exists in several
+	if u.cfg.Account != "" {
+		url += "&account.id=" + u.cfg.Account
+	}
+
+	req, _ := http.NewRequestWithContext(u.runContext(), "GET", url, nil)
+	u.setAuth(req)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := u.apiClient().Do(req)
+	if err != nil {
+		err = clockHint(err)
+		return
+	}
+	if resp == nil {
+		err = fmt.Errorf("Error requesting zone details %v", url)
+		return
+	}
+	defer resp.Body.Close()
+	u.captureAPIError(req, resp)
+	u.checkClock(resp)
+
+	var msg zoneInfoResponseMessage
+	if err = u.decodeResponse(resp.Body, &msg); err != nil {
+		err = fmt.Errorf("Error parsing zone details response: %v", err)
+		return
+	}
+	zoneID, err = u.selectZone(msg.Result)
+
+	return
+
+}
+
+//newUpdateRequestBody builds the record to submit for host, keeping the proxied flag and comment of the existing record,
+//and its ttl unless the entry sets one. The comment notes changeID, the id of the change in the change history.
+func newUpdateRequestBody(hostData hostData, host Host, ip string, changeID string) updateRequestBody {
+
+	data := updateRequestBody{
+		Type:    host.Type,
+		Name:    host.Name,
+		Content: host.render(ip),
+		TTL:     hostData.TTL,
+		Proxied: hostData.Proxied,
+		Comment: changeComment(ownedComment(unstagedComment(hostData.Comment)), changeID),
+	}
+	if host.TTL != 0 {
+		data.TTL = host.TTL
+	}
+
+	//SRV records are updated through data rather than content
+	if host.Type == "SRV" {
+		data.Data = host.submitSRV(hostData.Data)
+		data.Content = ""
+	}
+
+	return data
+}
+
+//updated returns what the record holds after updating it for host to ip in the change changeID
+func (d hostData) updated(host Host, ip string, changeID string) hostData {
+	body := newUpdateRequestBody(d, host, ip, changeID)
+	d.Content, d.TTL, d.Comment = body.Content, body.TTL, body.Comment
+	if body.Data != nil {
+		d.Data = *body.Data
+	}
+	return d
+}
+
+func (u *Updater) sendIPUpdate(hostData hostData, zoneID string, host Host, ip string, changeID string) (err error) {
+
+	//Curl example
+	// data="{\"type\":\"A\",\"name\":\"$cfhost\",\"content\":\"$WAN_IP\",\"ttl\":$cfttl,\"proxied\":$cfproxied}"
+	// echo "data: $data" >> $log
+
+	// curl -X PUT "https://api.cloudflare.com/client/v4/zones/$cfzonekey/dns_records/$cfhostkey" \
+	// 	-H "X-Auth-Key: $cfkey" \
+	// 	-H "X-Auth-Email: $cfuser" \
+	// 	-H "Content-Type: application/json" \
+	// 	--data $data >> $log
+
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("Error in sendIPUpdate(): %w", err)
+		}
+	}()
+
+	data := newUpdateRequestBody(hostData, host, ip, changeID)
+	content, srv := data.Content, data.Data
+
+	payload, err := u.recordPayload(host, data)
+	if err != nil {
+		return
+	}
+	putBody, err := json.Marshal(payload)
+	if err != nil {
+		err = fmt.Errorf("Error in sendIPUpdate(): %v", err)
+	}
+
+	url := fmt.Sprintf("%s/zones/%s/dns_records/%s", u.cfg.APIBase, zoneID, hostData.ID)
+
+	req, _ := http.NewRequestWithContext(u.runContext(), "PUT", url, bytes.NewBuffer(putBody))
+	u.setAuth(req)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := u.apiClient().Do(req)
+	if err != nil {
+		err = clockHint(err)
+		return
+	}
+	if resp == nil {
+		err = fmt.Errorf("Error sending host update details %v", url)
+		return
+	}
+	defer resp.Body.Close()
+	u.captureAPIError(req, resp)
+	u.checkClock(resp)
+
+	//Rate limiting and server errors are worth retrying
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		err = &retryableError{
+			StatusCode: resp.StatusCode,
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+		}
+		return
+	}
+
+	var msg updateResponseMessage
+	if err = u.decodeResponse(resp.Body, &msg); err != nil {
+		err = fmt.Errorf("Error parsing host details response: %v", err)
+		return
+	}
+
+	//Check SRV data on response matches submit
+	if srv != nil {
+		if msg.Result.Data.Port != srv.Port || !strings.EqualFold(strings.TrimSuffix(msg.Result.Data.Target, "."), srv.Target) {
+			err = errors.New("Error checking that SRV data was correctly updated")
+		}
+		return
+	}
+
+	if msg.Result.Content == "" {
+		err = fmt.Errorf("Error reading updated IP")
+		return
+	}
+
+	//Check content on response matches submit (TXT content may come back quoted)
+	if strings.Compare(strings.Trim(content, `"`), strings.Trim(msg.Result.Content, `"`)) != 0 {
+		err = errors.New("Error checking that IP was correctly updated")
+		return
+	}
+
+	return
+}
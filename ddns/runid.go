@@ -0,0 +1,39 @@
+package ddns
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+)
+
+//newID returns a short random hex id
+func newID() string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+//startRun generates a new run id and adds it to all log lines
+func (u *Updater) startRun() {
+	u.runID = newID()
+	u.log.SetFlags(u.log.Flags() | log.Lmsgprefix)
+	u.log.SetPrefix(fmt.Sprintf("%srun=%s ", u.logPrefix, u.runID))
+}
+
+//startOperation returns the id for the nth host operation of the run and adds it, and the host's labels,
+//to log lines until endOperation
+func (u *Updater) startOperation(n int, host Host) (opID string) {
+	opID = fmt.Sprintf("%s-%d", u.runID, n)
+	prefix := fmt.Sprintf("%srun=%s op=%s ", u.logPrefix, u.runID, opID)
+	for _, pair := range host.labelPairs() {
+		prefix += pair + " "
+	}
+	u.log.SetPrefix(prefix)
+	return
+}
+
+//endOperation removes the operation id from log lines
+func (u *Updater) endOperation() {
+	u.log.SetPrefix(fmt.Sprintf("%srun=%s ", u.logPrefix, u.runID))
+}
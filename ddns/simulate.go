@@ -0,0 +1,51 @@
+package ddns
+
+import (
+	"fmt"
+	"net/netip"
+)
+
+//Steps -fail-at can fail, to rehearse alerting without a real failure
+const (
+	failAtDetection = "detection"
+	failAtZone      = "zone"
+	failAtUpdate    = "update"
+)
+
+//validateSimulation checks the -fail-at and -simulate-ip settings
+func (u *Updater) validateSimulation() error {
+
+	switch u.cfg.FailAt {
+	case "", failAtDetection, failAtZone, failAtUpdate:
+	default:
+		return fmt.Errorf("Fail at '%v' is not valid (expected %v, %v or %v)", u.cfg.FailAt, failAtDetection, failAtZone, failAtUpdate)
+	}
+
+	if u.cfg.SimulateIP != "" {
+		if _, err := netip.ParseAddr(u.cfg.SimulateIP); err != nil {
+			return fmt.Errorf("Simulated IP '%v' is not an IP address", u.cfg.SimulateIP)
+		}
+	}
+
+	return nil
+}
+
+//simulatedFailure returns an error if -fail-at is set to step
+func (u *Updater) simulatedFailure(step string) error {
+	if u.cfg.FailAt != step {
+		return nil
+	}
+	return fmt.Errorf("Simulated failure at %v (-fail-at is set)", step)
+}
+
+//simulatedIPs returns the -simulate-ip address for every source in place of detecting it
+func (u *Updater) simulatedIPs(hosts []Host) map[string]string {
+
+	u.log.Printf("Simulating WAN IP %v (-simulate-ip is set) - records will be updated to it.", u.cfg.SimulateIP)
+
+	ips := map[string]string{u.cfg.IPSource: u.cfg.SimulateIP}
+	for _, host := range hosts {
+		ips[u.sourceOf(host)] = u.cfg.SimulateIP
+	}
+	return ips
+}
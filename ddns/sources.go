@@ -0,0 +1,84 @@
+package ddns
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/jonegerton/go-cloudflare-ddns/ipsource"
+)
+
+//newSource returns the IP source for spec. Router backends take their settings from flags,
+//everything else is handled by ipsource.Parse.
+func (u *Updater) newSource(spec string) (source ipsource.Source, err error) {
+
+	switch {
+	case strings.HasPrefix(spec, "scrape:"):
+		var pattern *regexp.Regexp
+		if u.cfg.ScrapePattern != "" {
+			if pattern, err = regexp.Compile(u.cfg.ScrapePattern); err != nil {
+				err = fmt.Errorf("Invalid -scrape-pattern: %v", err)
+				return
+			}
+		}
+		scrape := ipsource.NewScrape(strings.TrimPrefix(spec, "scrape:"), pattern)
+		scrape.Username = u.cfg.RouterUser
+		scrape.Password = u.cfg.RouterPassword
+		scrape.Client = u.routerClient()
+		source = scrape
+
+	case strings.HasPrefix(spec, "mikrotik:"):
+		mikrotik := ipsource.NewMikroTik(strings.TrimPrefix(spec, "mikrotik:"), u.cfg.RouterInterface)
+		mikrotik.Username = u.cfg.RouterUser
+		mikrotik.Password = u.cfg.RouterPassword
+		mikrotik.Client = u.routerClient()
+		source = mikrotik
+
+	case strings.HasPrefix(spec, "pfsense:"):
+		pfsense := ipsource.NewPfSense(strings.TrimPrefix(spec, "pfsense:"), u.cfg.RouterInterface)
+		pfsense.Username = u.cfg.RouterUser
+		pfsense.Password = u.cfg.RouterPassword
+		pfsense.Client = u.routerClient()
+		source = pfsense
+
+	case strings.HasPrefix(spec, "opnsense:"):
+		opnsense := ipsource.NewOPNsense(strings.TrimPrefix(spec, "opnsense:"), u.cfg.RouterInterface)
+		opnsense.Username = u.cfg.RouterUser
+		opnsense.Password = u.cfg.RouterPassword
+		opnsense.Client = u.routerClient()
+		source = opnsense
+
+	default:
+		if source, err = ipsource.Parse(spec); err == nil {
+			u.applyFamily(source)
+			if iface, ok := source.(*ipsource.Interface); ok {
+				iface.AllowPrivate = u.cfg.InterfaceAllowPrivate
+			}
+		}
+	}
+
+	return
+}
+
+//routerClient returns the http client for talking to local routers,
+//which often use self-signed certificates. The transport not checking them is made once, so each run reuses its
+//connections rather than leaving another set idle.
+func (u *Updater) routerClient() *http.Client {
+
+	client := &http.Client{
+		Timeout: time.Second * 10,
+	}
+	if u.cfg.RouterInsecure {
+		u.routerTransportOnce.Do(func() {
+			u.routerTransport = http.DefaultTransport.(*http.Transport).Clone()
+			u.routerTransport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+			u.routerTransport.DisableKeepAlives = u.cfg.LowMemory
+		})
+		client.Transport = u.routerTransport
+	}
+
+	return client
+}
@@ -0,0 +1,47 @@
+package ddns
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestRouterClientTransport(t *testing.T) {
+
+	tests := []struct {
+		name      string
+		insecure  bool
+		lowMemory bool
+	}{
+		{"checks certificates", false, false},
+		{"insecure", true, false},
+		{"insecure with low memory", true, true},
+	}
+
+	for _, test := range tests {
+		u, err := New(WithToken("fake"), WithZone("example.com"), WithHosts("home"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		u.cfg.RouterInsecure, u.cfg.LowMemory = test.insecure, test.lowMemory
+
+		first, second := u.routerClient(), u.routerClient()
+		if !test.insecure {
+			if first.Transport != nil {
+				t.Errorf("%v: router client has its own transport, expected the default", test.name)
+			}
+			continue
+		}
+
+		//Every detection uses the same transport, so its idle connections are reused rather than left open
+		transport, ok := first.Transport.(*http.Transport)
+		if !ok || first.Transport != second.Transport {
+			t.Fatalf("%v: router clients have transports %v and %v, expected one shared", test.name, first.Transport, second.Transport)
+		}
+		if !transport.TLSClientConfig.InsecureSkipVerify {
+			t.Errorf("%v: router transport checks certificates", test.name)
+		}
+		if transport.DisableKeepAlives != test.lowMemory {
+			t.Errorf("%v: router transport keep-alives disabled: %v, expected %v", test.name, transport.DisableKeepAlives, test.lowMemory)
+		}
+	}
+}
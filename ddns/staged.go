@@ -0,0 +1,71 @@
+package ddns
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+//stagedNote starts the note written to a record's comment by -staged, followed by the content it would be given
+const stagedNote = "ddns-staged: "
+
+//errStaged marks hosts whose change was written to the record's comment by -staged rather than made
+var errStaged = errors.New("staged in the record's comment")
+
+//stagedNoteRX matches a note left by -staged, with the separator before it
+var stagedNoteRX = regexp.MustCompile(`(?:;\s*)?` + regexp.QuoteMeta(stagedNote) + `[^;]*`)
+
+//unstagedComment returns the record comment without any note left by -staged
+func unstagedComment(comment string) string {
+	return strings.TrimPrefix(strings.TrimSpace(stagedNoteRX.ReplaceAllString(comment, "")), "; ")
+}
+
+//stagedComment returns the record comment noting the content the record would be given
+func stagedComment(comment string, content string) string {
+	comment = unstagedComment(comment)
+	if comment == "" {
+		return stagedNote + content
+	}
+	return comment + "; " + stagedNote + content
+}
+
+//stageUpdate writes the content host would be given to its record's comment instead of changing the record, for -staged,
+//so the pending change can be reviewed in the dashboard. If the record already holds it, eg as it was changed by hand,
+//any note is removed and nil returned so it is saved as up to date. Otherwise errStaged is returned.
+func (u *Updater) stageUpdate(zoneID string, current hostData, host Host, ip string) (err error) {
+
+	defer func() {
+		if err != nil && !errors.Is(err, errStaged) {
+			err = fmt.Errorf("Error in stageUpdate(): %v", err)
+		}
+	}()
+
+	comment := stagedComment(current.Comment, host.render(ip))
+	if host.matches(current, ip) {
+		comment = unstagedComment(current.Comment)
+	}
+
+	if comment != current.Comment {
+		var msg struct {
+			Result hostData `json:"result"`
+		}
+		body := struct {
+			Comment string `json:"comment"`
+		}{comment}
+		if err = u.cfAPI("PATCH", fmt.Sprintf("/zones/%s/dns_records/%s", zoneID, current.ID), body, &msg); err != nil {
+			u.cache.remove(recordCacheKey(zoneID, host))
+			return
+		}
+		current.Comment = comment
+		u.cacheRecord(zoneID, host, current)
+	}
+
+	if host.matches(current, ip) {
+		u.log.Printf("Record %v already holds %v - nothing to stage.", host, host.render(ip))
+		return
+	}
+	u.log.Printf("Staged %v: its comment proposes %v, the record still holds %v.", host, host.render(ip), current.Content)
+
+	return errStaged
+}
@@ -0,0 +1,49 @@
+package ddns
+
+import "time"
+
+//Events for notifications that aren't about a host's update
+const (
+	eventStale     = "stale"
+	eventRecovered = "stale-recovered"
+)
+
+//checkStale tracks how long the records have gone without being brought up to date with the IP, and notifies every
+//channel once that passes -stale-after, and again when they are up to date. Unlike the host notifications this
+//covers anything that stops the records being updated, such as IP detection failing or health checks holding updates back.
+//reconciled is whether the run left every record holding the IP. changed is true if the saved data needs saving.
+func (u *Updater) checkStale(stats *statsData, reconciled bool, now time.Time) (changed bool) {
+
+	switch {
+	case reconciled && !stats.StaleSince.IsZero():
+		if stats.StaleAlerted {
+			u.log.Printf("Records are up to date again after %v", now.Sub(stats.StaleSince).Round(time.Minute))
+			u.notifyEvent(eventRecovered, u.message(msgStaleRecovered, map[string]interface{}{"Duration": now.Sub(stats.StaleSince).Round(time.Minute)}))
+		}
+		stats.StaleSince, stats.StaleAlerted = time.Time{}, false
+		return true
+
+	case reconciled:
+		return false
+
+	case stats.StaleSince.IsZero():
+		stats.StaleSince = now
+		changed = true
+	}
+
+	if u.cfg.StaleAfter > 0 && !stats.StaleAlerted && now.Sub(stats.StaleSince) >= u.cfg.StaleAfter {
+		u.log.Printf("Records have not been brought up to date since %v", stats.StaleSince.Format(time.RFC1123))
+		u.notifyEvent(eventStale, u.message(msgStale, map[string]interface{}{"Duration": now.Sub(stats.StaleSince).Round(time.Minute), "Since": stats.StaleSince}))
+		stats.StaleAlerted = true
+		changed = true
+	}
+
+	return
+}
+
+//notifyEvent sends a message that isn't about a host's update to every channel, whatever its mode
+func (u *Updater) notifyEvent(event string, text string) {
+	for _, channel := range u.cfg.Notify {
+		u.postNotification(channel, notificationMessage{Text: text, Run: u.runID, Event: event, Results: []notificationResult{}})
+	}
+}
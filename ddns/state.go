@@ -0,0 +1,116 @@
+package ddns
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+//StateStore keeps the saved data between runs. The JSON file is the default,
+//and other backends only need to implement these three methods.
+type StateStore interface {
+	//Load returns the saved data, or nil if nothing has been saved yet
+	Load() ([]byte, error)
+	//Save replaces the saved data
+	Save(data []byte) error
+	//Lock stops other runs using the store until unlock is called
+	Lock() (unlock func(), err error)
+}
+
+//fileLockStale is how old a lock file must be before it is taken to be left behind by a run that died
+const fileLockStale = time.Minute * 10
+
+//FileStore keeps the saved data in a file, locked with a .lock file alongside it
+type FileStore struct {
+	Path string
+}
+
+//NewFileStore returns a store keeping the saved data at path
+func NewFileStore(path string) *FileStore {
+	return &FileStore{Path: path}
+}
+
+//String describes the store for logging
+func (s *FileStore) String() string {
+	return fmt.Sprintf("file '%v'", s.Path)
+}
+
+//Load reads the file, returning nil if it doesn't exist yet
+func (s *FileStore) Load() (data []byte, err error) {
+	data, err = ioutil.ReadFile(s.Path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return
+}
+
+//Save writes the data to a temporary file alongside, then renames it over the file, so a run stopped part way
+//through leaves the previous data rather than a truncated file. Encrypted data is only readable by the owner.
+func (s *FileStore) Save(data []byte) (err error) {
+
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("Error in Save(): %v", err)
+		}
+	}()
+
+	var perm os.FileMode = 0644
+	if isEncryptedState(data) {
+		perm = 0600
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(s.Path), filepath.Base(s.Path)+".tmp*")
+	if err != nil {
+		return
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return
+	}
+	if err = os.Chmod(f.Name(), perm); err != nil {
+		return
+	}
+
+	return os.Rename(f.Name(), s.Path)
+}
+
+//Lock creates the lock file, failing if another run holds it.
+//A lock file older than fileLockStale is taken over, so a run that died doesn't block the rest.
+func (s *FileStore) Lock() (unlock func(), err error) {
+
+	lockPath := s.Path + ".lock"
+
+	f, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if os.IsExist(err) {
+		info, statErr := os.Stat(lockPath)
+		if statErr != nil || time.Since(info.ModTime()) < fileLockStale {
+			err = fmt.Errorf("Saved data at '%v' is locked by another run (remove %v if that isn't so)", s.Path, lockPath)
+			return
+		}
+		os.Remove(lockPath)
+		f, err = os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	}
+	if err != nil {
+		err = fmt.Errorf("Error locking saved data: %v", err)
+		return
+	}
+
+	f.WriteString(strconv.Itoa(os.Getpid()))
+	f.Close()
+
+	unlock = func() {
+		os.Remove(lockPath)
+	}
+	return
+}
@@ -0,0 +1,102 @@
+package ddns
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+)
+
+//encryptedStatePrefix marks a save file as encrypted
+const encryptedStatePrefix = "go-cloudflare-ddns-encrypted:v1:"
+
+//loadStateKey reads the -state-key-file and derives an AES-256 key from its contents.
+//Any file works as a key, eg one created with: head -c 32 /dev/urandom > state.key
+func (u *Updater) loadStateKey() (key []byte, err error) {
+
+	if u.cfg.StateKeyFile == "" {
+		return
+	}
+
+	data, err := ioutil.ReadFile(u.cfg.StateKeyFile)
+	if err != nil {
+		err = fmt.Errorf("Error reading state key file: %v", err)
+		return
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		err = fmt.Errorf("State key file '%v' is empty", u.cfg.StateKeyFile)
+		return
+	}
+
+	sum := sha256.Sum256(data)
+	key = sum[:]
+	return
+}
+
+//isEncryptedState reports whether saved data was written encrypted
+func isEncryptedState(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(encryptedStatePrefix))
+}
+
+//encryptState seals the saved data with AES-GCM
+func encryptState(key []byte, data []byte) (sealed []byte, err error) {
+
+	gcm, err := newStateCipher(key)
+	if err != nil {
+		return
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return
+	}
+
+	ciphertext := gcm.Seal(nonce, nonce, data, nil)
+
+	sealed = append([]byte(encryptedStatePrefix), base64.StdEncoding.EncodeToString(ciphertext)...)
+	return
+}
+
+//decryptState opens saved data sealed by encryptState
+func decryptState(key []byte, sealed []byte) (data []byte, err error) {
+
+	if key == nil {
+		err = fmt.Errorf("Saved data is encrypted but no -state-key-file was given")
+		return
+	}
+
+	ciphertext, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(sealed[len(encryptedStatePrefix):])))
+	if err != nil {
+		err = fmt.Errorf("Error decoding encrypted saved data: %v", err)
+		return
+	}
+
+	gcm, err := newStateCipher(key)
+	if err != nil {
+		return
+	}
+
+	if len(ciphertext) < gcm.NonceSize() {
+		err = fmt.Errorf("Encrypted saved data is truncated")
+		return
+	}
+
+	nonce, ciphertext := ciphertext[:gcm.NonceSize()], ciphertext[gcm.NonceSize():]
+	data, err = gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		err = fmt.Errorf("Could not decrypt saved data, check the state key file is the one it was saved with")
+	}
+	return
+}
+
+func newStateCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
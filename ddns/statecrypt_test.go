@@ -0,0 +1,101 @@
+package ddns
+
+import (
+	"bytes"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStateRoundTrip(t *testing.T) {
+
+	key := bytes.Repeat([]byte{7}, 32)
+	data := []byte(`{"ip":"203.0.113.10","zone":"example.com"}`)
+
+	sealed, err := encryptState(key, data)
+	if err != nil {
+		t.Fatalf("encryptState returned %v", err)
+	}
+	if !isEncryptedState(sealed) || bytes.Contains(sealed, []byte("203.0.113.10")) {
+		t.Fatalf("Sealed data isn't marked encrypted or holds the plain text: %s", sealed)
+	}
+	if again, _ := encryptState(key, data); bytes.Equal(again, sealed) {
+		t.Error("Sealing the same data twice gave the same output, so the nonce isn't random")
+	}
+
+	opened, err := decryptState(key, append(sealed, '\n'))
+	if err != nil {
+		t.Fatalf("decryptState returned %v", err)
+	}
+	if !bytes.Equal(opened, data) {
+		t.Errorf("Round trip gave %s, want %s", opened, data)
+	}
+}
+
+func TestDecryptStateFails(t *testing.T) {
+
+	key := bytes.Repeat([]byte{7}, 32)
+	sealed, err := encryptState(key, []byte("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(string(sealed[len(encryptedStatePrefix):]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ciphertext[len(ciphertext)-1] ^= 1
+	tampered := []byte(encryptedStatePrefix + base64.StdEncoding.EncodeToString(ciphertext))
+
+	tests := []struct {
+		name    string
+		key     []byte
+		sealed  []byte
+		wantErr string
+	}{
+		{"no key", nil, sealed, "no -state-key-file"},
+		{"wrong key", bytes.Repeat([]byte{8}, 32), sealed, "Could not decrypt"},
+		{"tampered", key, tampered, "Could not decrypt"},
+		{"not base64", key, []byte(encryptedStatePrefix + "!!"), "Error decoding"},
+		{"truncated", key, []byte(encryptedStatePrefix + "AAAA"), "truncated"},
+	}
+
+	for _, test := range tests {
+		if _, err := decryptState(test.key, test.sealed); err == nil || !strings.Contains(err.Error(), test.wantErr) {
+			t.Errorf("%v: decryptState returned %v, want an error containing %q", test.name, err, test.wantErr)
+		}
+	}
+}
+
+func TestLoadStateKey(t *testing.T) {
+
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "state.key")
+	emptyFile := filepath.Join(dir, "empty.key")
+	if err := os.WriteFile(keyFile, []byte("secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(emptyFile, []byte(" \n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		file    string
+		wantKey bool
+		wantErr bool
+	}{
+		{"", false, false},
+		{keyFile, true, false},
+		{emptyFile, false, true},
+		{filepath.Join(dir, "missing.key"), false, true},
+	}
+
+	for _, test := range tests {
+		u := &Updater{cfg: Config{StateKeyFile: test.file}}
+		key, err := u.loadStateKey()
+		if (err != nil) != test.wantErr || (len(key) == 32) != test.wantKey {
+			t.Errorf("loadStateKey(%q) returned a %d byte key and %v", test.file, len(key), err)
+		}
+	}
+}
@@ -0,0 +1,403 @@
+package ddns
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+//statsPeriod is how far back statistics are kept
+const statsPeriod = time.Hour * 24 * 30
+
+//Most IP changes and outages kept in the saved data, fewer in -low-memory mode
+const (
+	statsMaxEvents          = 500
+	statsMaxEventsLowMemory = 50
+)
+
+//statsData is the history behind the statistics, kept in the saved data so runs from cron build it up too
+type statsData struct {
+	//IPChanges are when each new WAN IP was first published
+	IPChanges []time.Time `json:"ipChanges,omitempty"`
+
+	//Days counts the host updates made and failed on each day
+	Days []statsDay `json:"days,omitempty"`
+
+	//LastPropagation is how long the last update checked took to propagate
+	LastPropagation time.Duration `json:"lastPropagation,omitempty"`
+
+	//Outages are the periods when runs kept failing, and OutageSince is when the current one started
+	Outages     []outage  `json:"outages,omitempty"`
+	OutageSince time.Time `json:"outageSince,omitzero"`
+
+	//StaleSince is when runs stopped leaving the records up to date with the IP, and StaleAlerted whether
+	//that has been notified, see -stale-after
+	StaleSince   time.Time `json:"staleSince,omitzero"`
+	StaleAlerted bool      `json:"staleAlerted,omitempty"`
+}
+
+//statsDay counts the host updates on a day, given as yyyy-mm-dd
+type statsDay struct {
+	Date     string `json:"date"`
+	Updates  int    `json:"updates"`
+	Failures int    `json:"failures"`
+
+	//Propagated counts updates the propagation check saw served by every resolver, taking PropagationSeconds in all,
+	//and NotPropagated those that weren't by the timeout
+	Propagated         int     `json:"propagated,omitempty"`
+	PropagationSeconds float64 `json:"propagationSeconds,omitempty"`
+	NotPropagated      int     `json:"notPropagated,omitempty"`
+}
+
+//outage is a period when runs failed, from the first failed run to the next successful one
+type outage struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+//Stats summarizes how stable the connection and the updates have been over the last 30 days
+type Stats struct {
+	//Since is the start of the period covered, the first run if that was less than 30 days ago
+	Since time.Time
+
+	//IPChanges is how many new IPs were published. AverageIPLifetime is how long an IP lasted on average,
+	//zero until the IP has changed twice, and CurrentIPAge how long ago the current one was published.
+	IPChanges         int
+	AverageIPLifetime time.Duration
+	CurrentIPAge      time.Duration
+
+	//Updates is how many host updates were attempted, and SuccessRatio the fraction of them that succeeded
+	Updates       int
+	FailedUpdates int
+	SuccessRatio  float64
+
+	//AveragePropagation is how long updates took to be served by the propagation check's resolvers on average,
+	//and LastPropagation how long the last one took. NotPropagated is how many weren't served within the timeout.
+	Propagated         int
+	AveragePropagation time.Duration
+	LastPropagation    time.Duration
+	NotPropagated      int
+
+	//LongestOutage is the longest period when runs kept failing, including one still going on.
+	//OutageSince is when the current outage started, zero if runs are succeeding.
+	Outages            int
+	LongestOutage      time.Duration
+	LongestOutageStart time.Time
+	OutageSince        time.Time
+
+	//StaleSince is when runs stopped leaving the records up to date with the IP, zero if they are up to date
+	StaleSince time.Time
+}
+
+//stats returns the statistics in the saved data, starting them if there are none yet
+func (d *saveDataDocument) stats() *statsData {
+	if d.Stats == nil {
+		d.Stats = &statsData{}
+	}
+	return d.Stats
+}
+
+//countUpdate adds a host's update to the day's counts. Skipped hosts aren't counted.
+func (u *Updater) countUpdate(saveData *saveDataDocument, r hostResult) {
+
+	if isSkip(r.Err) {
+		return
+	}
+
+	stats := saveData.stats()
+	date := r.Started.Format("2006-01-02")
+	if n := len(stats.Days); n == 0 || stats.Days[n-1].Date != date {
+		stats.Days = append(stats.Days, statsDay{Date: date})
+	}
+
+	day := &stats.Days[len(stats.Days)-1]
+	day.Updates++
+	if r.Err != nil {
+		day.Failures++
+	}
+}
+
+//countPropagation adds the result of a host's propagation check to the day's counts
+func (u *Updater) countPropagation(saveData *saveDataDocument, r hostResult) {
+
+	stats := saveData.stats()
+	date := r.Started.Format("2006-01-02")
+	if n := len(stats.Days); n == 0 || stats.Days[n-1].Date != date {
+		stats.Days = append(stats.Days, statsDay{Date: date})
+	}
+
+	day := &stats.Days[len(stats.Days)-1]
+	if r.Propagated {
+		day.Propagated++
+		day.PropagationSeconds += r.Propagation.Seconds()
+		stats.LastPropagation = r.Propagation
+	} else {
+		day.NotPropagated++
+	}
+}
+
+//recordRun notes a new WAN IP, the start or end of an outage and whether the records are stale after a run,
+//saving the data if any of them changed. Runs that change nothing don't write the saved data, so it isn't rewritten on every run.
+func (u *Updater) recordRun(saveData *saveDataDocument, previousIP string, runErr error, reconciled bool) {
+
+	now := time.Now()
+	stats := saveData.stats()
+	changed := false
+	defer u.keepStats(stats)
+
+	switch {
+	case runErr != nil && stats.OutageSince.IsZero():
+		stats.OutageSince = now
+		changed = true
+	case runErr == nil && !stats.OutageSince.IsZero():
+		stats.Outages = append(stats.Outages, outage{Start: stats.OutageSince, End: now})
+		stats.OutageSince = time.Time{}
+		changed = true
+	}
+
+	if runErr == nil && saveData.IP != "" && saveData.IP != previousIP {
+		stats.IPChanges = append(stats.IPChanges, now)
+		changed = true
+	}
+
+	if u.checkStale(stats, runErr == nil && reconciled, now) {
+		changed = true
+	}
+
+	if !changed {
+		return
+	}
+
+	u.trimStats(stats, now)
+	if err := u.setSaveData(*saveData); err != nil {
+		u.log.Print(err)
+	}
+}
+
+//trimStats drops history from before the statistics period, keeping the IP change before it to measure that IP's lifetime
+func (u *Updater) trimStats(stats *statsData, now time.Time) {
+
+	limit := statsMaxEvents
+	if u.cfg.LowMemory {
+		limit = statsMaxEventsLowMemory
+	}
+	from := now.Add(-statsPeriod)
+
+	for len(stats.IPChanges) > 1 && (stats.IPChanges[1].Before(from) || len(stats.IPChanges) > limit) {
+		stats.IPChanges = stats.IPChanges[1:]
+	}
+	for len(stats.Outages) > 0 && (stats.Outages[0].End.Before(from) || len(stats.Outages) > limit) {
+		stats.Outages = stats.Outages[1:]
+	}
+	for len(stats.Days) > 0 && stats.Days[0].Date < from.Format("2006-01-02") {
+		stats.Days = stats.Days[1:]
+	}
+}
+
+//keptStats is the statistics as of the last run, kept in memory so the metrics don't read the saved data while a run
+//may be writing it
+type keptStats struct {
+	mu   sync.Mutex
+	data *statsData
+}
+
+//keepStats keeps a copy of the statistics at the end of a run for the metrics
+func (u *Updater) keepStats(stats *statsData) {
+
+	kept := *stats
+	kept.IPChanges = slices.Clone(stats.IPChanges)
+	kept.Days = slices.Clone(stats.Days)
+	kept.Outages = slices.Clone(stats.Outages)
+
+	u.lastStats.mu.Lock()
+	defer u.lastStats.mu.Unlock()
+	u.lastStats.data = &kept
+}
+
+//keptStatsSummary returns the statistics as of the last run. Before the first they are read from the saved data,
+//once, as -exporter-only runs don't record any.
+func (u *Updater) keptStatsSummary() (stats Stats, err error) {
+
+	u.lastStats.mu.Lock()
+	defer u.lastStats.mu.Unlock()
+
+	if u.lastStats.data == nil {
+		saveData, loadErr := u.getSaveData()
+		if loadErr != nil {
+			return stats, loadErr
+		}
+		u.lastStats.data = saveData.stats()
+	}
+
+	return u.lastStats.data.summarize(time.Now()), nil
+}
+
+//Stats returns statistics from the saved data, without contacting Cloudflare
+func (u *Updater) Stats() (stats Stats, err error) {
+
+	saveData, err := u.getSaveData()
+	if err != nil {
+		return
+	}
+	return saveData.stats().summarize(time.Now()), nil
+}
+
+//summarize works out the statistics for the period up to now
+func (s statsData) summarize(now time.Time) (stats Stats) {
+
+	from := now.Add(-statsPeriod)
+	stats.Since = now
+	earliest := func(t time.Time) {
+		if t.Before(stats.Since) {
+			stats.Since = t
+		}
+	}
+
+	//Each IP lasted until the next change. The first may have been published before the period.
+	for i, changed := range s.IPChanges {
+		if changed.After(from) {
+			stats.IPChanges++
+			earliest(changed)
+		}
+		if i > 0 {
+			stats.AverageIPLifetime += changed.Sub(s.IPChanges[i-1])
+		}
+	}
+	if n := len(s.IPChanges); n > 1 {
+		stats.AverageIPLifetime /= time.Duration(n - 1)
+	}
+	if n := len(s.IPChanges); n > 0 {
+		stats.CurrentIPAge = now.Sub(s.IPChanges[n-1])
+	}
+
+	for _, day := range s.Days {
+		stats.Updates += day.Updates
+		stats.FailedUpdates += day.Failures
+		stats.Propagated += day.Propagated
+		stats.NotPropagated += day.NotPropagated
+		stats.AveragePropagation += time.Duration(day.PropagationSeconds * float64(time.Second))
+	}
+	if stats.Propagated > 0 {
+		stats.AveragePropagation /= time.Duration(stats.Propagated)
+	}
+	stats.LastPropagation = s.LastPropagation
+	if stats.Updates > 0 {
+		stats.SuccessRatio = float64(stats.Updates-stats.FailedUpdates) / float64(stats.Updates)
+	}
+
+	outages := s.Outages
+	if !s.OutageSince.IsZero() {
+		outages = append(outages[:len(outages):len(outages)], outage{Start: s.OutageSince, End: now})
+		stats.OutageSince = s.OutageSince
+	}
+	for _, o := range outages {
+		stats.Outages++
+		earliest(o.Start)
+		if d := o.End.Sub(o.Start); d > stats.LongestOutage {
+			stats.LongestOutage, stats.LongestOutageStart = d, o.Start
+		}
+	}
+
+	if stats.Since.Before(from) {
+		stats.Since = from
+	}
+	stats.StaleSince = s.StaleSince
+	return
+}
+
+//WriteStats writes the statistics to w for status -stats
+func (u *Updater) WriteStats(w io.Writer) (err error) {
+
+	stats, err := u.Stats()
+	if err != nil {
+		return
+	}
+
+	fmt.Fprintf(w, "Statistics since %v:\n", stats.Since.Format(time.RFC1123))
+	fmt.Fprintf(w, "  IP changes:          %d\n", stats.IPChanges)
+	if stats.AverageIPLifetime > 0 {
+		fmt.Fprintf(w, "  Average IP lifetime: %v\n", stats.AverageIPLifetime.Round(time.Minute))
+	} else {
+		fmt.Fprintln(w, "  Average IP lifetime: not known until the IP has changed")
+	}
+	fmt.Fprintf(w, "  Current IP age:      %v\n", stats.CurrentIPAge.Round(time.Minute))
+	if stats.Updates > 0 {
+		fmt.Fprintf(w, "  Updates:             %d, %d failed (%.1f%% succeeded)\n", stats.Updates, stats.FailedUpdates, stats.SuccessRatio*100)
+	} else {
+		fmt.Fprintln(w, "  Updates:             none")
+	}
+	if stats.Propagated+stats.NotPropagated > 0 {
+		fmt.Fprintf(w, "  Propagation:         %v on average, %v last time, %d not served within the timeout\n",
+			stats.AveragePropagation.Round(time.Second), stats.LastPropagation.Round(time.Second), stats.NotPropagated)
+	}
+	fmt.Fprintf(w, "  Outages:             %d\n", stats.Outages)
+	if stats.Outages > 0 {
+		fmt.Fprintf(w, "  Longest outage:      %v from %v\n", stats.LongestOutage.Round(time.Second), stats.LongestOutageStart.Format(time.RFC1123))
+	}
+	if !stats.OutageSince.IsZero() {
+		fmt.Fprintf(w, "  Failing since:       %v\n", stats.OutageSince.Format(time.RFC1123))
+	}
+	if !stats.StaleSince.IsZero() {
+		fmt.Fprintf(w, "  Stale since:         %v\n", stats.StaleSince.Format(time.RFC1123))
+	}
+
+	return
+}
+
+//MetricsHandler serves the statistics in the Prometheus text format, for scraping while running with an interval.
+//They are served from memory as of the last run, rather than read from the saved data on every scrape.
+func (u *Updater) MetricsHandler() http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		stats, err := u.keptStatsSummary()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		//With no updates there is no ratio, which Prometheus shows as NaN rather than a misleading 0
+		ratio := stats.SuccessRatio
+		if stats.Updates == 0 {
+			ratio = math.NaN()
+		}
+
+		outage := 0
+		if !stats.OutageSince.IsZero() {
+			outage = 1
+		}
+
+		var stale time.Duration
+		staleAlert := 0
+		if !stats.StaleSince.IsZero() {
+			stale = time.Since(stats.StaleSince)
+			if u.cfg.StaleAfter > 0 && stale >= u.cfg.StaleAfter {
+				staleAlert = 1
+			}
+		}
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		metric := func(name string, help string, value interface{}) {
+			fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %v\n", name, help, name, name, value)
+		}
+		metric("ddns_ip_changes", "New WAN IPs published in the last 30 days.", stats.IPChanges)
+		metric("ddns_ip_lifetime_average_seconds", "Average time a WAN IP lasted.", stats.AverageIPLifetime.Seconds())
+		metric("ddns_ip_age_seconds", "Time since the current WAN IP was published.", stats.CurrentIPAge.Seconds())
+		metric("ddns_updates", "Host updates attempted in the last 30 days.", stats.Updates)
+		metric("ddns_updates_failed", "Host updates that failed in the last 30 days.", stats.FailedUpdates)
+		metric("ddns_update_success_ratio", "Fraction of host updates in the last 30 days that succeeded.", ratio)
+		metric("ddns_propagation_average_seconds", "Average time for an update to be served by the propagation check's resolvers.", stats.AveragePropagation.Seconds())
+		metric("ddns_propagation_last_seconds", "Time for the last update checked to be served by the propagation check's resolvers.", stats.LastPropagation.Seconds())
+		metric("ddns_propagation_timeouts", "Updates not served by every resolver within the propagation timeout in the last 30 days.", stats.NotPropagated)
+		metric("ddns_outages", "Periods of failing runs in the last 30 days.", stats.Outages)
+		metric("ddns_outage_longest_seconds", "Longest period of failing runs in the last 30 days.", stats.LongestOutage.Seconds())
+		metric("ddns_outage_active", "1 if runs are currently failing.", outage)
+		metric("ddns_stale_seconds", "Time the records have gone without being brought up to date with the IP, 0 if they are up to date.", stale.Seconds())
+		metric("ddns_stale", "1 if the records have not been up to date for longer than -stale-after.", staleAlert)
+		u.writeCheckMetrics(w)
+	})
+}
@@ -0,0 +1,72 @@
+package ddns
+
+import (
+	"context"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/jonegerton/go-cloudflare-ddns/fakecf"
+)
+
+//countingStore counts the loads of the saved data
+type countingStore struct {
+	*FileStore
+	loads atomic.Int32
+}
+
+func (s *countingStore) Load() ([]byte, error) {
+	s.loads.Add(1)
+	return s.FileStore.Load()
+}
+
+func TestMetricsFromMemory(t *testing.T) {
+
+	fake := fakecf.New("203.0.113.10")
+	zoneID := fake.AddZone("example.com")
+	fake.AddRecord(zoneID, fakecf.Record{Type: "A", Name: "home.example.com", Content: "192.0.2.1", Comment: OwnerMarker})
+
+	store := &countingStore{FileStore: NewFileStore(filepath.Join(t.TempDir(), "saved.json"))}
+	u := testUpdater(t, fake, DefaultConfig(), WithHosts("home"), WithStateStore(store))
+	if err := u.RunOnce(context.Background()); err != nil {
+		t.Fatalf("Run returned %v", err)
+	}
+
+	loads := store.loads.Load()
+	for i := 0; i < 3; i++ {
+		rec := httptest.NewRecorder()
+		u.MetricsHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+		if rec.Code != 200 {
+			t.Fatalf("Scrape returned status %d: %v", rec.Code, rec.Body)
+		}
+		if !strings.Contains(rec.Body.String(), "\nddns_updates 1\n") {
+			t.Errorf("Scrape after the run doesn't count its update:\n%v", rec.Body)
+		}
+	}
+	if store.loads.Load() != loads {
+		t.Errorf("Scrapes read the saved data %d times, expected them served from memory", store.loads.Load()-loads)
+	}
+}
+
+func TestMetricsBeforeFirstRun(t *testing.T) {
+
+	fake := fakecf.New("203.0.113.10")
+	fake.AddZone("example.com")
+
+	store := &countingStore{FileStore: NewFileStore(filepath.Join(t.TempDir(), "saved.json"))}
+	u := testUpdater(t, fake, DefaultConfig(), WithHosts("home"), WithStateStore(store))
+
+	//Before any run the saved data is read once, eg for -exporter-only which doesn't record statistics
+	for i := 0; i < 3; i++ {
+		rec := httptest.NewRecorder()
+		u.MetricsHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+		if rec.Code != 200 {
+			t.Fatalf("Scrape returned status %d: %v", rec.Code, rec.Body)
+		}
+	}
+	if got := store.loads.Load(); got != 1 {
+		t.Errorf("Scrapes read the saved data %d times, expected once", got)
+	}
+}
@@ -0,0 +1,88 @@
+package ddns
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+//Status writes what is known from the saved data to w, without contacting Cloudflare
+func (u *Updater) Status(w io.Writer) (err error) {
+
+	saveData, err := u.getSaveData()
+	if err != nil {
+		return
+	}
+	if saveData.isEmpty() {
+		fmt.Fprintln(w, "No saved data yet - the utility has not completed a run in this folder.")
+		return
+	}
+
+	fmt.Fprintf(w, "Saved data:  %v\n", u.store)
+	fmt.Fprintf(w, "Zone id:     %v\n", saveData.ZoneID)
+	fmt.Fprintf(w, "WAN IP:      %v\n", saveData.IP)
+	if saveData.WriteFailures > 0 {
+		fmt.Fprintf(w, "Failed runs: %d, cooling down until %v\n", saveData.WriteFailures, saveData.CooldownUntil.Format(time.RFC1123))
+	}
+
+	if len(saveData.Hosts) > 0 {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "Published IPs:")
+		keys := make([]string, 0, len(saveData.Hosts))
+		for key := range saveData.Hosts {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fmt.Fprintf(w, "  %-40s %v\n", key, saveData.Hosts[key])
+		}
+	}
+
+	if len(saveData.SourceTrust) > 0 {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "IP source trust:")
+		specs := make([]string, 0, len(saveData.SourceTrust))
+		for spec := range saveData.SourceTrust {
+			specs = append(specs, spec)
+		}
+		sort.Strings(specs)
+		for _, spec := range specs {
+			trust := saveData.SourceTrust[spec]
+			state := fmt.Sprintf("%.0f%%", trust.Score*100)
+			if trust.quarantined() {
+				state = fmt.Sprintf("quarantined since %v, last gave %v", trust.Quarantined.Format(time.RFC1123), trust.Disagreed)
+			}
+			fmt.Fprintf(w, "  %-40s %v\n", spec, state)
+		}
+	}
+
+	if archived := archivedHosts(saveData, nil); len(archived) > 0 {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "Archived hosts, no longer in the host list:")
+		for _, a := range archived {
+			fmt.Fprintf(w, "  %v\n", a)
+		}
+	}
+
+	if d := saveData.Discovery; d != nil {
+		fmt.Fprintln(w)
+		fmt.Fprintf(w, "Found on first run (%v), zone %v:\n", d.Time.Format(time.RFC1123), d.Zone)
+		for _, record := range d.Records {
+			switch {
+			case record.Tunnel != "":
+				fmt.Fprintf(w, "  %v %v: served through tunnel %v\n", record.Type, record.Name, record.Tunnel)
+			case !record.Found:
+				fmt.Fprintf(w, "  %v %v: not found\n", record.Type, record.Name)
+			default:
+				state := "updated on first run"
+				if record.Current {
+					state = "already up to date"
+				}
+				fmt.Fprintf(w, "  %v %v: id %v, held %v (%v)\n", record.Type, record.Name, record.ID, record.Content, state)
+			}
+		}
+	}
+
+	return
+}
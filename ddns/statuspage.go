@@ -0,0 +1,186 @@
+package ddns
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+//statusPage is the content of status.json, and what index.html is rendered from
+type statusPage struct {
+	Generated  time.Time         `json:"generated"`
+	Zone       string            `json:"zone"`
+	IP         string            `json:"ip"`
+	LastChange time.Time         `json:"lastChange,omitzero"`
+	Healthy    bool              `json:"healthy"`
+	Failing    time.Time         `json:"failingSince,omitzero"`
+	Hosts      []statusPageHost  `json:"hosts"`
+	History    statusPageHistory `json:"history"`
+}
+
+//statusPageHost is a host and the IP last published for it
+type statusPageHost struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	IP   string `json:"ip"`
+}
+
+//statusPageHistory is the data for charts of the last 30 days: when the IP changed, and the updates on each day
+type statusPageHistory struct {
+	IPChanges []time.Time `json:"ipChanges"`
+	Days      []statsDay  `json:"days"`
+}
+
+//statusPageTemplate renders index.html. It has no scripts or external resources, so it can be served from anywhere.
+//The chart functions depend on the data, so are replaced when it is rendered.
+var statusPageTemplate = template.Must(template.New("status").Funcs(template.FuncMap{
+	"time":      func(t time.Time) string { return t.Format(time.RFC1123) },
+	"barsWidth": func(n int) int { return 0 },
+	"bar":       func(i int) int { return 0 },
+	"height":    func(n int) int { return 0 },
+	"top":       func(n int) int { return 0 },
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>DDNS status{{if .Zone}} - {{.Zone}}{{end}}</title>
+<style>
+body { font-family: sans-serif; max-width: 40em; margin: 2em auto; padding: 0 1em; color: #222; }
+table { border-collapse: collapse; width: 100%; }
+td, th { text-align: left; padding: 0.3em 0.5em; border-bottom: 1px solid #ddd; }
+.ok { color: #1a7f37; } .failing { color: #c62828; }
+.chart rect.updates { fill: #4a90d9; } .chart rect.failures { fill: #c62828; }
+small { color: #666; }
+</style>
+</head>
+<body>
+<h1>DDNS status{{if .Zone}} for {{.Zone}}{{end}}</h1>
+{{if .Healthy}}<p class="ok">Updating normally</p>{{else}}<p class="failing">Failing since {{time .Failing}}</p>{{end}}
+<table>
+<tr><th>Current IP</th><td>{{.IP}}</td></tr>
+{{if not .LastChange.IsZero}}<tr><th>Last changed</th><td>{{time .LastChange}}</td></tr>{{end}}
+<tr><th>IP changes (30 days)</th><td>{{len .History.IPChanges}}</td></tr>
+</table>
+<h2>Hosts</h2>
+<table>
+<tr><th>Name</th><th>Type</th><th>IP</th></tr>
+{{range .Hosts}}<tr><td>{{.Name}}</td><td>{{.Type}}</td><td>{{.IP}}</td></tr>
+{{end}}</table>
+{{with .History.Days}}<h2>Updates by day</h2>
+<svg class="chart" width="{{len . | barsWidth}}" height="104" role="img" aria-label="Updates by day">
+{{range $i, $day := .}}<g><title>{{$day.Date}}: {{$day.Updates}} updates, {{$day.Failures}} failed</title>
+<rect class="updates" x="{{bar $i}}" y="{{top $day.Updates}}" width="10" height="{{height $day.Updates}}"></rect>
+<rect class="failures" x="{{bar $i}}" y="{{top $day.Failures}}" width="10" height="{{height $day.Failures}}"></rect></g>
+{{end}}</svg>{{end}}
+<p><small>Generated {{time .Generated}} by go-cloudflare-ddns. The same data is in <a href="status.json">status.json</a>.</small></p>
+</body>
+</html>
+`))
+
+//writeStatusPage writes index.html and status.json to -status-page after a run
+func (u *Updater) writeStatusPage(saveData saveDataDocument) (err error) {
+
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("Error in writeStatusPage(): %v", err)
+		}
+	}()
+
+	page := u.newStatusPage(saveData, time.Now())
+
+	data, err := json.MarshalIndent(page, "", "  ")
+	if err != nil {
+		return
+	}
+
+	//Bars are scaled to the busiest day
+	busiest := 1
+	for _, day := range page.History.Days {
+		busiest = max(busiest, day.Updates)
+	}
+	height := func(n int) int { return n * 100 / busiest }
+	chart := template.FuncMap{
+		"barsWidth": func(n int) int { return n * 14 },
+		"bar":       func(i int) int { return i * 14 },
+		"height":    height,
+		"top":       func(n int) int { return 102 - height(n) },
+	}
+
+	var html bytes.Buffer
+	tmpl, err := statusPageTemplate.Clone()
+	if err != nil {
+		return
+	}
+	if err = tmpl.Funcs(chart).Execute(&html, page); err != nil {
+		return
+	}
+
+	if err = writeFileAtomic(filepath.Join(u.cfg.StatusPageDir, "status.json"), data); err != nil {
+		return
+	}
+	if err = writeFileAtomic(filepath.Join(u.cfg.StatusPageDir, "index.html"), html.Bytes()); err != nil {
+		return
+	}
+	u.logVerbose("Status page written to %s", u.cfg.StatusPageDir)
+
+	return
+}
+
+//newStatusPage gathers the status page's content from the saved data
+func (u *Updater) newStatusPage(saveData saveDataDocument, now time.Time) (page statusPage) {
+
+	stats := saveData.stats()
+
+	page = statusPage{
+		Generated: now,
+		Zone:      toUnicode(u.cfg.Zone),
+		IP:        saveData.IP,
+		Healthy:   stats.OutageSince.IsZero(),
+		Failing:   stats.OutageSince,
+		Hosts:     []statusPageHost{},
+		History: statusPageHistory{
+			IPChanges: []time.Time{},
+			Days:      []statsDay{},
+		},
+	}
+
+	from := now.Add(-statsPeriod)
+	for _, changed := range stats.IPChanges {
+		if changed.After(from) {
+			page.History.IPChanges = append(page.History.IPChanges, changed)
+		}
+		page.LastChange = changed
+	}
+	page.History.Days = append(page.History.Days, stats.Days...)
+
+	for key, ip := range saveData.Hosts {
+		recordType, name, _ := strings.Cut(key, ":")
+		page.Hosts = append(page.Hosts, statusPageHost{Name: toUnicode(name), Type: recordType, IP: ip})
+	}
+	sort.Slice(page.Hosts, func(i, j int) bool {
+		return page.Hosts[i].Name < page.Hosts[j].Name || (page.Hosts[i].Name == page.Hosts[j].Name && page.Hosts[i].Type < page.Hosts[j].Type)
+	})
+
+	return
+}
+
+//writeFileAtomic writes data to a temporary file and renames it over path, so a web server never serves half a file
+func writeFileAtomic(path string, data []byte) (err error) {
+
+	tmp := path + ".tmp"
+	if err = ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return
+	}
+	if err = os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+	}
+	return
+}
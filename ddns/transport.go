@@ -0,0 +1,161 @@
+package ddns
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+//newAPITransport returns the transport shared by every request to the Cloudflare API, and by notifications and health
+//checks. It negotiates HTTP/2 where it can, so the requests of a run share one connection, keeps connections open
+//between requests so the TCP and TLS handshakes aren't repeated, and asks for gzip compressed responses, which it decodes.
+//Brotli isn't asked for: the standard library has no decoder for it, and on the API's small JSON responses it would
+//save little over gzip, so it isn't worth a dependency.
+func newAPITransport() *http.Transport {
+	dialer := &net.Dialer{
+		Timeout:   time.Second * 10,
+		KeepAlive: time.Second * 30,
+	}
+	return &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		TLSHandshakeTimeout:   time.Second * 10,
+		MaxIdleConns:          10,
+		MaxIdleConnsPerHost:   4,
+		IdleConnTimeout:       time.Second * 90,
+		ExpectContinueTimeout: time.Second,
+		DisableCompression:    false,
+	}
+}
+
+//apiClient returns the http client for requests to the Cloudflare API, using the shared transport
+func (u *Updater) apiClient() *http.Client {
+
+	client := &http.Client{
+		Timeout:   time.Second * 10,
+		Transport: u.transport,
+	}
+	if u.cfg.TransportDebug {
+		client.Transport = &debugTransport{base: u.transport, stats: &u.transportStats, log: u.log.Printf}
+	}
+
+	return client
+}
+
+//transportStats counts how the requests of a run were made, for -transport-debug
+type transportStats struct {
+	mu sync.Mutex
+
+	Requests   int
+	NewConns   int
+	Reused     int
+	Compressed int
+	//Handshakes is the time spent in TLS handshakes
+	Handshakes time.Duration
+	//Protocols counts the responses by protocol, eg HTTP/2.0
+	Protocols map[string]int
+}
+
+//debugTransport logs how each request was made, the protocol, whether the connection was reused and whether the response
+//was compressed, and adds it to the run's statistics
+type debugTransport struct {
+	base  http.RoundTripper
+	stats *transportStats
+	log   func(format string, a ...interface{})
+}
+
+//RoundTrip sends the request, tracing the connection it is sent on
+func (t *debugTransport) RoundTrip(req *http.Request) (resp *http.Response, err error) {
+
+	var reused bool
+	var tlsStart time.Time
+	var handshake time.Duration
+	trace := &httptrace.ClientTrace{
+		GotConn:           func(info httptrace.GotConnInfo) { reused = info.Reused },
+		TLSHandshakeStart: func() { tlsStart = time.Now() },
+		TLSHandshakeDone:  func(tls.ConnectionState, error) { handshake = time.Since(tlsStart) },
+	}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+
+	started := time.Now()
+	resp, err = t.base.RoundTrip(req)
+	if err != nil {
+		return
+	}
+
+	t.stats.mu.Lock()
+	defer t.stats.mu.Unlock()
+	t.stats.Requests++
+	if reused {
+		t.stats.Reused++
+	} else {
+		t.stats.NewConns++
+	}
+	if resp.Uncompressed {
+		t.stats.Compressed++
+	}
+	t.stats.Handshakes += handshake
+	if t.stats.Protocols == nil {
+		t.stats.Protocols = make(map[string]int)
+	}
+	t.stats.Protocols[resp.Proto]++
+
+	connection := "new connection"
+	switch {
+	case reused:
+		connection = "reused connection"
+	case handshake > 0:
+		connection = fmt.Sprintf("new connection, TLS handshake %v", handshake.Round(time.Millisecond))
+	}
+	compression := "uncompressed"
+	if resp.Uncompressed {
+		compression = "gzip"
+	}
+	if t.log != nil {
+		t.log("Transport: %v %v over %v, %v, %v, %v", req.Method, req.URL.Path, resp.Proto, connection, compression, time.Since(started).Round(time.Millisecond))
+	}
+
+	return
+}
+
+//resetTransportStats starts counting the requests of a new run
+func (u *Updater) resetTransportStats() {
+	u.transportStats.mu.Lock()
+	defer u.transportStats.mu.Unlock()
+
+	u.transportStats.Requests, u.transportStats.NewConns, u.transportStats.Reused, u.transportStats.Compressed = 0, 0, 0, 0
+	u.transportStats.Handshakes, u.transportStats.Protocols = 0, nil
+}
+
+//logTransportStats logs how the run's requests to the Cloudflare API were made, for -transport-debug
+func (u *Updater) logTransportStats() {
+
+	if !u.cfg.TransportDebug {
+		return
+	}
+
+	u.transportStats.mu.Lock()
+	defer u.transportStats.mu.Unlock()
+
+	stats := &u.transportStats
+	if stats.Requests == 0 {
+		u.log.Print("Transport: no requests to Cloudflare this run.")
+		return
+	}
+
+	var protocols []string
+	for proto, count := range stats.Protocols {
+		protocols = append(protocols, fmt.Sprintf("%d over %v", count, proto))
+	}
+	sort.Strings(protocols)
+
+	u.log.Printf("Transport: %d requests (%v), %d new connections and %d reused, %d responses compressed, %v in TLS handshakes.",
+		stats.Requests, strings.Join(protocols, ", "), stats.NewConns, stats.Reused, stats.Compressed, stats.Handshakes.Round(time.Millisecond))
+}
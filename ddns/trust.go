@@ -0,0 +1,177 @@
+package ddns
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+//Events for notifications about IP sources
+const (
+	eventQuarantined = "source-quarantined"
+	eventReleased    = "source-released"
+)
+
+//trustWeight is how much each answer counts towards a source's trust score against its earlier answers. At 0.3 a
+//trusted source is quarantined after disagreeing twice in a row, so a single odd answer is forgiven.
+const trustWeight = 0.3
+
+//quarantineBelow is the trust score below which a source is quarantined
+const quarantineBelow = 0.5
+
+//releasedScore is the trust score a source is given when it agrees again after quarantine, so it is quarantined
+//straight away if it disagrees again
+const releasedScore = 0.6
+
+//sourceTrust is how far an IP source used with -wan-ip-peer is trusted, from how often it has agreed with the others
+type sourceTrust struct {
+	//Score is an exponentially weighted average of the source agreeing with the majority, from 0 to 1
+	Score float64 `json:"score"`
+
+	//Quarantined is when the source was quarantined, or last still disagreed when asked again. It isn't asked again
+	//until -peer-quarantine after.
+	Quarantined time.Time `json:"quarantined,omitzero"`
+	//Disagreed is the last IP it gave that disagreed with the majority
+	Disagreed string `json:"disagreed,omitempty"`
+}
+
+//quarantined reports whether the source is quarantined
+func (t sourceTrust) quarantined() bool {
+	return !t.Quarantined.IsZero()
+}
+
+//consensusIP asks the default IP source and each -wan-ip-peer, and returns the IP most of the trusted sources agree on,
+//weighted by their trust scores. Each source's score follows how often it agrees, and a source whose score falls below
+//quarantineBelow is quarantined and notified, so a source that breaks stops counting rather than dragging down every
+//later vote. Quarantined sources are asked again after -peer-quarantine, and released if they agree.
+//An error is returned if no IP has more than half of the trust of the sources that answered.
+//changed is true if the trust scores in the saved data changed, so they need saving.
+func (u *Updater) consensusIP(ctx context.Context, saveData *saveDataDocument) (ip string, changed bool, err error) {
+
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("Error in consensusIP(): %v", err)
+		}
+	}()
+
+	if saveData.SourceTrust == nil {
+		saveData.SourceTrust = make(map[string]sourceTrust)
+	}
+	now := time.Now()
+
+	specs := append([]string{u.cfg.IPSource}, u.cfg.PeerSources...)
+	for spec := range saveData.SourceTrust {
+		if !slices.Contains(specs, spec) {
+			delete(saveData.SourceTrust, spec)
+			changed = true
+		}
+	}
+
+	answers := make(map[string]string)
+	probation := make(map[string]string)
+	for _, spec := range specs {
+		trust, known := saveData.SourceTrust[spec]
+		if !known {
+			trust = sourceTrust{Score: 1}
+			saveData.SourceTrust[spec], changed = trust, true
+		}
+		if trust.quarantined() && now.Sub(trust.Quarantined) < u.cfg.PeerQuarantine {
+			u.logVerbose("IP source %s is quarantined until %v - not asking it.", spec, trust.Quarantined.Add(u.cfg.PeerQuarantine).Format(time.RFC1123))
+			continue
+		}
+
+		answer, detectErr := u.detectIP(ctx, spec)
+		if detectErr != nil {
+			u.log.Printf("IP source %s failed: %v", spec, detectErr)
+			continue
+		}
+		u.logVerbose("WAN IP from %s is: %s", spec, answer)
+		if trust.quarantined() {
+			probation[spec] = answer
+		} else {
+			answers[spec] = answer
+		}
+	}
+
+	if len(answers) == 0 {
+		return "", changed, fmt.Errorf("None of the trusted IP sources answered")
+	}
+
+	//Each answer counts for the trust in its source
+	total := 0.0
+	votes := make(map[string]float64)
+	for spec, answer := range answers {
+		votes[answer] += saveData.SourceTrust[spec].Score
+		total += saveData.SourceTrust[spec].Score
+	}
+	for answer, weight := range votes {
+		if weight > total/2 {
+			ip = answer
+		}
+	}
+	if ip == "" {
+		return "", changed, fmt.Errorf("IP sources disagree, with no majority - not updating: %v", describeAnswers(answers))
+	}
+	if len(votes) > 1 {
+		u.log.Printf("IP sources disagree, using %v given by the majority: %v", ip, describeAnswers(answers))
+	}
+
+	for spec, answer := range answers {
+		trust := saveData.SourceTrust[spec]
+		agreed := 0.0
+		if answer == ip {
+			agreed = 1
+		}
+		trust.Score = trustWeight*agreed + (1-trustWeight)*trust.Score
+		//The score only approaches 1, so a source agreeing from then on is treated as fully trusted
+		if trust.Score > 0.99 {
+			trust.Score = 1
+		}
+		if answer != ip {
+			trust.Disagreed = answer
+		}
+
+		if trust.Score < quarantineBelow {
+			trust.Quarantined = now
+			u.log.Printf("IP source %s keeps disagreeing, last giving %v rather than %v - quarantined until %v.", spec, answer, ip, now.Add(u.cfg.PeerQuarantine).Format(time.RFC1123))
+			u.notifyEvent(eventQuarantined, u.message(msgQuarantined, map[string]interface{}{"Source": spec, "Gave": answer, "Expected": ip, "Wait": u.cfg.PeerQuarantine}))
+		}
+
+		changed = changed || trust != saveData.SourceTrust[spec]
+		saveData.SourceTrust[spec] = trust
+	}
+
+	for spec, answer := range probation {
+		trust := saveData.SourceTrust[spec]
+		if answer == ip {
+			trust = sourceTrust{Score: releasedScore}
+			u.log.Printf("Quarantined IP source %s agrees with the others again - using it again.", spec)
+			u.notifyEvent(eventReleased, u.message(msgReleased, map[string]interface{}{"Source": spec}))
+		} else {
+			trust.Quarantined, trust.Disagreed = now, answer
+			u.logVerbose("Quarantined IP source %s still disagrees, giving %v rather than %v.", spec, answer, ip)
+		}
+		saveData.SourceTrust[spec], changed = trust, true
+	}
+
+	return
+}
+
+//describeAnswers lists the IP given by each source
+func describeAnswers(answers map[string]string) string {
+
+	specs := make([]string, 0, len(answers))
+	for spec := range answers {
+		specs = append(specs, spec)
+	}
+	sort.Strings(specs)
+
+	list := make([]string, 0, len(specs))
+	for _, spec := range specs {
+		list = append(list, fmt.Sprintf("%v from %v", answers[spec], spec))
+	}
+	return strings.Join(list, ", ")
+}
@@ -0,0 +1,99 @@
+package ddns
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/jonegerton/go-cloudflare-ddns/fakecf"
+)
+
+//echoSources serves an echo service for each IP source in a test, answering with the IP set for it
+type echoSources struct {
+	mu  sync.Mutex
+	ips []string
+}
+
+func (e *echoSources) set(ips ...string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.ips = ips
+}
+
+//start returns the URLs of n echo services, the ith answering with the ith IP set
+func (e *echoSources) start(t *testing.T, n int) (urls []string) {
+	for i := 0; i < n; i++ {
+		i := i
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			e.mu.Lock()
+			ip := e.ips[i]
+			e.mu.Unlock()
+			if ip == "" {
+				http.Error(w, "unavailable", http.StatusServiceUnavailable)
+				return
+			}
+			fmt.Fprintln(w, ip)
+		}))
+		t.Cleanup(srv.Close)
+		urls = append(urls, srv.URL)
+	}
+	return
+}
+
+func TestConsensusIP(t *testing.T) {
+
+	echo := &echoSources{}
+	urls := echo.start(t, 3)
+
+	fake := fakecf.New("203.0.113.10")
+	fake.AddZone("example.com")
+	cfg := DefaultConfig()
+	cfg.PeerSources = urls[1:]
+	u := testUpdater(t, fake, cfg, WithHosts("home"))
+	u.cfg.IPSource = urls[0]
+	//Quarantined sources are asked again on every poll
+	u.cfg.PeerQuarantine = 0
+
+	//Each poll's answers from the sources, then the IP agreed and the third source's trust afterwards.
+	//An empty answer is a source that fails.
+	polls := []struct {
+		answers         []string
+		want            string
+		wantScore       float64
+		wantQuarantined bool
+	}{
+		{[]string{"192.0.2.1", "192.0.2.1", "192.0.2.1"}, "192.0.2.1", 1, false},
+		{[]string{"192.0.2.1", "192.0.2.1", "198.51.100.1"}, "192.0.2.1", 0.7, false},
+		{[]string{"192.0.2.1", "192.0.2.1", "192.0.2.1"}, "192.0.2.1", 0.79, false},
+		{[]string{"192.0.2.1", "192.0.2.1", "198.51.100.1"}, "192.0.2.1", 0.553, false},
+		{[]string{"192.0.2.1", "192.0.2.1", "198.51.100.1"}, "192.0.2.1", 0.3871, true},
+		{[]string{"192.0.2.1", "192.0.2.1", "198.51.100.1"}, "192.0.2.1", 0.3871, true},
+		{[]string{"192.0.2.1", "192.0.2.1", "192.0.2.1"}, "192.0.2.1", releasedScore, false},
+		{[]string{"192.0.2.1", "", "198.51.100.1"}, "192.0.2.1", 0.42, true},
+		{[]string{"192.0.2.1", "198.51.100.1", ""}, "", 0.42, true},
+		{[]string{"", "", ""}, "", 0.42, true},
+	}
+
+	var saveData saveDataDocument
+	for i, poll := range polls {
+		echo.set(poll.answers...)
+		ip, _, err := u.consensusIP(context.Background(), &saveData)
+		if poll.want == "" && err == nil {
+			t.Errorf("Poll %d: consensusIP agreed on %v, want no majority", i, ip)
+		}
+		if poll.want != "" && (err != nil || ip != poll.want) {
+			t.Errorf("Poll %d: consensusIP returned %v, %v, want %v", i, ip, err, poll.want)
+		}
+
+		trust := saveData.SourceTrust[urls[2]]
+		if diff := trust.Score - poll.wantScore; diff > 0.001 || diff < -0.001 {
+			t.Errorf("Poll %d: score %v, want %v", i, trust.Score, poll.wantScore)
+		}
+		if trust.quarantined() != poll.wantQuarantined {
+			t.Errorf("Poll %d: quarantined %v, want %v", i, trust.quarantined(), poll.wantQuarantined)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package ddns
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//Cloudflare's TTL limits. 1 means automatic, and Enterprise zones can go lower than the rest.
+const (
+	ttlAuto          = 1
+	ttlMin           = 60
+	ttlMinEnterprise = 30
+	ttlMax           = 86400
+)
+
+//ParseTTL parses a TTL given as auto, a number of seconds, or a duration such as 5m or 1h, returning it in seconds.
+//It must be automatic or within the range Cloudflare allows for any plan. Zero is returned for an empty value,
+//meaning the record's TTL is left as it is.
+func ParseTTL(value string) (ttl int, err error) {
+
+	value = strings.ToLower(strings.TrimSpace(value))
+
+	switch value {
+	case "":
+		return 0, nil
+	case "auto":
+		return ttlAuto, nil
+	}
+
+	if ttl, err = strconv.Atoi(value); err != nil {
+		d, parseErr := time.ParseDuration(value)
+		if parseErr != nil || d%time.Second != 0 {
+			return 0, fmt.Errorf("TTL '%v' is not valid (expected auto, seconds or a duration such as 5m)", value)
+		}
+		ttl, err = int(d/time.Second), nil
+	}
+
+	if ttl != ttlAuto && (ttl < ttlMinEnterprise || ttl > ttlMax) {
+		return 0, fmt.Errorf("TTL '%v' is outside the range Cloudflare allows (auto, or %v to %v)", value, time.Duration(ttlMinEnterprise)*time.Second, time.Duration(ttlMax)*time.Second)
+	}
+
+	return
+}
+
+//zoneDetailsMessage is the response when getting a zone, with just its plan and account
+type zoneDetailsMessage struct {
+	Result struct {
+		Plan struct {
+			LegacyID string `json:"legacy_id"`
+		} `json:"plan"`
+		Account struct {
+			ID string `json:"id"`
+		} `json:"account"`
+	} `json:"result"`
+}
+
+//checkTTLs checks the TTLs of hosts are allowed on the zone's plan, so an invalid TTL is reported before anything is sent.
+//TTLs below the usual minimum are only allowed on Enterprise zones, so the plan is only looked up for those.
+func (u *Updater) checkTTLs(saveData *saveDataDocument, hosts []Host) (err error) {
+
+	for _, host := range hosts {
+		if host.TTL == ttlAuto || host.TTL == 0 || host.TTL >= ttlMin {
+			continue
+		}
+
+		if saveData.ZonePlan == "" && !saveData.canReadZone() {
+			u.logVerbose("The credentials can't read the zone's plan - sending the TTL of %v as it is.", host)
+			continue
+		}
+		if saveData.ZonePlan == "" {
+			var msg zoneDetailsMessage
+			if err = u.cfAPI("GET", "/zones/"+saveData.ZoneID, nil, &msg); err != nil {
+				return fmt.Errorf("Error in checkTTLs(): %v", err)
+			}
+			saveData.ZonePlan = msg.Result.Plan.LegacyID
+		}
+
+		if saveData.ZonePlan != "enterprise" {
+			return fmt.Errorf("Host entry %v has a TTL of %v, but the minimum on the %v plan is %v",
+				host, time.Duration(host.TTL)*time.Second, saveData.ZonePlan, time.Duration(ttlMin)*time.Second)
+		}
+	}
+
+	return
+}
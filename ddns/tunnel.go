@@ -0,0 +1,149 @@
+package ddns
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"strings"
+
+	"github.com/jonegerton/go-cloudflare-ddns/ipsource"
+)
+
+//Tunnel modes for -tunnel-mode
+const (
+	tunnelModeSkip   = "skip"
+	tunnelModeOrigin = "origin"
+)
+
+//tunnelSuffix ends the CNAME target of hostnames routed to a Cloudflare Tunnel, after the tunnel's id
+const tunnelSuffix = ".cfargotunnel.com"
+
+//errTunnel marks hosts that were not updated because they are served through a Cloudflare Tunnel
+var errTunnel = errors.New("served through a Cloudflare Tunnel")
+
+//validTunnelMode checks the -tunnel-mode value
+func validTunnelMode(mode string) error {
+	switch mode {
+	case tunnelModeSkip, tunnelModeOrigin:
+		return nil
+	}
+	return fmt.Errorf("Tunnel mode '%v' is not valid (expected %v or %v)", mode, tunnelModeSkip, tunnelModeOrigin)
+}
+
+//tunnelFor returns the id of the tunnel serving host, or an empty string if it isn't served through one.
+//A tunnel's public hostname is a proxied CNAME to <tunnel id>.cfargotunnel.com, so there is no address record to update.
+func (u *Updater) tunnelFor(zoneID string, host Host) (tunnelID string, err error) {
+
+	if host.Type != "A" && host.Type != "AAAA" {
+		return
+	}
+
+	var msg hostInfoResponseMessage
+	if err = u.cfAPI("GET", fmt.Sprintf("/zones/%s/dns_records?type=CNAME&name=%s", zoneID, host.Name), nil, &msg); err != nil {
+		err = fmt.Errorf("Error in tunnelFor(): %v", err)
+		return
+	}
+
+	for _, record := range msg.Result {
+		target := strings.ToLower(strings.TrimSuffix(record.Content, "."))
+		if strings.HasSuffix(target, tunnelSuffix) {
+			return strings.TrimSuffix(target, tunnelSuffix), nil
+		}
+	}
+
+	return
+}
+
+//tunnelConfigMessage is the response when getting a tunnel's configuration.
+//The configuration is kept as it is, so settings this utility doesn't know about are sent back unchanged.
+type tunnelConfigMessage struct {
+	Result struct {
+		Config map[string]interface{} `json:"config"`
+	} `json:"result"`
+}
+
+//updateTunnel handles a host served through the tunnel with the given id. It is skipped unless -tunnel-mode is origin,
+//in which case an ingress rule for the host pointing at a public IP is changed to ip.
+func (u *Updater) updateTunnel(saveData *saveDataDocument, host Host, tunnelID string, ip string) (err error) {
+
+	if u.cfg.TunnelMode != tunnelModeOrigin {
+		return fmt.Errorf("%w (tunnel %v), so it has no address record to update. "+
+			"Remove it from the hosts, or use -tunnel-mode=%v if the tunnel's origin is this IP", errTunnel, tunnelID, tunnelModeOrigin)
+	}
+
+	defer func() {
+		if err != nil && !errors.Is(err, errTunnel) {
+			err = fmt.Errorf("Error in updateTunnel(): %v", err)
+		}
+	}()
+
+	account := u.cfg.Account
+	if account == "" {
+		var msg zoneDetailsMessage
+		if err = u.cfAPI("GET", "/zones/"+saveData.ZoneID, nil, &msg); err != nil {
+			return
+		}
+		account = msg.Result.Account.ID
+	}
+
+	path := fmt.Sprintf("/accounts/%s/cfd_tunnel/%s/configurations", account, tunnelID)
+	var msg tunnelConfigMessage
+	if err = u.cfAPI("GET", path, nil, &msg); err != nil {
+		return
+	}
+
+	rules, _ := msg.Result.Config["ingress"].([]interface{})
+	for _, r := range rules {
+		rule, _ := r.(map[string]interface{})
+		hostname, _ := rule["hostname"].(string)
+		if !strings.EqualFold(hostname, host.Name) {
+			continue
+		}
+
+		service, _ := rule["service"].(string)
+		updated, ok := replaceOriginIP(service, ip)
+		if !ok {
+			return fmt.Errorf("%w (tunnel %v) and its origin %v is not a public IP, so there is nothing to update", errTunnel, tunnelID, service)
+		}
+		if updated == service {
+			u.log.Printf("Tunnel %v origin for %v is already %v", tunnelID, host, service)
+			return
+		}
+
+		rule["service"] = updated
+		if err = u.cfAPI("PUT", path, map[string]interface{}{"config": msg.Result.Config}, nil); err != nil {
+			return
+		}
+		u.log.Printf("Tunnel %v origin for %v updated from %v to %v", tunnelID, host, service, updated)
+		return
+	}
+
+	return fmt.Errorf("%w (tunnel %v) with no ingress rule for it, so there is nothing to update", errTunnel, tunnelID)
+}
+
+//replaceOriginIP returns the service URL with its host changed to ip, if the host is a public IP.
+//Services on local addresses or names, such as http://localhost:8080, reach the origin from inside the network
+//so don't change with the WAN IP.
+func replaceOriginIP(service string, ip string) (updated string, ok bool) {
+
+	origin, err := url.Parse(service)
+	if err != nil || origin.Host == "" {
+		return
+	}
+	addr, err := netip.ParseAddr(origin.Hostname())
+	if err != nil || !ipsource.IsPublic(addr) {
+		return
+	}
+
+	if port := origin.Port(); port != "" {
+		origin.Host = net.JoinHostPort(ip, port)
+	} else if strings.Contains(ip, ":") {
+		origin.Host = "[" + ip + "]"
+	} else {
+		origin.Host = ip
+	}
+
+	return origin.String(), true
+}
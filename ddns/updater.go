@@ -0,0 +1,565 @@
+//Package ddns keeps Cloudflare DNS records pointing at the public IP address of the network it runs on.
+//
+//It is the engine behind the go-cloudflare-ddns command, and can be embedded in other programs:
+//
+//	updater, err := ddns.New(
+//		ddns.WithToken(token),
+//		ddns.WithZone("example.com"),
+//		ddns.WithHosts("home.example.com", "vpn.example.com"),
+//		ddns.WithIPSource("stun"),
+//	)
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	err = updater.RunOnce(ctx)
+//
+//Everything the command line flags control is in Config, and can be set with WithConfig.
+package ddns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/netip"
+	"os"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/jonegerton/go-cloudflare-ddns/schedule"
+)
+
+//Config holds the settings for an Updater. Each field matches a command line flag of the same meaning.
+type Config struct {
+	//User and Key are the Cloudflare account email and Global API Key. Token is used instead if set.
+	User  string
+	Key   string
+	Token string
+
+	//Zone is the name of the zone holding the hosts. ZoneID skips looking it up.
+	//ZoneMatch is "active" to use the only active zone when the name matches several, or "strict" to always fail.
+	Zone      string
+	ZoneID    string
+	ZoneMatch string
+
+	//Account limits the zone lookup to one account, for members of several accounts with zones of the same name
+	Account string
+
+	//IPSource is the default IP source for hosts, see ipsource.Parse
+	IPSource string
+
+	//IPCommand is an executable printing the IP, used as the default IP source instead of IPSource
+	IPCommand string
+
+	//IPFilters are applied in order to each detected IP, see IPFilter
+	IPFilters []IPFilter
+
+	//PreferFamily is the address family to publish: "ipv4", "ipv6", or "any" to use whichever is detected.
+	//Address records are updated as A or AAAA to suit the IP.
+	PreferFamily string
+
+	Verbose bool
+
+	ConfirmWith string
+	CGNATCheck  bool
+
+	//PeerSources are IP sources asked alongside IPSource, which then gives the IP most of them agree on, see consensusIP
+	PeerSources []string
+	//PeerQuarantine is how long a source that keeps disagreeing with the others goes unasked before it is tried again
+	PeerQuarantine time.Duration
+
+	Retries int
+
+	//MaxChanges is the most records a run may change, stopping it before anything is sent if it would change more,
+	//unless OverrideMaxChanges is set. Zero is no limit.
+	MaxChanges         int
+	OverrideMaxChanges bool
+
+	//TTL is set on hosts that don't set their own, in seconds or 1 for automatic. Zero keeps each record's TTL.
+	TTL int
+
+	//ZoneCacheTTL is how long a zone id is used before looking it up again, and RecordCacheTTL how long a record's
+	//details are used without fetching them again. Zero for RecordCacheTTL always fetches them.
+	ZoneCacheTTL   time.Duration
+	RecordCacheTTL time.Duration
+
+	//IPCache is how long an IP detected from a source is used for later runs before detecting it again, while the
+	//local network is unchanged. It is trusted for less while the IP keeps changing. Zero detects it every run.
+	IPCache time.Duration
+
+	//Interval, RunOnStart and InitialDelay control Run. Jitter adds a random wait of up to that long before each run,
+	//and RetryInterval is the wait after a failed run, doubling with each failure in a row up to Interval.
+	Interval      time.Duration
+	RunOnStart    bool
+	InitialDelay  time.Duration
+	Jitter        time.Duration
+	RetryInterval time.Duration
+
+	//MaxRuntime bounds each run within Run, which is given up if it takes longer, leaving the rest for the next run
+	MaxRuntime time.Duration
+
+	StateKeyFile  string
+	TakeOwnership bool
+
+	//IaCMarkers are words in a record's comment or tags showing it is managed by infrastructure as code, eg terraform.
+	//Such records aren't changed unless OverrideIaC is set.
+	IaCMarkers  []string
+	OverrideIaC bool
+
+	//TunnelMode is what to do with hosts served through a Cloudflare Tunnel, which have no address record:
+	//"skip" them, or update the "origin" of the tunnel's ingress rule for them if it is a public IP.
+	TunnelMode string
+
+	LockRecord string
+	LockStale  time.Duration
+	InstanceID string
+
+	ScrapePattern   string
+	RouterUser      string
+	RouterPassword  string
+	RouterInsecure  bool
+	RouterInterface string
+
+	//InterfaceAllowPrivate lets interface sources publish a private or carrier-grade NAT address
+	InterfaceAllowPrivate bool
+
+	VerifyEvery int
+	ReportPath  string
+
+	//StatusPageDir is a directory to write index.html and status.json to after each run, for publishing with a web server
+	StatusPageDir string
+
+	UpdateAllMatching bool
+
+	FailoverIP    string
+	FailoverAfter time.Duration
+
+	//Cooldown is how long to leave Cloudflare alone after a run where every write failed, doubling with each
+	//failed run up to CooldownMax. Zero disables it.
+	Cooldown    time.Duration
+	CooldownMax time.Duration
+
+	//PropagationTimeout is how long to wait after updating for PropagationResolvers to serve the new IPs. Zero skips the check.
+	PropagationTimeout   time.Duration
+	PropagationResolvers []string
+
+	HealthCheckPort    int
+	HealthCheckURL     string
+	HealthCheckTimeout time.Duration
+
+	Notify []NotifyChannel
+
+	//NotifyRemind is how long after notifying a host's failure to send a reminder if it keeps failing the same way,
+	//doubling with each reminder up to NotifyRemindMax. Zero notifies every failure.
+	NotifyRemind    time.Duration
+	NotifyRemindMax time.Duration
+
+	//Staged writes the content each changed record would be given to its comment instead of changing it, for review
+	//in the dashboard before turning updates on
+	Staged bool
+
+	//VerifyOnly only checks the records hold the detected IP, notifying any that don't, and never writes to Cloudflare
+	VerifyOnly bool
+
+	//StaleAfter is how long the records can go without being brought up to date with the IP, for any reason,
+	//before a stale alert is sent to every notify channel. Zero disables the alert.
+	StaleAfter time.Duration
+
+	//APIBase is the root of the Cloudflare v4 API, changed to test against a fake such as the fake-server command
+	APIBase string
+
+	//UpdateWindows limits when changes are published, except to hosts whose old IP is unreachable. Empty is any time.
+	UpdateWindows []UpdateWindow
+
+	LowMemory bool
+
+	//Locale is the language of notifications, see Locales. NotifyTemplates is a JSON file of text/template templates
+	//replacing any of the notification texts, by message id.
+	Locale          string
+	NotifyTemplates string
+
+	//PayloadPatch is a JSON merge patch (RFC 7396) applied to the record sent to Cloudflare to create or update each
+	//host's record, eg {"proxied": true}, for record fields the updater doesn't set. See also Hooks.MutatePayload.
+	PayloadPatch string
+
+	//TransportDebug logs how each request to the Cloudflare API was made, and a summary after each run
+	TransportDebug bool
+
+	//FailAt fails the run at a step, "detection", "zone" or "update", and SimulateIP is published instead of the detected IP.
+	//Both are for rehearsing alerts and hooks, and are hidden from the command line usage.
+	FailAt     string
+	SimulateIP string
+}
+
+//DefaultConfig returns the settings used when none are given, the same as the command line defaults
+func DefaultConfig() Config {
+	hostname, _ := os.Hostname()
+	return Config{
+		IPSource:           "http://icanhazip.com",
+		APIBase:            "https://api.cloudflare.com/client/v4",
+		ZoneMatch:          zoneMatchActive,
+		PreferFamily:       familyIPv4,
+		TunnelMode:         tunnelModeSkip,
+		Retries:            2,
+		MaxChanges:         100,
+		RunOnStart:         true,
+		LockStale:          time.Minute * 15,
+		InstanceID:         hostname,
+		FailoverAfter:      time.Minute * 10,
+		Cooldown:           time.Minute,
+		ZoneCacheTTL:       time.Hour * 24,
+		RecordCacheTTL:     time.Minute,
+		IaCMarkers:         []string{"terraform", "opentofu", "pulumi"},
+		CooldownMax:        time.Minute * 30,
+		HealthCheckTimeout: time.Second * 5,
+		NotifyRemind:       time.Hour,
+
+		PropagationResolvers: []string{"1.1.1.1", "8.8.8.8", "9.9.9.9"},
+		NotifyRemindMax:      time.Hour * 24,
+		PeerQuarantine:       time.Hour * 24,
+		Locale:               defaultLocale,
+	}
+}
+
+//Updater checks the public IP and updates the hosts' records when it changes
+type Updater struct {
+	cfg   Config
+	hosts []Host
+	store StateStore
+	log   *log.Logger
+	hooks Hooks
+
+	//cache keeps API lookups between the steps of a run and between runs
+	cache *cache
+
+	//diag keeps recent log lines and API errors for support bundles
+	diag *diagnostics
+
+	//runID identifies the current run in logs and anything else reporting on it, after logPrefix, the prefix of
+	//the logger given to WithLogger
+	runID     string
+	logPrefix string
+
+	//mu stops runs overlapping when RunOnce is called from more than one goroutine
+	mu sync.Mutex
+
+	//checked is the outcome of the last -verify-only check, and lastStats the statistics as of the last run, for the metrics
+	checked   lastCheck
+	lastStats keptStats
+
+	//ipCache is the IP last detected from each source, kept for IPCache
+	ipCache map[string]cachedIP
+
+	//ctx is the context of the run under way, see runContext
+	ctx context.Context
+
+	//clockSkewed is set while the local clock is far from Cloudflare's, so it is only warned about once
+	clockSkewed bool
+
+	//transport is shared by requests to the Cloudflare API, notifications and health checks, so connections are
+	//reused, and transportStats counts how the run's requests to Cloudflare were made for -transport-debug
+	transport      *http.Transport
+	transportStats transportStats
+
+	//routerTransport is for routers with -router-insecure, made the first time one is used
+	routerTransport     *http.Transport
+	routerTransportOnce sync.Once
+
+	//payloadPatch is Config.PayloadPatch, parsed
+	payloadPatch map[string]interface{}
+
+	//templates are the notification texts for Config.Locale, by message id
+	templates map[string]*template.Template
+
+	//schedule runs the updates for Run, and can be triggered to run one early
+	schedule *schedule.Schedule
+}
+
+//Option configures an Updater
+type Option func(u *Updater) error
+
+//WithConfig replaces all of the settings. Give it before any other options, as it overwrites what they set.
+func WithConfig(cfg Config) Option {
+	return func(u *Updater) error {
+		u.cfg = cfg
+		return nil
+	}
+}
+
+//WithToken authenticates with a Cloudflare API token
+func WithToken(token string) Option {
+	return func(u *Updater) error {
+		u.cfg.Token = token
+		return nil
+	}
+}
+
+//WithKey authenticates with the account email and Global API Key
+func WithKey(email string, key string) Option {
+	return func(u *Updater) error {
+		u.cfg.User = email
+		u.cfg.Key = key
+		return nil
+	}
+}
+
+//WithZone sets the name of the zone holding the hosts
+func WithZone(zone string) Option {
+	return func(u *Updater) error {
+		u.cfg.Zone = zone
+		return nil
+	}
+}
+
+//WithHosts adds hosts in the same form as the -cfhost flag: name[,type=TXT][,content=...]
+func WithHosts(specs ...string) Option {
+	return func(u *Updater) error {
+		for _, spec := range specs {
+			host, err := ParseHost(spec)
+			if err != nil {
+				return err
+			}
+			u.hosts = append(u.hosts, host)
+		}
+		return nil
+	}
+}
+
+//WithHostEntries adds hosts that have already been parsed
+func WithHostEntries(hosts ...Host) Option {
+	return func(u *Updater) error {
+		u.hosts = append(u.hosts, hosts...)
+		return nil
+	}
+}
+
+//WithIPSource sets the default IP source, in the same form as the -wan-ip-source flag
+func WithIPSource(spec string) Option {
+	return func(u *Updater) error {
+		u.cfg.IPSource = spec
+		return nil
+	}
+}
+
+//WithStateStore keeps the saved data in store rather than the default file
+func WithStateStore(store StateStore) Option {
+	return func(u *Updater) error {
+		u.store = store
+		return nil
+	}
+}
+
+//WithLogger sends log output to logger's writer, with its prefix and flags. The logger itself isn't changed: the
+//updater logs through a logger of its own, adding the run id to the prefix and keeping recent lines for support bundles.
+func WithLogger(logger *log.Logger) Option {
+	return func(u *Updater) error {
+		u.log = logger
+		return nil
+	}
+}
+
+//New returns an Updater configured by opts, starting from DefaultConfig.
+//The settings are checked so problems show up before any run.
+func New(opts ...Option) (u *Updater, err error) {
+
+	u = &Updater{cfg: DefaultConfig(), cache: newCache(), transport: newAPITransport(), schedule: schedule.New(0)}
+
+	for _, opt := range opts {
+		if err = opt(u); err != nil {
+			return nil, err
+		}
+	}
+
+	if u.store == nil {
+		u.store = NewFileStore("go-cloudflare-ddns-saved.json")
+	}
+
+	//Recent log lines are kept for support bundles, except where memory is short
+	out, flags := io.Writer(os.Stderr), log.LstdFlags
+	if u.log != nil {
+		out, flags, u.logPrefix = u.log.Writer(), u.log.Flags(), u.log.Prefix()
+	}
+	if !u.cfg.LowMemory {
+		u.diag = &diagnostics{}
+		out = io.MultiWriter(out, u.diag)
+	}
+	u.log = log.New(out, u.logPrefix, flags)
+
+	if err = u.validate(); err != nil {
+		return nil, err
+	}
+
+	if u.cfg.LowMemory {
+		u.applyLowMemory()
+	}
+
+	return
+}
+
+//validate checks the settings make sense together
+func (u *Updater) validate() (err error) {
+
+	u.cfg.Zone = toASCII(strings.ToLower(strings.TrimSuffix(strings.TrimSpace(u.cfg.Zone), ".")))
+	u.hosts = u.normalizeHosts(u.hosts)
+
+	if u.cfg.ZoneMatch != zoneMatchActive && u.cfg.ZoneMatch != zoneMatchStrict {
+		return fmt.Errorf("Zone match '%v' is not valid (expected %v or %v)", u.cfg.ZoneMatch, zoneMatchActive, zoneMatchStrict)
+	}
+
+	if err = validFamily(u.cfg.PreferFamily); err != nil {
+		return
+	}
+
+	if err = validTunnelMode(u.cfg.TunnelMode); err != nil {
+		return
+	}
+
+	if err = u.validateSimulation(); err != nil {
+		return
+	}
+
+	u.cfg.APIBase = strings.TrimSuffix(u.cfg.APIBase, "/")
+	if !strings.HasPrefix(u.cfg.APIBase, "http://") && !strings.HasPrefix(u.cfg.APIBase, "https://") {
+		return fmt.Errorf("API base '%v' must be an http(s) URL", u.cfg.APIBase)
+	}
+
+	for i := range u.hosts {
+		if u.hosts[i].TTL == 0 {
+			u.hosts[i].TTL = u.cfg.TTL
+		}
+	}
+
+	if err = defaultSRVTargets(u.hosts); err != nil {
+		return
+	}
+	for _, host := range u.hosts {
+		if host.Source == "" {
+			continue
+		}
+		if _, err = u.newSource(host.Source); err != nil {
+			return fmt.Errorf("Host entry '%v' has an invalid source: %v", host.Name, err)
+		}
+	}
+
+	if u.cfg.FailoverIP != "" {
+		if addr, parseErr := netip.ParseAddr(u.cfg.FailoverIP); parseErr != nil || !addr.Is4() {
+			return fmt.Errorf("Failover IP '%v' is not an IPv4 address", u.cfg.FailoverIP)
+		}
+	}
+
+	if u.cfg.NotifyRemind > 0 && u.cfg.NotifyRemindMax < u.cfg.NotifyRemind {
+		return fmt.Errorf("Notify remind max %v is shorter than the first reminder %v", u.cfg.NotifyRemindMax, u.cfg.NotifyRemind)
+	}
+	if u.cfg.VerifyOnly && len(u.hosts) == 0 {
+		return errors.New("Verify only needs host entries to check")
+	}
+	if u.cfg.IPCommand != "" {
+		if u.cfg.IPSource != DefaultConfig().IPSource && u.cfg.IPSource != "command:"+u.cfg.IPCommand {
+			return fmt.Errorf("IP command '%v' and IP source '%v' are both set, use one or the other", u.cfg.IPCommand, u.cfg.IPSource)
+		}
+		u.cfg.IPSource = "command:" + u.cfg.IPCommand
+	}
+	if len(u.cfg.PeerSources) == 1 {
+		return errors.New("A single peer IP source can't outvote the IP source, give at least 2 (use -confirm-with to check against one)")
+	}
+	for _, spec := range u.cfg.PeerSources {
+		if spec == u.cfg.IPSource {
+			return fmt.Errorf("Peer IP source '%v' is the IP source itself", spec)
+		}
+		if _, err = u.newSource(spec); err != nil {
+			return fmt.Errorf("Peer IP source '%v' is invalid: %v", spec, err)
+		}
+	}
+	if len(u.cfg.PeerSources) > 0 && u.cfg.PeerQuarantine <= 0 {
+		return fmt.Errorf("Peer quarantine %v must be positive", u.cfg.PeerQuarantine)
+	}
+	if err = u.loadMessages(); err != nil {
+		return
+	}
+	if u.payloadPatch, err = parsePayloadPatch(u.cfg.PayloadPatch); err != nil {
+		return
+	}
+	if u.cfg.Jitter < 0 {
+		return fmt.Errorf("Jitter %v must not be negative", u.cfg.Jitter)
+	}
+	if u.cfg.RetryInterval < 0 {
+		return fmt.Errorf("Retry interval %v must not be negative", u.cfg.RetryInterval)
+	}
+	if u.cfg.IPCache < 0 {
+		return fmt.Errorf("IP cache %v must not be negative", u.cfg.IPCache)
+	}
+	if u.cfg.MaxChanges < 0 {
+		return fmt.Errorf("Max changes %v must not be negative", u.cfg.MaxChanges)
+	}
+	if u.cfg.StaleAfter < 0 {
+		return fmt.Errorf("Stale after %v must not be negative", u.cfg.StaleAfter)
+	}
+
+	if u.cfg.StatusPageDir != "" {
+		if info, statErr := os.Stat(u.cfg.StatusPageDir); statErr != nil || !info.IsDir() {
+			return fmt.Errorf("Status page directory '%v' does not exist", u.cfg.StatusPageDir)
+		}
+	}
+
+	if err = validPropagationResolvers(u.cfg.PropagationResolvers); err != nil {
+		return
+	}
+	if u.cfg.PropagationTimeout > 0 && len(u.cfg.PropagationResolvers) == 0 {
+		return errors.New("A propagation timeout is set but there are no propagation resolvers")
+	}
+
+	if u.cfg.ZoneCacheTTL <= 0 {
+		return fmt.Errorf("Zone cache TTL %v must be more than zero", u.cfg.ZoneCacheTTL)
+	}
+	if u.cfg.RecordCacheTTL < 0 {
+		return fmt.Errorf("Record cache TTL %v must not be negative", u.cfg.RecordCacheTTL)
+	}
+
+	if u.cfg.Cooldown > 0 && u.cfg.CooldownMax < u.cfg.Cooldown {
+		return fmt.Errorf("Cooldown max %v is shorter than the cooldown %v", u.cfg.CooldownMax, u.cfg.Cooldown)
+	}
+
+	if u.cfg.ReportPath != "" {
+		if err = u.reportPathUsable(); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+//checkRequired checks the settings needed to update records are present.
+//Left out of New so commands only reading the saved data, like Status, don't need them.
+func (u *Updater) checkRequired() error {
+
+	if err := u.checkCredentials(); err != nil {
+		return err
+	}
+	if len(u.hosts) == 0 && !u.cfg.UpdateAllMatching {
+		return errors.New("At least one host is required")
+	}
+
+	return nil
+}
+
+//checkCredentials checks the settings needed to use the zone are present
+func (u *Updater) checkCredentials() error {
+
+	if u.cfg.Token == "" && (u.cfg.User == "" || u.cfg.Key == "") {
+		return errors.New("Cloudflare credentials are required: a token, or an email and key")
+	}
+	if u.cfg.Zone == "" {
+		return errors.New("A zone is required")
+	}
+
+	return nil
+}
+
+//Hosts returns the hosts being kept up to date
+func (u *Updater) Hosts() []Host {
+	return u.hosts
+}
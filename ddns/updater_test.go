@@ -0,0 +1,82 @@
+package ddns
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jonegerton/go-cloudflare-ddns/fakecf"
+)
+
+//testWriter sends log output to the test's log, so it is shown for failing tests
+type testWriter struct {
+	t *testing.T
+}
+
+func (w testWriter) Write(p []byte) (int, error) {
+	w.t.Log(strings.TrimSuffix(string(p), "\n"))
+	return len(p), nil
+}
+
+//testUpdater returns an Updater using the fake API and its echo service, with saved data in a temporary directory.
+//The zone is example.com, which the fake must hold.
+func testUpdater(t *testing.T, fake *fakecf.Server, cfg Config, opts ...Option) *Updater {
+
+	srv := httptest.NewServer(fake.Handler())
+	t.Cleanup(srv.Close)
+
+	cfg.APIBase = srv.URL + fakecf.APIPath
+	cfg.IPSource = srv.URL + fakecf.IPPath
+	cfg.Token = "fake"
+	cfg.Zone = "example.com"
+
+	opts = append([]Option{
+		WithConfig(cfg),
+		WithStateStore(NewFileStore(filepath.Join(t.TempDir(), "saved.json"))),
+		WithLogger(log.New(testWriter{t}, "", 0)),
+	}, opts...)
+
+	u, err := New(opts...)
+	if err != nil {
+		t.Fatalf("New returned %v", err)
+	}
+	return u
+}
+
+//recordContent returns what the record with the name holds in the fake's zone
+func recordContent(fake *fakecf.Server, zoneID string, name string) string {
+	for _, record := range fake.Records(zoneID) {
+		if record.Name == name {
+			return record.Content
+		}
+	}
+	return ""
+}
+
+func TestWithLoggerLeftAlone(t *testing.T) {
+
+	fake := fakecf.New("203.0.113.10")
+	zoneID := fake.AddZone("example.com")
+	fake.AddRecord(zoneID, fakecf.Record{Type: "A", Name: "home.example.com", Content: "192.0.2.1", Comment: OwnerMarker})
+
+	var out bytes.Buffer
+	logger := log.New(&out, "ddns: ", 0)
+	u := testUpdater(t, fake, DefaultConfig(), WithHosts("home"), WithLogger(logger))
+	if err := u.RunOnce(context.Background()); err != nil {
+		t.Fatalf("Run returned %v", err)
+	}
+
+	if logger.Prefix() != "ddns: " || logger.Flags() != 0 || logger.Writer() != &out {
+		t.Errorf("The logger given was changed: prefix %q, flags %d", logger.Prefix(), logger.Flags())
+	}
+	if !strings.Contains(out.String(), "ddns: run="+u.runID+" ") {
+		t.Errorf("The run's log lines weren't written to the logger's writer with its prefix and the run id:\n%v", out.String())
+	}
+	if u.diag == nil || len(u.diag.snapshot().Log) == 0 {
+		t.Error("The run's log lines weren't kept for support bundles")
+	}
+}
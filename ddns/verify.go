@@ -0,0 +1,89 @@
+package ddns
+
+import (
+	"errors"
+	"fmt"
+)
+
+//errRecordNotFound is returned when no DNS record matches a host entry
+var errRecordNotFound = errors.New("Error reading host id")
+
+//verifyRecords fetches each record and checks it holds the content for the current IP.
+//Missing records are recreated, and records with the wrong content are returned to be updated.
+func (u *Updater) verifyRecords(saveData *saveDataDocument, hosts []Host, ips map[string]string) (changed []Host, err error) {
+
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("Error in verifyRecords(): %v", err)
+		}
+	}()
+
+	if err = u.resolveZoneID(saveData); err != nil {
+		return
+	}
+
+	u.logVerbose("Verifying records")
+
+	for _, host := range hosts {
+		ip := ips[u.sourceOf(host)]
+
+		//The point is to see what the record holds now, so not what was cached
+		u.cache.remove(recordCacheKey(saveData.ZoneID, host))
+		hostData, getErr := u.getHostData(saveData.ZoneID, host)
+		if errors.Is(getErr, errRecordNotFound) {
+			tunnelID, tunnelErr := u.tunnelFor(saveData.ZoneID, host)
+			if tunnelErr != nil {
+				err = tunnelErr
+				return
+			}
+			if tunnelID != "" {
+				u.logVerbose("Record %v is served through tunnel %v - not recreating it.", host, tunnelID)
+				continue
+			}
+			u.log.Printf("Record %v is missing - recreating it.", host)
+			changeID := newChangeID()
+			recordID, createErr := u.createRecord(saveData.ZoneID, host, ip, changeID)
+			u.recordChange(saveData, changeEntry{ID: changeID, Action: changeCreate, Type: host.Type, Name: host.Name, RecordID: recordID, New: host.render(ip)}, createErr)
+			if err = createErr; err != nil {
+				return
+			}
+			saveData.setHostIP(host, ip)
+			continue
+		}
+		if getErr != nil {
+			err = getErr
+			return
+		}
+
+		if !host.matches(hostData, ip) {
+			u.log.Printf("Record %v does not hold the current value - updating it.", host)
+			changed = append(changed, host)
+		}
+	}
+
+	return
+}
+
+//createRecord adds a new record for host, with automatic ttl and not proxied, returning its id.
+//The comment notes changeID, the id of the change in the change history.
+func (u *Updater) createRecord(zoneID string, host Host, ip string, changeID string) (recordID string, err error) {
+
+	payload, err := u.recordPayload(host, newUpdateRequestBody(hostData{TTL: 1}, host, ip, changeID))
+	if err != nil {
+		err = fmt.Errorf("Error in createRecord(): %v", err)
+		return
+	}
+
+	var msg struct {
+		Result struct {
+			ID string `json:"id"`
+		} `json:"result"`
+	}
+	err = u.cfAPI("POST", fmt.Sprintf("/zones/%s/dns_records", zoneID), payload, &msg)
+	if err != nil {
+		err = fmt.Errorf("Error in createRecord(): %v", err)
+		return
+	}
+
+	return msg.Result.ID, nil
+}
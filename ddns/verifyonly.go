@@ -0,0 +1,148 @@
+package ddns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+//Drift found by -verify-only
+var (
+	errDrift         = errors.New("the record doesn't hold the detected IP")
+	errDriftNotFound = errors.New("the record is missing")
+)
+
+//verifyOnce checks the records hold the detected IP without changing anything, for -verify-only. Drift is notified like a
+//failed update, held back when repeated in the same way, and notified again when the record matches. It works with a
+//read-only token, and writes nothing to Cloudflare, so can run as a watchdog next to another updater.
+//An error is returned if any record doesn't match. The outcome is kept for the metrics.
+func (u *Updater) verifyOnce(ctx context.Context) (err error) {
+
+	unlock, err := u.store.Lock()
+	if err != nil {
+		return
+	}
+	defer unlock()
+
+	saveData, err := u.getSaveData()
+	if err != nil {
+		return
+	}
+
+	return u.verifyWith(ctx, saveData)
+}
+
+//verifyWith checks the records against the detected IP as verifyOnce does, with the saved data already loaded and locked
+func (u *Updater) verifyWith(ctx context.Context, saveData saveDataDocument) (err error) {
+
+	var ips map[string]string
+	var records []recordCheck
+	checked := false
+	defer func() {
+		if checked {
+			u.setLastCheck(ips, records, nil)
+		} else {
+			u.setLastCheck(ips, records, err)
+		}
+	}()
+
+	ips, stateChanged, err := u.getWANIPs(ctx, &saveData, u.hosts)
+	if err != nil {
+		return
+	}
+	if u.cfg.SimulateIP == "" {
+		filtersChanged := false
+		if filtersChanged, err = u.applyIPFilters(&saveData, ips); err != nil {
+			return
+		}
+		stateChanged = stateChanged || filtersChanged
+	}
+	hosts := u.routeByFamily(u.hosts, ips)
+
+	zoneID, zoneIDExpires := saveData.ZoneID, saveData.ZoneIDExpires
+	if err = u.resolveZoneID(&saveData); err != nil {
+		return
+	}
+
+	var results []hostResult
+	var drifted []string
+	for _, host := range hosts {
+		ip := ips[u.sourceOf(host)]
+		started := time.Now()
+
+		//The point is to see what the record holds now, so not what was cached
+		u.cache.remove(recordCacheKey(saveData.ZoneID, host))
+		current, getErr := u.getHostData(saveData.ZoneID, host)
+		if errors.Is(getErr, errZoneInvalid) {
+			if err = u.reresolveZoneID(&saveData); err != nil {
+				return
+			}
+			current, getErr = u.getHostData(saveData.ZoneID, host)
+		}
+
+		var driftErr error
+		switch {
+		case errors.Is(getErr, errRecordNotFound):
+			tunnelID, tunnelErr := u.tunnelFor(saveData.ZoneID, host)
+			if tunnelErr != nil {
+				return tunnelErr
+			}
+			if tunnelID != "" {
+				u.logVerbose("Record %v is served through tunnel %v - not checking it.", host, tunnelID)
+				continue
+			}
+			driftErr = errDriftNotFound
+		case getErr != nil:
+			return getErr
+		case !host.matches(current, ip):
+			driftErr = errDrift
+		}
+
+		published := current.Content
+		if host.Type == "SRV" {
+			published = current.Data.Target
+		}
+		r := newHostResult(host, "", published, ip, started, driftErr)
+		r.Checked = true
+		records = append(records, recordCheck{Host: host, Published: published, Drift: driftErr})
+
+		switch {
+		case driftErr == errDriftNotFound:
+			u.log.Printf("Record %v is missing, expected it to hold %v.", host, host.render(ip))
+			drifted = append(drifted, fmt.Sprintf("%v: %v", host, driftErr))
+		case driftErr != nil:
+			u.log.Printf("Record %v holds %v, expected %v.", host, published, host.render(ip))
+			drifted = append(drifted, fmt.Sprintf("%v: %v", host, driftErr))
+		default:
+			u.logVerbose("Record %v holds the detected IP.", host)
+		}
+
+		//Only drift and records matching again after drifting are notified, not every record that matches
+		r = u.checkRepeat(&saveData, r)
+		if r.Err == nil && r.Note == "" {
+			r.Notify = false
+		}
+		results = append(results, r)
+		u.notifyImmediate(r)
+
+		//checkRepeat only changes what was notified when it notifies
+		stateChanged = stateChanged || (r.Notify && (r.Err != nil || r.Note != ""))
+	}
+	u.notifyDigest(results)
+
+	if stateChanged || saveData.ZoneID != zoneID || !saveData.ZoneIDExpires.Equal(zoneIDExpires) {
+		if err = u.setSaveData(saveData); err != nil {
+			return
+		}
+	}
+
+	checked = true
+	if len(drifted) > 0 {
+		return fmt.Errorf("%d of %d records don't match the detected IP:\n  - %v", len(drifted), len(results), strings.Join(drifted, "\n  - "))
+	}
+	u.log.Print("Records match the detected IP.")
+
+	return
+}
@@ -0,0 +1,152 @@
+package ddns
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+//UpdateWindow is a time of day when changes may be published, parsed from an -update-window value of the form HH:MM-HH:MM.
+//Times are local, and a window ending before it starts runs past midnight.
+type UpdateWindow struct {
+	Start time.Duration
+	End   time.Duration
+}
+
+//String returns the window in the form it was given
+func (w UpdateWindow) String() string {
+	clock := func(d time.Duration) string {
+		return fmt.Sprintf("%02d:%02d", int(d.Hours()), int(d.Minutes())%60)
+	}
+	return clock(w.Start) + "-" + clock(w.End)
+}
+
+//contains reports whether t falls within the window
+func (w UpdateWindow) contains(t time.Time) bool {
+	since := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	if w.Start <= w.End {
+		return since >= w.Start && since < w.End
+	}
+	return since >= w.Start || since < w.End
+}
+
+//ParseUpdateWindows parses the -update-window values
+func ParseUpdateWindows(values []string) (windows []UpdateWindow, err error) {
+
+	for _, value := range values {
+		parts := strings.Split(value, "-")
+		if len(parts) != 2 {
+			err = fmt.Errorf("Update window '%v' is not valid (expected HH:MM-HH:MM)", value)
+			return
+		}
+
+		var window UpdateWindow
+		if window.Start, err = parseClock(parts[0]); err == nil {
+			window.End, err = parseClock(parts[1])
+		}
+		if err != nil {
+			err = fmt.Errorf("Update window '%v' is not valid: %v", value, err)
+			return
+		}
+		if window.Start == window.End {
+			err = fmt.Errorf("Update window '%v' is empty", value)
+			return
+		}
+
+		windows = append(windows, window)
+	}
+
+	return
+}
+
+//parseClock parses a time of day as HH:MM, returning the time since midnight
+func parseClock(value string) (since time.Duration, err error) {
+
+	hm := strings.Split(strings.TrimSpace(value), ":")
+	if len(hm) != 2 {
+		return 0, fmt.Errorf("'%v' is not a time (expected HH:MM)", value)
+	}
+	hours, hoursErr := strconv.Atoi(hm[0])
+	minutes, minutesErr := strconv.Atoi(hm[1])
+	if hoursErr != nil || minutesErr != nil || hours < 0 || hours > 24 || minutes < 0 || minutes > 59 || (hours == 24 && minutes != 0) {
+		return 0, fmt.Errorf("'%v' is not a time (expected HH:MM)", value)
+	}
+
+	return time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute, nil
+}
+
+//inUpdateWindow reports whether changes may be published now. With no windows they always may.
+func (u *Updater) inUpdateWindow(now time.Time) bool {
+	if len(u.cfg.UpdateWindows) == 0 {
+		return true
+	}
+	for _, window := range u.cfg.UpdateWindows {
+		if window.contains(now) {
+			return true
+		}
+	}
+	return false
+}
+
+//windowHosts returns the hosts to update outside the update windows: those whose old IP no longer reaches us,
+//so there is nothing to disrupt by changing them. The rest are left until a window opens.
+func (u *Updater) windowHosts(saveData saveDataDocument, changed []Host) (due []Host) {
+
+	reachable := make(map[string]bool)
+
+	for _, host := range changed {
+		oldIP := u.hostIP(saveData, host)
+
+		if oldIP != "" {
+			up, done := reachable[oldIP]
+			if !done {
+				up = u.oldIPReachable(oldIP)
+				reachable[oldIP] = up
+			}
+			if up {
+				u.log.Printf("Not updating %v yet: outside the update window (%v) and the old IP %v is still reachable", host, u.windowList(), oldIP)
+				continue
+			}
+		}
+
+		u.logVerbose("Updating %v outside the update window as the old IP '%v' is unreachable", host, oldIP)
+		due = append(due, host)
+	}
+
+	return
+}
+
+//oldIPReachable reports whether anything still answers on ip. The health check is used if set up,
+//otherwise ports 80 and 443 are tried, and a refused connection counts as reachable as something answered.
+func (u *Updater) oldIPReachable(ip string) bool {
+
+	if u.cfg.HealthCheckPort > 0 {
+		return u.healthCheck(ip) == nil
+	}
+
+	for _, port := range []string{"80", "443"} {
+		conn, err := net.DialTimeout("tcp", net.JoinHostPort(ip, port), u.cfg.HealthCheckTimeout)
+		if err == nil {
+			conn.Close()
+			return true
+		}
+		if errors.Is(err, syscall.ECONNREFUSED) {
+			return true
+		}
+	}
+
+	return false
+}
+
+//windowList describes the update windows for logging
+func (u *Updater) windowList() string {
+	var list []string
+	for _, window := range u.cfg.UpdateWindows {
+		list = append(list, window.String())
+	}
+	return strings.Join(list, ", ")
+}
@@ -0,0 +1,77 @@
+package ddns
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+//errZoneInvalid is returned when the API says a zone scoped request has no such zone, or rejects reading from it with
+//400 or 404 and no reason, which happens when the cached zone id no longer exists
+var errZoneInvalid = errors.New("Cloudflare API rejected the zone id")
+
+//zoneMatchActive and zoneMatchStrict are the -zone-match settings
+const (
+	zoneMatchActive = "active"
+	zoneMatchStrict = "strict"
+)
+
+//selectZone picks the zone to use from those matching the zone name.
+//The same name can match more than one zone, eg through membership of several accounts,
+//or a zone added again while the old one is still pending. With -zone-match=active the only active zone is used.
+//Otherwise, or if there is still more than one, it's an error listing them, rather than picking one that may be wrong.
+func (u *Updater) selectZone(zones []zoneInfo) (zoneID string, err error) {
+
+	switch len(zones) {
+	case 0:
+		err = fmt.Errorf("No zone named %v was found", toUnicode(u.cfg.Zone))
+		return
+	case 1:
+		zoneID = zones[0].ID
+		return
+	}
+
+	if u.cfg.ZoneMatch == zoneMatchActive {
+		var active []zoneInfo
+		for _, zone := range zones {
+			if zone.Status == "active" {
+				active = append(active, zone)
+			}
+		}
+		if len(active) == 1 {
+			u.log.Printf("Zone %v matches %d zones - using the only active one, %v.", toUnicode(u.cfg.Zone), len(zones), active[0].ID)
+			zoneID = active[0].ID
+			return
+		}
+	}
+
+	var candidates []string
+	for _, zone := range zones {
+		candidates = append(candidates, fmt.Sprintf("  %v: %v, account %v (%v)", zone.ID, zone.Status, zone.Account.Name, zone.Account.ID))
+	}
+	err = fmt.Errorf("Zone %v matches %d zones - set -cfaccount to the account to look in, or -cfzone-id to the zone to use:\n%v", toUnicode(u.cfg.Zone), len(zones), strings.Join(candidates, "\n"))
+
+	return
+}
+
+//reresolveZoneID looks up the zone id again after the cached one was rejected.
+//Zones that are deleted and added again get a new id.
+func (u *Updater) reresolveZoneID(saveData *saveDataDocument) (err error) {
+
+	oldZoneID := saveData.ZoneID
+	u.log.Printf("Zone id %v for %v was rejected - looking it up again.", oldZoneID, toUnicode(u.cfg.Zone))
+
+	u.cache.remove(u.zoneCacheKey())
+	u.cache.remove("record:" + oldZoneID + ":")
+	saveData.ZoneIDExpires = time.Time{}
+	if err = u.resolveZoneID(saveData); err != nil {
+		return
+	}
+
+	if saveData.ZoneID == oldZoneID {
+		err = fmt.Errorf("Zone id %v for %v is unchanged but requests using it are being rejected", oldZoneID, toUnicode(u.cfg.Zone))
+	}
+
+	return
+}
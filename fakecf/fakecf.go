@@ -0,0 +1,516 @@
+//Package fakecf emulates the parts of the Cloudflare v4 API used by go-cloudflare-ddns, keeping zones and records in memory.
+//
+//It lets the whole utility run offline, for integration tests and for trying it out without a Cloudflare account.
+//Ids are given out in sequence, so the same calls always get the same answers.
+package fakecf
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+//APIPath is where the API is served, so the base URL to give the utility is the server's address followed by it
+const APIPath = "/client/v4"
+
+//IPPath is an echo service returning Server.IP, so IP detection can be offline too
+const IPPath = "/ip"
+
+//ReadOnlyToken starts API tokens that can only read, so writes with them are refused as they would be by Cloudflare
+const ReadOnlyToken = "readonly"
+
+//Zone is a zone held by the server
+type Zone struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	Account struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"account"`
+	Plan struct {
+		LegacyID string `json:"legacy_id"`
+	} `json:"plan"`
+}
+
+//Record is a DNS record held by the server
+type Record struct {
+	ID      string          `json:"id"`
+	ZoneID  string          `json:"zone_id"`
+	Type    string          `json:"type"`
+	Name    string          `json:"name"`
+	Content string          `json:"content,omitempty"`
+	Data    json.RawMessage `json:"data,omitempty"`
+	TTL     int             `json:"ttl"`
+	Proxied bool            `json:"proxied"`
+	Comment string          `json:"comment"`
+	Tags    []string        `json:"tags"`
+}
+
+//Server is the fake API. The zero value is ready to use.
+type Server struct {
+	//IP is returned by the echo service at IPPath
+	IP string
+
+	mu      sync.Mutex
+	zones   []Zone
+	records []Record
+	tunnels map[string]json.RawMessage
+	nextID  int
+}
+
+//New returns a server whose echo service returns ip
+func New(ip string) *Server {
+	return &Server{IP: ip}
+}
+
+//newID returns the next id for type of object
+func (s *Server) newID(kind string) string {
+	s.nextID++
+	return fmt.Sprintf("fake-%s-%d", kind, s.nextID)
+}
+
+//AddZone adds an active zone and returns its id
+func (s *Server) AddZone(name string) string {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	zone := Zone{ID: s.newID("zone"), Name: strings.ToLower(name), Status: "active"}
+	zone.Account.ID = "fake-account"
+	zone.Account.Name = "Fake account"
+	zone.Plan.LegacyID = "free"
+	s.zones = append(s.zones, zone)
+
+	return zone.ID
+}
+
+//AddRecord adds a record to the zone with the given id and returns the record's id
+func (s *Server) AddRecord(zoneID string, record Record) string {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record.ID = s.newID("record")
+	record.ZoneID = zoneID
+	if record.TTL == 0 {
+		record.TTL = 1
+	}
+	s.records = append(s.records, record)
+
+	return record.ID
+}
+
+//SetTunnelConfig sets the configuration of the Cloudflare Tunnel with the given id, as served from
+///accounts/{account}/cfd_tunnel/{tunnel}/configurations. Records route to the tunnel with a CNAME to <id>.cfargotunnel.com.
+func (s *Server) SetTunnelConfig(tunnelID string, config json.RawMessage) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.tunnels == nil {
+		s.tunnels = make(map[string]json.RawMessage)
+	}
+	s.tunnels[tunnelID] = config
+}
+
+//TunnelConfig returns the configuration of the tunnel with the given id
+func (s *Server) TunnelConfig(tunnelID string) json.RawMessage {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.tunnels[tunnelID]
+}
+
+//Records returns a copy of the records in the zone with the given id
+func (s *Server) Records(zoneID string) (records []Record) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, record := range s.records {
+		if record.ZoneID == zoneID {
+			records = append(records, record)
+		}
+	}
+	return
+}
+
+//Handler returns the handler serving the API under APIPath and the echo service at IPPath
+func (s *Server) Handler() http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		if r.URL.Path == IPPath {
+			s.serveIP(w, r)
+			return
+		}
+
+		//Paths are zones, zones/<zone>/dns_records or zones/<zone>/dns_records/<record> under APIPath,
+		//accounts/<account>/cfd_tunnel/<tunnel>/configurations for tunnels and user/tokens/<token> for API tokens
+		parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, APIPath), "/"), "/")
+		for len(parts) < 5 {
+			parts = append(parts, "")
+		}
+		zoneID, recordID := parts[1], parts[3]
+
+		var handler func()
+		switch {
+		case parts[0] == "user" && parts[1] == "tokens" && parts[2] == "verify" && r.Method == "GET":
+			handler = func() { s.verifyToken(w, r) }
+		case parts[0] == "user" && parts[1] == "tokens" && parts[2] != "" && r.Method == "GET":
+			handler = func() { s.getToken(w, r, parts[2]) }
+		case parts[0] == "accounts" && parts[2] == "cfd_tunnel" && parts[4] == "configurations" && r.Method == "GET":
+			handler = func() { s.getTunnelConfig(w, parts[3]) }
+		case parts[0] == "accounts" && parts[2] == "cfd_tunnel" && parts[4] == "configurations" && r.Method == "PUT":
+			handler = func() { s.putTunnelConfig(w, r, parts[3]) }
+		case r.Method == "GET" && parts[0] == "zones" && zoneID == "":
+			handler = func() { s.listZones(w, r) }
+		case r.Method == "GET" && parts[0] == "zones" && parts[2] == "":
+			handler = func() { s.getZone(w, zoneID) }
+		case r.Method == "GET" && parts[2] == "dns_records" && recordID == "":
+			handler = func() { s.listRecords(w, r, zoneID) }
+		case r.Method == "POST" && parts[2] == "dns_records" && recordID == "":
+			handler = func() { s.createRecord(w, r, zoneID) }
+		case r.Method == "PUT" && parts[2] == "dns_records" && recordID != "":
+			handler = func() { s.updateRecord(w, r, zoneID, recordID) }
+		case r.Method == "PATCH" && parts[2] == "dns_records" && recordID != "":
+			handler = func() { s.patchRecord(w, r, zoneID, recordID) }
+		case r.Method == "DELETE" && parts[2] == "dns_records" && recordID != "":
+			handler = func() { s.deleteRecord(w, r, zoneID, recordID) }
+		default:
+			writeError(w, http.StatusNotFound, 7000, "No route for that URI")
+			return
+		}
+
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") && r.Header.Get("X-Auth-Key") == "" {
+			writeError(w, http.StatusBadRequest, 9106, "Missing X-Auth-Key, X-Auth-Email or Authorization headers")
+			return
+		}
+		if strings.HasPrefix(r.Header.Get("Authorization"), "Bearer "+ReadOnlyToken) && r.Method != "GET" {
+			writeError(w, http.StatusForbidden, 10000, "Authentication error")
+			return
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		handler()
+	})
+}
+
+//SetIP changes the IP the echo service returns, eg to test what happens when it changes while the server is running
+func (s *Server) SetIP(ip string) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.IP = ip
+}
+
+//serveIP answers as an echo service would
+func (s *Server) serveIP(w http.ResponseWriter, r *http.Request) {
+
+	s.mu.Lock()
+	ip := s.IP
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain")
+	fmt.Fprintln(w, ip)
+}
+
+//listZones answers GET /zones?name=...[&account.id=...]
+func (s *Server) listZones(w http.ResponseWriter, r *http.Request) {
+
+	name := strings.ToLower(r.URL.Query().Get("name"))
+	account := r.URL.Query().Get("account.id")
+
+	zones := []Zone{}
+	for _, zone := range s.zones {
+		if (name == "" || zone.Name == name) && (account == "" || zone.Account.ID == account) {
+			zones = append(zones, zone)
+		}
+	}
+
+	writeResult(w, zones, len(zones), 1, 1)
+}
+
+//zone returns the zone with the id, writing an error if there isn't one
+func (s *Server) zone(w http.ResponseWriter, zoneID string) (zone Zone, ok bool) {
+	for _, zone = range s.zones {
+		if zone.ID == zoneID {
+			return zone, true
+		}
+	}
+	writeError(w, http.StatusBadRequest, 7003, "Could not route to /zones/"+zoneID+", perhaps your object identifier is invalid?")
+	return
+}
+
+//getZone answers GET /zones/{zone}
+func (s *Server) getZone(w http.ResponseWriter, zoneID string) {
+	if zone, ok := s.zone(w, zoneID); ok {
+		writeResult(w, zone, 1, 1, 1)
+	}
+}
+
+//listRecords answers GET /zones/{zone}/dns_records, filtered by type, name, content and comment.contains, one page at a time
+func (s *Server) listRecords(w http.ResponseWriter, r *http.Request, zoneID string) {
+
+	zone, ok := s.zone(w, zoneID)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	var matched []Record
+	for _, record := range s.records {
+		switch {
+		case record.ZoneID != zone.ID:
+		case query.Get("type") != "" && record.Type != query.Get("type"):
+		case query.Get("name") != "" && !strings.EqualFold(record.Name, query.Get("name")):
+		case query.Get("content") != "" && record.Content != query.Get("content"):
+		case query.Get("comment.contains") != "" && !strings.Contains(record.Comment, query.Get("comment.contains")):
+		default:
+			matched = append(matched, record)
+		}
+	}
+
+	page, _ := strconv.Atoi(query.Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	perPage, _ := strconv.Atoi(query.Get("per_page"))
+	if perPage < 1 {
+		perPage = 100
+	}
+	totalPages := (len(matched) + perPage - 1) / perPage
+	if totalPages == 0 {
+		totalPages = 1
+	}
+
+	result := []Record{}
+	for i := (page - 1) * perPage; i < len(matched) && i < page*perPage; i++ {
+		result = append(result, matched[i])
+	}
+
+	writeResult(w, result, len(matched), page, totalPages)
+}
+
+//createRecord answers POST /zones/{zone}/dns_records
+func (s *Server) createRecord(w http.ResponseWriter, r *http.Request, zoneID string) {
+
+	zone, ok := s.zone(w, zoneID)
+	if !ok {
+		return
+	}
+
+	var record Record
+	if err := json.NewDecoder(r.Body).Decode(&record); err != nil {
+		writeError(w, http.StatusBadRequest, 9207, "Request body is invalid: "+err.Error())
+		return
+	}
+	if record.Type == "" || record.Name == "" {
+		writeError(w, http.StatusBadRequest, 9000, "DNS record type and name are required.")
+		return
+	}
+	record.ID = s.newID("record")
+	record.ZoneID = zone.ID
+	s.records = append(s.records, record)
+
+	writeResult(w, record, 1, 1, 1)
+}
+
+//updateRecord answers PUT /zones/{zone}/dns_records/{record}, replacing the record as Cloudflare does
+func (s *Server) updateRecord(w http.ResponseWriter, r *http.Request, zoneID string, recordID string) {
+
+	zone, ok := s.zone(w, zoneID)
+	if !ok {
+		return
+	}
+
+	for i, existing := range s.records {
+		if existing.ZoneID != zone.ID || existing.ID != recordID {
+			continue
+		}
+
+		var record Record
+		if err := json.NewDecoder(r.Body).Decode(&record); err != nil {
+			writeError(w, http.StatusBadRequest, 9207, "Request body is invalid: "+err.Error())
+			return
+		}
+		record.ID = existing.ID
+		record.ZoneID = zone.ID
+		s.records[i] = record
+
+		writeResult(w, record, 1, 1, 1)
+		return
+	}
+
+	writeError(w, http.StatusNotFound, 81044, "Record does not exist.")
+}
+
+//patchRecord answers PATCH /zones/{zone}/dns_records/{record}, changing only the fields given
+func (s *Server) patchRecord(w http.ResponseWriter, r *http.Request, zoneID string, recordID string) {
+
+	zone, ok := s.zone(w, zoneID)
+	if !ok {
+		return
+	}
+
+	for i, existing := range s.records {
+		if existing.ZoneID != zone.ID || existing.ID != recordID {
+			continue
+		}
+
+		record := existing
+		if err := json.NewDecoder(r.Body).Decode(&record); err != nil {
+			writeError(w, http.StatusBadRequest, 9207, "Request body is invalid: "+err.Error())
+			return
+		}
+		record.ID = existing.ID
+		record.ZoneID = zone.ID
+		s.records[i] = record
+
+		writeResult(w, record, 1, 1, 1)
+		return
+	}
+
+	writeError(w, http.StatusNotFound, 81044, "Record does not exist.")
+}
+
+//deleteRecord answers DELETE /zones/{zone}/dns_records/{record}
+func (s *Server) deleteRecord(w http.ResponseWriter, r *http.Request, zoneID string, recordID string) {
+
+	zone, ok := s.zone(w, zoneID)
+	if !ok {
+		return
+	}
+
+	for i, existing := range s.records {
+		if existing.ZoneID == zone.ID && existing.ID == recordID {
+			s.records = append(s.records[:i], s.records[i+1:]...)
+			writeResult(w, map[string]string{"id": existing.ID}, 1, 1, 1)
+			return
+		}
+	}
+
+	writeError(w, http.StatusNotFound, 81044, "Record does not exist.")
+}
+
+//getTunnelConfig answers GET /accounts/{account}/cfd_tunnel/{tunnel}/configurations
+func (s *Server) getTunnelConfig(w http.ResponseWriter, tunnelID string) {
+
+	config, ok := s.tunnels[tunnelID]
+	if !ok {
+		writeError(w, http.StatusNotFound, 1003, "Tunnel not found")
+		return
+	}
+
+	writeResult(w, map[string]interface{}{"tunnel_id": tunnelID, "config": config}, 1, 1, 1)
+}
+
+//putTunnelConfig answers PUT /accounts/{account}/cfd_tunnel/{tunnel}/configurations, replacing the configuration
+func (s *Server) putTunnelConfig(w http.ResponseWriter, r *http.Request, tunnelID string) {
+
+	if _, ok := s.tunnels[tunnelID]; !ok {
+		writeError(w, http.StatusNotFound, 1003, "Tunnel not found")
+		return
+	}
+
+	var body struct {
+		Config json.RawMessage `json:"config"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || len(body.Config) == 0 {
+		writeError(w, http.StatusBadRequest, 1001, "Invalid tunnel configuration")
+		return
+	}
+	s.tunnels[tunnelID] = body.Config
+
+	writeResult(w, map[string]interface{}{"tunnel_id": tunnelID, "config": body.Config}, 1, 1, 1)
+}
+
+//tokenID returns the id of the API token the request was made with, readonly-token for tokens starting with
+//ReadOnlyToken and token for others, or "" if it was made with a key
+func tokenID(r *http.Request) string {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	switch {
+	case !ok:
+		return ""
+	case strings.HasPrefix(token, ReadOnlyToken):
+		return "readonly-token"
+	default:
+		return "token"
+	}
+}
+
+//verifyToken answers GET /user/tokens/verify
+func (s *Server) verifyToken(w http.ResponseWriter, r *http.Request) {
+
+	id := tokenID(r)
+	if id == "" {
+		writeError(w, http.StatusBadRequest, 1000, "Invalid API Token")
+		return
+	}
+
+	writeResult(w, map[string]interface{}{"id": id, "status": "active"}, 1, 1, 1)
+}
+
+//getToken answers GET /user/tokens/{token}, for the token the request was made with. Its policy allows DNS Write, or
+//DNS Read for read-only tokens, on all zones.
+func (s *Server) getToken(w http.ResponseWriter, r *http.Request, id string) {
+
+	if id != tokenID(r) {
+		writeError(w, http.StatusNotFound, 1003, "Token not found")
+		return
+	}
+
+	group := map[string]string{"id": "4755a26eedb94da69e1066d98aa820be", "name": "DNS Write"}
+	if id == "readonly-token" {
+		group = map[string]string{"id": "82e64a83756745bbbb1c9c2701bf816b", "name": "DNS Read"}
+	}
+
+	writeResult(w, map[string]interface{}{
+		"id":     id,
+		"status": "active",
+		"policies": []map[string]interface{}{{
+			"effect":            "allow",
+			"resources":         map[string]string{"com.cloudflare.api.account.zone.*": "*"},
+			"permission_groups": []map[string]string{group},
+		}},
+	}, 1, 1, 1)
+}
+
+//writeResult writes a successful response in the Cloudflare envelope
+func writeResult(w http.ResponseWriter, result interface{}, count int, page int, totalPages int) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success":  true,
+		"errors":   []interface{}{},
+		"messages": []interface{}{},
+		"result":   result,
+		"result_info": map[string]int{
+			"page":        page,
+			"total_pages": totalPages,
+			"count":       count,
+			"total_count": count,
+		},
+	})
+}
+
+//writeError writes an unsuccessful response in the Cloudflare envelope
+func writeError(w http.ResponseWriter, status int, code int, message string) {
+	writeJSON(w, status, map[string]interface{}{
+		"success":  false,
+		"errors":   []map[string]interface{}{{"code": code, "message": message}},
+		"messages": []interface{}{},
+		"result":   nil,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,169 @@
+package fakecf
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+//envelope is the part of a response the tests check
+type envelope struct {
+	Success bool `json:"success"`
+	Errors  []struct {
+		Code int `json:"code"`
+	} `json:"errors"`
+	Result     json.RawMessage `json:"result"`
+	ResultInfo struct {
+		Count      int `json:"count"`
+		TotalPages int `json:"total_pages"`
+	} `json:"result_info"`
+}
+
+//call makes a request to the fake's API as the utility would, with token as the API token if not empty
+func call(t *testing.T, srv *httptest.Server, method string, path string, token string, body string) (status int, msg envelope) {
+
+	req, err := http.NewRequest(method, srv.URL+APIPath+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if err = json.NewDecoder(resp.Body).Decode(&msg); err != nil {
+		t.Fatalf("%v %v: response is not JSON: %v", method, path, err)
+	}
+	return resp.StatusCode, msg
+}
+
+func TestAPI(t *testing.T) {
+
+	fake := New("203.0.113.10")
+	zoneID := fake.AddZone("Example.com")
+	fake.AddRecord(zoneID, Record{Type: "A", Name: "home.example.com", Content: "192.0.2.1"})
+	fake.AddRecord(zoneID, Record{Type: "TXT", Name: "home.example.com", Content: "hello", Comment: "managed"})
+	srv := httptest.NewServer(fake.Handler())
+	defer srv.Close()
+
+	//Steps run in order against the same server. wantCount is the count in the result info, or -1 not to check it.
+	records := "/zones/" + zoneID + "/dns_records"
+	steps := []struct {
+		name       string
+		method     string
+		path       string
+		token      string
+		body       string
+		wantStatus int
+		wantCode   int
+		wantCount  int
+	}{
+		{"no credentials", "GET", "/zones", "", "", http.StatusBadRequest, 9106, -1},
+		{"unknown route", "GET", "/nothing/here", "token", "", http.StatusNotFound, 7000, -1},
+		{"zone by name", "GET", "/zones?name=example.com", "token", "", http.StatusOK, 0, 1},
+		{"zone not held", "GET", "/zones?name=example.org", "token", "", http.StatusOK, 0, 0},
+		{"zone by id", "GET", "/zones/" + zoneID, "token", "", http.StatusOK, 0, -1},
+		{"invalid zone id", "GET", "/zones/nope/dns_records", "token", "", http.StatusBadRequest, 7003, -1},
+		{"all records", "GET", records, "token", "", http.StatusOK, 0, 2},
+		{"records by type and name", "GET", records + "?type=A&name=HOME.example.com", "token", "", http.StatusOK, 0, 1},
+		{"records by comment", "GET", records + "?comment.contains=manag", "token", "", http.StatusOK, 0, 1},
+		{"paged", "GET", records + "?per_page=1&page=2", "token", "", http.StatusOK, 0, 2},
+		{"create", "POST", records, "token", `{"type":"A","name":"www.example.com","content":"192.0.2.1"}`, http.StatusOK, 0, -1},
+		{"create without name", "POST", records, "token", `{"type":"A"}`, http.StatusBadRequest, 9000, -1},
+		{"create with bad body", "POST", records, "token", `{`, http.StatusBadRequest, 9207, -1},
+		{"create with read only token", "POST", records, ReadOnlyToken, `{"type":"A","name":"ro.example.com"}`, http.StatusForbidden, 10000, -1},
+		{"read with read only token", "GET", records, ReadOnlyToken, "", http.StatusOK, 0, 3},
+		{"update", "PUT", records + "/fake-record-2", "token", `{"type":"A","name":"home.example.com","content":"203.0.113.10"}`, http.StatusOK, 0, -1},
+		{"update missing record", "PUT", records + "/fake-record-99", "token", `{"type":"A","name":"x.example.com"}`, http.StatusNotFound, 81044, -1},
+		{"patch", "PATCH", records + "/fake-record-3", "token", `{"content":"bye"}`, http.StatusOK, 0, -1},
+		{"delete", "DELETE", records + "/fake-record-4", "token", "", http.StatusOK, 0, -1},
+		{"delete again", "DELETE", records + "/fake-record-4", "token", "", http.StatusNotFound, 81044, -1},
+		{"verify token", "GET", "/user/tokens/verify", "token", "", http.StatusOK, 0, -1},
+		{"other token", "GET", "/user/tokens/readonly-token", "token", "", http.StatusNotFound, 1003, -1},
+	}
+
+	for _, step := range steps {
+		status, msg := call(t, srv, step.method, step.path, step.token, step.body)
+		if status != step.wantStatus {
+			t.Errorf("%v: status %v, want %v", step.name, status, step.wantStatus)
+		}
+		if msg.Success != (step.wantCode == 0) {
+			t.Errorf("%v: success %v, want %v", step.name, msg.Success, step.wantCode == 0)
+		}
+		if step.wantCode != 0 && (len(msg.Errors) != 1 || msg.Errors[0].Code != step.wantCode) {
+			t.Errorf("%v: errors %+v, want code %v", step.name, msg.Errors, step.wantCode)
+		}
+		if step.wantCount >= 0 && msg.ResultInfo.Count != step.wantCount {
+			t.Errorf("%v: count %v, want %v", step.name, msg.ResultInfo.Count, step.wantCount)
+		}
+	}
+
+	//PUT replaces the record and PATCH only changes the fields given
+	got := map[string]Record{}
+	for _, record := range fake.Records(zoneID) {
+		got[record.Type] = record
+	}
+	if len(got) != 2 || got["A"].Content != "203.0.113.10" || got["TXT"].Content != "bye" || got["TXT"].Comment != "managed" {
+		t.Errorf("Records after the steps: %+v", fake.Records(zoneID))
+	}
+}
+
+func TestTokenPermissions(t *testing.T) {
+
+	fake := New("203.0.113.10")
+	srv := httptest.NewServer(fake.Handler())
+	defer srv.Close()
+
+	tests := []struct {
+		token     string
+		wantID    string
+		wantGroup string
+	}{
+		{"token", "token", "DNS Write"},
+		{ReadOnlyToken + "-abc", "readonly-token", "DNS Read"},
+	}
+
+	for _, test := range tests {
+		_, verified := call(t, srv, "GET", "/user/tokens/verify", test.token, "")
+		var token struct {
+			ID string `json:"id"`
+		}
+		json.Unmarshal(verified.Result, &token)
+		if token.ID != test.wantID {
+			t.Errorf("Token %v verified as %q, want %q", test.token, token.ID, test.wantID)
+			continue
+		}
+
+		_, msg := call(t, srv, "GET", "/user/tokens/"+token.ID, test.token, "")
+		if !strings.Contains(string(msg.Result), `"name":"`+test.wantGroup+`"`) {
+			t.Errorf("Token %v has policies %s, want %v", test.token, msg.Result, test.wantGroup)
+		}
+	}
+}
+
+func TestEchoService(t *testing.T) {
+
+	fake := New("203.0.113.10")
+	srv := httptest.NewServer(fake.Handler())
+	defer srv.Close()
+
+	for _, ip := range []string{"203.0.113.10", "198.51.100.7"} {
+		fake.SetIP(ip)
+		resp, err := srv.Client().Get(srv.URL + IPPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if strings.TrimSpace(string(body)) != ip {
+			t.Errorf("Echo service answered %q, want %v", body, ip)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/jonegerton/go-cloudflare-ddns/ddns"
+	"github.com/jonegerton/go-cloudflare-ddns/fakecf"
+)
+
+//Addresses the fake server starts the host records with, so the first run has something to change
+const (
+	fakeOldIPv4 = "192.0.2.1"
+	fakeOldIPv6 = "2001:db8::1"
+)
+
+//runFakeServer serves a fake Cloudflare API holding the zone and a record for each host, marked as managed
+//by the utility, until stopped
+func runFakeServer() (err error) {
+
+	if cfg.Zone == "" {
+		cfg.Zone = "example.com"
+	}
+
+	var extraHosts []ddns.Host
+	if hostsFrom != "" {
+		if extraHosts, err = readHostsFrom(hostsFrom); err != nil {
+			return
+		}
+	}
+	updater, err := newUpdater(extraHosts)
+	if err != nil {
+		return
+	}
+
+	server := fakecf.New(fakeIP)
+	zoneID := server.AddZone(cfg.Zone)
+
+	for _, host := range updater.Hosts() {
+		record := fakecf.Record{Type: host.Type, Name: host.Name, Comment: ddns.OwnerMarker}
+		switch host.Type {
+		case "SRV":
+			srv := host.SRV
+			srv.Priority, srv.Weight = max(srv.Priority, 0), max(srv.Weight, 0)
+			record.Data, _ = json.Marshal(srv)
+		case "AAAA":
+			record.Content = fakeOldIPv6
+		default:
+			record.Content = strings.Replace(host.Content, "{ip}", fakeOldIPv4, -1)
+		}
+		server.AddRecord(zoneID, record)
+		log.Printf("Fake record %v %v: %v", record.Type, record.Name, record.Content+string(record.Data))
+	}
+
+	base := "http://" + fakeListen
+	log.Printf("Fake Cloudflare API for zone %v (id %v) listening on %v", cfg.Zone, zoneID, fakeListen)
+	log.Printf("Run the utility against it with: -api-base=%v%v -wan-ip-source=%v%v -cftoken=fake -cfzone=%v",
+		base, fakecf.APIPath, base, fakecf.IPPath, cfg.Zone)
+
+	return http.ListenAndServe(fakeListen, server.Handler())
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/jonegerton/go-cloudflare-ddns/ddns"
+)
+
+//readHostsFrom reads host entries from the -hosts-from file, or stdin when the path is "-".
+//
+//The list can be JSON, an array of names or of objects using the -cfhost option names:
+//
+//	[{"name": "home.example.com"}, {"name": "ip.example.com", "type": "TXT", "content": "ip={ip}"}]
+//
+//Labels can be given as label.<name> options, or in JSON as an object: {"name": "home", "labels": {"site": "london"}}
+//
+//or CSV with a header row naming the columns, of which name is required:
+//
+//	name,type,content
+//	home.example.com,,
+//	ip.example.com,TXT,ip={ip}
+func readHostsFrom(path string) (hosts []ddns.Host, err error) {
+
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("Error in readHostsFrom(): %v", err)
+		}
+	}()
+
+	var data []byte
+	if path == "-" {
+		data, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		data, err = ioutil.ReadFile(path)
+	}
+	if err != nil {
+		return
+	}
+
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 {
+		err = fmt.Errorf("No host entries in %v", hostsSourceName(path))
+		return
+	}
+
+	if trimmed[0] == '[' {
+		hosts, err = parseHostsJSON(trimmed)
+	} else {
+		hosts, err = parseHostsCSV(trimmed)
+	}
+	if err != nil {
+		err = fmt.Errorf("Error reading host entries from %v: %v", hostsSourceName(path), err)
+	}
+
+	return
+}
+
+//parseHostsJSON parses a JSON array of host names or host objects
+func parseHostsJSON(data []byte) (hosts []ddns.Host, err error) {
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var items []interface{}
+	if err = dec.Decode(&items); err != nil {
+		return
+	}
+
+	for i, item := range items {
+		switch item := item.(type) {
+		case string:
+			host := ddns.NewHost(item)
+			if err = host.Validate(); err != nil {
+				return nil, fmt.Errorf("Entry %d %v", i+1, err)
+			}
+			hosts = append(hosts, host)
+
+		case map[string]interface{}:
+			options := make(map[string]string)
+			for key, val := range item {
+				if labels, ok := val.(map[string]interface{}); ok && key == "labels" {
+					for name, label := range labels {
+						options["label."+name] = fmt.Sprint(label)
+					}
+					continue
+				}
+				options[key] = fmt.Sprint(val)
+			}
+			host, err := hostEntryFromOptions(options)
+			if err != nil {
+				return nil, fmt.Errorf("Entry %d %v", i+1, err)
+			}
+			hosts = append(hosts, host)
+
+		default:
+			return nil, fmt.Errorf("Entry %d is not a name or an object", i+1)
+		}
+	}
+
+	return
+}
+
+//parseHostsCSV parses CSV with a header row of option names
+func parseHostsCSV(data []byte) (hosts []ddns.Host, err error) {
+
+	r := csv.NewReader(bytes.NewReader(data))
+	r.TrimLeadingSpace = true
+
+	header, err := r.Read()
+	if err != nil {
+		return
+	}
+	for i := range header {
+		header[i] = strings.ToLower(strings.TrimSpace(header[i]))
+	}
+
+	for line := 2; ; line++ {
+		record, readErr := r.Read()
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return nil, readErr
+		}
+
+		options := make(map[string]string)
+		for i, val := range record {
+			options[header[i]] = val
+		}
+		host, err := hostEntryFromOptions(options)
+		if err != nil {
+			return nil, fmt.Errorf("Line %d %v", line, err)
+		}
+		hosts = append(hosts, host)
+	}
+
+	return
+}
+
+//hostEntryFromOptions builds an entry from the name and any non-empty options
+func hostEntryFromOptions(options map[string]string) (host ddns.Host, err error) {
+
+	host = ddns.NewHost(options["name"])
+
+	for key, val := range options {
+		if key == "name" || strings.TrimSpace(val) == "" {
+			continue
+		}
+		if err = host.SetOption(key, strings.TrimSpace(val)); err != nil {
+			return
+		}
+	}
+
+	err = host.Validate()
+	return
+}
+
+//hostsSourceName describes where hosts were read from for error messages
+func hostsSourceName(path string) string {
+	if path == "-" {
+		return "stdin"
+	}
+	return path
+}
@@ -0,0 +1,381 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+//installPlatform is where the install command puts the utility on a router or NAS, and how it is started at boot
+type installPlatform struct {
+	Name string
+	//Bin is where the executable is copied to, and Dir holds the config file, saved data and log
+	Bin string
+	Dir string
+	//Script is the service script, written from ScriptTemplate
+	Script         string
+	ScriptTemplate *template.Template
+	//Crontab is a crontab file the script is added to, for platforms without an init system to hook into
+	Crontab string
+	//Defaults are settings written to the config file unless given
+	Defaults map[string]interface{}
+	//Activate are the commands run once the files are written, to start the service now and at boot
+	Activate [][]string
+}
+
+//Platform names for install, given as eg install --openwrt
+const (
+	platformOpenWrt  = "openwrt"
+	platformSynology = "synology"
+	platformQNAP     = "qnap"
+)
+
+var (
+	installOpenWrt  bool
+	installSynology bool
+	installQNAP     bool
+	installRoot     string
+)
+
+func init() {
+	flag.BoolVar(&installOpenWrt, "openwrt", false, "With the install command, install as an OpenWrt service rather than detecting the platform")
+	flag.BoolVar(&installSynology, "synology", false, "With the install command, install as a Synology DSM service rather than detecting the platform")
+	flag.BoolVar(&installQNAP, "qnap", false, "With the install command, install as a QNAP QTS service rather than detecting the platform")
+	flag.StringVar(&installRoot, "install-root", "", "With the install command, write the files under this directory instead of / and only show the commands that would start the service, to check them first")
+}
+
+//installFlags are about the install itself, or only meant for one run, so aren't written to the installed config file
+var installFlags = map[string]bool{"openwrt": true, "synology": true, "qnap": true, "install-root": true, "config": true, "yes": true, "override-max-changes": true}
+
+//procdScript is an OpenWrt init script, run by procd which restarts the utility if it exits
+var procdScript = template.Must(template.New("procd").Parse(`#!/bin/sh /etc/rc.common
+# go-cloudflare-ddns service, written by go-cloudflare-ddns install
+
+START=99
+USE_PROCD=1
+
+start_service() {
+	procd_open_instance
+	procd_set_param command /bin/sh -c "cd {{.Dir}} && exec {{.Bin}} -config={{.Dir}}/config.json"
+	procd_set_param respawn
+	procd_set_param stdout 1
+	procd_set_param stderr 1
+	procd_close_instance
+}
+`))
+
+//serviceScript is a start/stop script for NAS systems, keeping the utility's pid and log in its directory.
+//Starting it again while it is running does nothing, so it can also be run from cron to restart the utility.
+var serviceScript = template.Must(template.New("service").Parse(`#!/bin/sh
+# go-cloudflare-ddns service, written by go-cloudflare-ddns install
+
+DIR="{{.Dir}}"
+BIN="{{.Bin}}"
+PID="$DIR/go-cloudflare-ddns.pid"
+
+running() {
+	[ -f "$PID" ] && kill -0 "$(cat "$PID")" 2>/dev/null
+}
+
+case "$1" in
+start)
+	running && exit 0
+	cd "$DIR" || exit 1
+	nohup "$BIN" -config="$DIR/config.json" >> "$DIR/go-cloudflare-ddns.log" 2>&1 &
+	echo $! > "$PID"
+	;;
+stop)
+	running && kill "$(cat "$PID")"
+	rm -f "$PID"
+	;;
+restart)
+	"$0" stop
+	"$0" start
+	;;
+status)
+	if running; then echo "running"; else echo "stopped"; exit 1; fi
+	;;
+*)
+	echo "Usage: $0 {start|stop|restart|status}"
+	exit 1
+	;;
+esac
+`))
+
+//installPlatforms are the supported platforms. Settings that suit each are added to the config file unless given:
+//the interval to run at, and waiting for the network when started at boot.
+var installPlatforms = map[string]installPlatform{
+	platformOpenWrt: {
+		Name:           "OpenWrt",
+		Bin:            "/usr/bin/go-cloudflare-ddns",
+		Dir:            "/etc/go-cloudflare-ddns",
+		Script:         "/etc/init.d/go-cloudflare-ddns",
+		ScriptTemplate: procdScript,
+		Defaults:       map[string]interface{}{"interval": "5m", "wait-for-network": "2m", "low-memory": true},
+		Activate: [][]string{
+			{"/etc/init.d/go-cloudflare-ddns", "enable"},
+			{"/etc/init.d/go-cloudflare-ddns", "restart"},
+		},
+	},
+	platformSynology: {
+		Name: "Synology DSM",
+		Bin:  "/usr/local/bin/go-cloudflare-ddns",
+		Dir:  "/usr/local/etc/go-cloudflare-ddns",
+		//DSM runs the scripts in rc.d with start at boot and stop at shutdown
+		Script:         "/usr/local/etc/rc.d/go-cloudflare-ddns.sh",
+		ScriptTemplate: serviceScript,
+		Defaults:       map[string]interface{}{"interval": "5m", "wait-for-network": "2m"},
+		Activate: [][]string{
+			{"/usr/local/etc/rc.d/go-cloudflare-ddns.sh", "restart"},
+		},
+	},
+	platformQNAP: {
+		Name: "QNAP QTS",
+		//Only the data volume and /etc/config survive a reboot, and /etc/config is too small for the executable
+		Bin:            "/share/CACHEDEV1_DATA/.qpkg/go-cloudflare-ddns/go-cloudflare-ddns",
+		Dir:            "/share/CACHEDEV1_DATA/.qpkg/go-cloudflare-ddns",
+		Script:         "/share/CACHEDEV1_DATA/.qpkg/go-cloudflare-ddns/go-cloudflare-ddns.sh",
+		ScriptTemplate: serviceScript,
+		Crontab:        "/etc/config/crontab",
+		Defaults:       map[string]interface{}{"interval": "5m", "wait-for-network": "2m"},
+		Activate: [][]string{
+			{"crontab", "/etc/config/crontab"},
+			{"/etc/init.d/crond.sh", "restart"},
+			{"/share/CACHEDEV1_DATA/.qpkg/go-cloudflare-ddns/go-cloudflare-ddns.sh", "restart"},
+		},
+	},
+}
+
+//platformMarkers are files found only on each platform, used to detect it when no platform flag is given
+var platformMarkers = map[string][]string{
+	platformOpenWrt:  {"/etc/openwrt_release"},
+	platformSynology: {"/etc/synoinfo.conf", "/etc.defaults/VERSION"},
+	platformQNAP:     {"/etc/config/qpkg.conf", "/sbin/getcfg"},
+}
+
+//runInstall installs the utility as a service on a router or NAS: copying the executable, writing a config file of the
+//settings given and a service script, then starting the service
+func runInstall() (err error) {
+
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("Error in runInstall(): %v", err)
+		}
+	}()
+
+	name, err := detectPlatform()
+	if err != nil {
+		return
+	}
+	platform := installPlatforms[name]
+	fmt.Printf("Installing for %v\n", platform.Name)
+
+	if (cfg.Token == "" && (cfg.User == "" || cfg.Key == "")) || cfg.Zone == "" || (len(cfhosts) == 0 && hostsFrom == "" && !cfg.UpdateAllMatching) {
+		return fmt.Errorf("Install needs the settings the service will run with: -cftoken (or -cfuser and -cfkey), -cfzone and -cfhost")
+	}
+
+	if err = os.MkdirAll(installPath(platform.Dir), 0755); err != nil {
+		return
+	}
+	if err = installConfig(platform); err != nil {
+		return
+	}
+	if err = installExecutable(platform); err != nil {
+		return
+	}
+
+	var script strings.Builder
+	if err = platform.ScriptTemplate.Execute(&script, platform); err != nil {
+		return
+	}
+	if err = os.MkdirAll(filepath.Dir(installPath(platform.Script)), 0755); err != nil {
+		return
+	}
+	if err = ioutil.WriteFile(installPath(platform.Script), []byte(script.String()), 0755); err != nil {
+		return
+	}
+	fmt.Printf("Wrote service script %v\n", platform.Script)
+
+	if platform.Crontab != "" {
+		if err = installCrontab(platform); err != nil {
+			return
+		}
+	}
+
+	for _, command := range platform.Activate {
+		if installRoot != "" {
+			fmt.Printf("Would run: %v\n", strings.Join(command, " "))
+			continue
+		}
+		fmt.Printf("Running: %v\n", strings.Join(command, " "))
+		if out, runErr := exec.Command(command[0], command[1:]...).CombinedOutput(); runErr != nil {
+			return fmt.Errorf("%v failed: %v %s", strings.Join(command, " "), runErr, out)
+		}
+	}
+
+	fmt.Printf("Installed. Settings are in %v/config.json, and the saved data in %v\n", platform.Dir, platform.Dir)
+	return
+}
+
+//detectPlatform returns the platform given by flag, or else the one whose marker files are present
+func detectPlatform() (name string, err error) {
+
+	var given []string
+	for flagName, set := range map[string]bool{platformOpenWrt: installOpenWrt, platformSynology: installSynology, platformQNAP: installQNAP} {
+		if set {
+			given = append(given, flagName)
+		}
+	}
+	switch len(given) {
+	case 1:
+		return given[0], nil
+	case 0:
+	default:
+		return "", fmt.Errorf("Only one of -openwrt, -synology and -qnap can be given")
+	}
+
+	for _, candidate := range []string{platformOpenWrt, platformSynology, platformQNAP} {
+		for _, marker := range platformMarkers[candidate] {
+			if _, statErr := os.Stat(installPath(marker)); statErr == nil {
+				logVerbose("Found %v, platform is %v", marker, candidate)
+				return candidate, nil
+			}
+		}
+	}
+
+	return "", fmt.Errorf("Couldn't detect the platform, give one of -openwrt, -synology or -qnap")
+}
+
+//installPath returns where a platform path is written, under -install-root if set
+func installPath(platformPath string) string {
+	return filepath.Join("/", installRoot, platformPath)
+}
+
+//installConfig writes the settings given to the install command, from flags, the environment or -config,
+//to the platform's config file, along with the platform's defaults for any not given
+func installConfig(platform installPlatform) (err error) {
+
+	settings := givenSettings(installFlags)
+	for name, value := range platform.Defaults {
+		if _, given := settings[name]; !given {
+			settings[name] = value
+		}
+	}
+
+	data, err := json.MarshalIndent(settings, "", "    ")
+	if err != nil {
+		return
+	}
+
+	configFile := installPath(filepath.Join(platform.Dir, "config.json"))
+	if existing, readErr := ioutil.ReadFile(configFile); readErr == nil && string(existing) != string(data) {
+		fmt.Printf("%v already exists, with different settings.\n", filepath.Join(platform.Dir, "config.json"))
+		if !assumeYes && !confirm("Replace it?") {
+			fmt.Println("Keeping the existing settings.")
+			return
+		}
+	}
+
+	//The config file holds the API credentials
+	if err = ioutil.WriteFile(configFile, data, 0600); err != nil {
+		return
+	}
+
+	var names []string
+	for name := range settings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Printf("Wrote config file %v with %v\n", filepath.Join(platform.Dir, "config.json"), strings.Join(names, ", "))
+
+	return
+}
+
+//installExecutable copies the running executable to the platform's location, unless it is already running from there
+func installExecutable(platform installPlatform) (err error) {
+
+	self, err := os.Executable()
+	if err != nil {
+		return
+	}
+	target := installPath(platform.Bin)
+	if resolved, evalErr := filepath.EvalSymlinks(self); evalErr == nil {
+		self = resolved
+	}
+	if self == target {
+		return
+	}
+
+	in, err := os.Open(self)
+	if err != nil {
+		return
+	}
+	defer in.Close()
+
+	if err = os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return
+	}
+
+	//Written alongside and renamed over the target, as a running executable can't be overwritten
+	tmp := target + ".tmp"
+	out, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0755)
+	if err != nil {
+		return
+	}
+	if _, err = io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return
+	}
+	if err = out.Close(); err != nil {
+		os.Remove(tmp)
+		return
+	}
+	if err = os.Rename(tmp, target); err != nil {
+		os.Remove(tmp)
+		return
+	}
+	fmt.Printf("Copied %v to %v\n", self, platform.Bin)
+
+	return
+}
+
+//installCrontab adds a line to the platform's crontab starting the service every 5 minutes, which starts it after a
+//reboot and restarts it if it stops. An existing line for the script is left as it is.
+func installCrontab(platform installPlatform) (err error) {
+
+	crontab := installPath(platform.Crontab)
+	existing, err := ioutil.ReadFile(crontab)
+	if err != nil && !os.IsNotExist(err) {
+		return
+	}
+	err = nil
+
+	if strings.Contains(string(existing), platform.Script) {
+		return
+	}
+
+	content := string(existing)
+	if content != "" && !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+	content += fmt.Sprintf("*/5 * * * * %v start\n", platform.Script)
+
+	if err = os.MkdirAll(filepath.Dir(crontab), 0755); err != nil {
+		return
+	}
+	if err = ioutil.WriteFile(crontab, []byte(content), 0644); err != nil {
+		return
+	}
+	fmt.Printf("Added the service to %v\n", platform.Crontab)
+
+	return
+}
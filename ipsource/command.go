@@ -0,0 +1,63 @@
+package ipsource
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+//commandTimeout is how long a command has to give the IP before it is killed
+const commandTimeout = time.Second * 10
+
+//Command runs an executable that prints the IP on its first line of output, for detection logic specific to a site
+//such as asking a router over ssh. It is run directly rather than through a shell, with no arguments.
+type Command struct {
+	Path string
+}
+
+//NewCommand returns a source running the executable at path
+func NewCommand(path string) *Command {
+	return &Command{
+		Path: path,
+	}
+}
+
+//Name describes the command
+func (s *Command) Name() string {
+	return "command:" + s.Path
+}
+
+//Detect runs the command and reads the IP from the first line it prints. Anything it writes to stderr is included in the
+//error when it fails.
+func (s *Command) Detect(ctx context.Context) (addr netip.Addr, err error) {
+
+	cmdCtx, cancel := context.WithTimeout(ctx, commandTimeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(cmdCtx, s.Path)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	//Children of a killed script, eg a sleep, can hold its output open, so stop waiting for them
+	cmd.WaitDelay = time.Second
+
+	if err = cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			err = fmt.Errorf("%v was stopped: %v", s.Name(), ctx.Err())
+		} else if errors.Is(cmdCtx.Err(), context.DeadlineExceeded) {
+			err = fmt.Errorf("%v didn't finish within %v", s.Name(), commandTimeout)
+		} else if message := strings.TrimSpace(stderr.String()); message != "" {
+			err = fmt.Errorf("%v failed: %v: %.200s", s.Name(), err, message)
+		} else {
+			err = fmt.Errorf("%v failed: %v", s.Name(), err)
+		}
+		return
+	}
+
+	line, _, _ := strings.Cut(stdout.String(), "\n")
+	return parseAddr(s, line)
+}
@@ -0,0 +1,57 @@
+package ipsource
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"time"
+)
+
+//DNS looks up a name that a resolver answers with the address the query came from
+type DNS struct {
+	//Resolver is the address of the DNS server to query
+	Resolver string
+	//Host is the name to look up
+	Host string
+}
+
+//NewDNS returns a DNS source using the OpenDNS resolver and myip.opendns.com
+func NewDNS() *DNS {
+	return &DNS{
+		Resolver: "208.67.222.222:53",
+		Host:     "myip.opendns.com",
+	}
+}
+
+//Name describes the lookup
+func (s *DNS) Name() string {
+	return fmt.Sprintf("dns:%s@%s", s.Host, s.Resolver)
+}
+
+//Detect queries the resolver for the host's IPv4 address
+func (s *DNS) Detect(ctx context.Context) (addr netip.Addr, err error) {
+
+	resolver := &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			d := net.Dialer{Timeout: time.Second * 10}
+			return d.DialContext(ctx, "udp4", s.Resolver)
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*10)
+	defer cancel()
+
+	addrs, err := resolver.LookupNetIP(ctx, "ip4", s.Host)
+	if err != nil {
+		return
+	}
+	if len(addrs) == 0 {
+		err = fmt.Errorf("No IPv4 address returned for %v by %v", s.Host, s.Resolver)
+		return
+	}
+
+	addr = addrs[0].Unmap()
+	return
+}
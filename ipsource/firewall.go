@@ -0,0 +1,185 @@
+package ipsource
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/netip"
+	"strings"
+	"time"
+)
+
+//firewallURL adds https to an address without a scheme
+func firewallURL(address string) string {
+	if !strings.Contains(address, "://") {
+		address = "https://" + address
+	}
+	return strings.TrimSuffix(address, "/")
+}
+
+//getJSON sends req and parses the JSON response into msg
+func getJSON(ctx context.Context, client *http.Client, req *http.Request, msg interface{}) (err error) {
+
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return
+	}
+	if resp.StatusCode != http.StatusOK {
+		err = fmt.Errorf("Request for %v returned status %d: %.100s", req.URL, resp.StatusCode, body)
+		return
+	}
+
+	if err = json.Unmarshal(body, msg); err != nil {
+		err = fmt.Errorf("Error parsing response from %v: %v", req.URL, err)
+	}
+	return
+}
+
+//PfSense reads the WAN address from a pfSense firewall using the REST API package (v2).
+//Authenticates with basic auth if Username is set, otherwise with Password as an API key.
+type PfSense struct {
+	URL string
+	//Interface is the pfSense interface name or description, eg wan
+	Interface string
+	Username  string
+	Password  string
+	Client    *http.Client
+}
+
+//pfSenseInterfacesMessage is the excerpt of the /api/v2/status/interfaces response
+type pfSenseInterfacesMessage struct {
+	Data []struct {
+		Name   string `json:"name"`
+		Descr  string `json:"descr"`
+		IPAddr string `json:"ipaddr"`
+	} `json:"data"`
+}
+
+//NewPfSense returns a PfSense source for the firewall at address, using the wan interface if iface is empty
+func NewPfSense(address string, iface string) *PfSense {
+	if iface == "" {
+		iface = "wan"
+	}
+	return &PfSense{
+		URL:       firewallURL(address),
+		Interface: iface,
+		Client: &http.Client{
+			Timeout: time.Second * 10,
+		},
+	}
+}
+
+//Name describes the firewall
+func (s *PfSense) Name() string {
+	return fmt.Sprintf("pfsense:%s/%s", s.URL, s.Interface)
+}
+
+//Detect reads the interface status and returns the interface's address
+func (s *PfSense) Detect(ctx context.Context) (addr netip.Addr, err error) {
+
+	req, err := http.NewRequest("GET", s.URL+"/api/v2/status/interfaces", nil)
+	if err != nil {
+		return
+	}
+	if s.Username != "" {
+		req.SetBasicAuth(s.Username, s.Password)
+	} else {
+		req.Header.Set("X-API-Key", s.Password)
+	}
+
+	var msg pfSenseInterfacesMessage
+	if err = getJSON(ctx, s.Client, req, &msg); err != nil {
+		return
+	}
+
+	for _, iface := range msg.Data {
+		if strings.EqualFold(iface.Name, s.Interface) || strings.EqualFold(iface.Descr, s.Interface) {
+			return parseAddr(s, iface.IPAddr)
+		}
+	}
+
+	err = fmt.Errorf("Interface %v not found on %v", s.Interface, s.URL)
+	return
+}
+
+//OPNsense reads the WAN address from an OPNsense firewall using its API.
+//Username and Password are the API key and secret.
+type OPNsense struct {
+	URL string
+	//Interface is the device name, eg igb0. If empty the first public IPv4 address is used.
+	Interface string
+	Username  string
+	Password  string
+	Client    *http.Client
+}
+
+//opnSenseInterfaceConfig is the excerpt of an interface in the getInterfaceConfig response
+type opnSenseInterfaceConfig struct {
+	IPv4 []struct {
+		IPAddr string `json:"ipaddr"`
+	} `json:"ipv4"`
+}
+
+//NewOPNsense returns an OPNsense source for the firewall at address
+func NewOPNsense(address string, iface string) *OPNsense {
+	return &OPNsense{
+		URL:       firewallURL(address),
+		Interface: iface,
+		Client: &http.Client{
+			Timeout: time.Second * 10,
+		},
+	}
+}
+
+//Name describes the firewall
+func (s *OPNsense) Name() string {
+	if s.Interface != "" {
+		return fmt.Sprintf("opnsense:%s/%s", s.URL, s.Interface)
+	}
+	return "opnsense:" + s.URL
+}
+
+//Detect reads the interface configuration and returns the WAN address
+func (s *OPNsense) Detect(ctx context.Context) (addr netip.Addr, err error) {
+
+	req, err := http.NewRequest("GET", s.URL+"/api/diagnostics/interface/getInterfaceConfig", nil)
+	if err != nil {
+		return
+	}
+	req.SetBasicAuth(s.Username, s.Password)
+
+	var msg map[string]opnSenseInterfaceConfig
+	if err = getJSON(ctx, s.Client, req, &msg); err != nil {
+		return
+	}
+
+	if s.Interface != "" {
+		iface, ok := msg[s.Interface]
+		if !ok || len(iface.IPv4) == 0 {
+			err = fmt.Errorf("No IPv4 address found on interface %v of %v", s.Interface, s.URL)
+			return
+		}
+		return parseAddr(s, iface.IPv4[0].IPAddr)
+	}
+
+	for _, iface := range msg {
+		for _, ipv4 := range iface.IPv4 {
+			candidate, parseErr := netip.ParseAddr(ipv4.IPAddr)
+			if parseErr == nil && IsPublic(candidate) {
+				addr = candidate
+				return
+			}
+		}
+	}
+
+	err = fmt.Errorf("No public IPv4 address found on %v", s.URL)
+	return
+}
@@ -0,0 +1,122 @@
+package ipsource
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"time"
+)
+
+//MaxHTTPResponse is the most of an echo service's response that is read.
+//An IP address is a few dozen bytes at most, so anything longer is not a valid answer.
+const MaxHTTPResponse = 1024
+
+//maxHTTPRedirects is how many redirects an echo service may send before giving up
+const maxHTTPRedirects = 3
+
+//HTTP is an echo service that returns the caller's IP as the entire response body, eg:
+//http://ipinfo.io/ip
+//http://icanhazip.com
+//http://checkip.amazonaws.com/
+type HTTP struct {
+	URL    string
+	Client *http.Client
+}
+
+//NewHTTP returns an HTTP source for url with a 10 second timeout.
+//The timeout covers reading the body as well as connecting, so a source that stalls mid-response can't hang the run.
+func NewHTTP(url string) *HTTP {
+	return &HTTP{
+		URL: url,
+		Client: &http.Client{
+			Timeout:       time.Second * 10,
+			CheckRedirect: checkRedirect,
+		},
+	}
+}
+
+//checkRedirect follows a few redirects, but not from https to http where the answer could be tampered with
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) > maxHTTPRedirects {
+		return fmt.Errorf("Stopped after %d redirects", maxHTTPRedirects)
+	}
+	if via[0].URL.Scheme == "https" && req.URL.Scheme != "https" {
+		return errors.New("Refusing to follow redirect from https to " + req.URL.String())
+	}
+	return nil
+}
+
+//ForceNetwork makes requests connect over network, "tcp4" or "tcp6", rather than whichever the system prefers.
+//On a dual-stack network this picks which of the addresses the service reports.
+func (s *HTTP) ForceNetwork(network string) {
+	dialer := &net.Dialer{Timeout: time.Second * 10}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = func(ctx context.Context, _ string, addr string) (net.Conn, error) {
+		return dialer.DialContext(ctx, network, addr)
+	}
+	s.Client.Transport = transport
+}
+
+//Name returns the url of the service
+func (s *HTTP) Name() string {
+	return s.URL
+}
+
+//Detect requests the IP from the service
+func (s *HTTP) Detect(ctx context.Context) (addr netip.Addr, err error) {
+
+	req, err := http.NewRequestWithContext(ctx, "GET", s.URL, nil)
+	if err != nil {
+		return
+	}
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return
+	}
+	if resp == nil {
+		err = fmt.Errorf("Error requesting WAN IP from %v", s.URL)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		err = fmt.Errorf("Error requesting WAN IP from %v: status %d", s.URL, resp.StatusCode)
+		return
+	}
+
+	//Echo services answer in text, though not always labelled text/plain, eg ipecho.net/plain says text/html. Any text
+	//is parsed, and only an address is accepted from it, so an error or login page still fails. Anything else, such
+	//as an image, isn't the answer.
+	if contentType := resp.Header.Get("Content-Type"); contentType != "" {
+		mediaType, _, _ := mime.ParseMediaType(contentType)
+		if !strings.HasPrefix(mediaType, "text/") {
+			err = fmt.Errorf("Response from %v has content type %v, expected text", s.URL, contentType)
+			return
+		}
+	}
+
+	if resp.ContentLength > MaxHTTPResponse {
+		err = fmt.Errorf("Response from %v is too large (%d bytes)", s.URL, resp.ContentLength)
+		return
+	}
+
+	//Read one byte more than allowed so an oversized body can be told apart from one exactly at the limit
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, MaxHTTPResponse+1))
+	if err != nil {
+		return
+	}
+	if len(data) > MaxHTTPResponse {
+		err = fmt.Errorf("Response from %v is larger than %d bytes", s.URL, MaxHTTPResponse)
+		return
+	}
+
+	return parseAddr(s, strings.TrimSpace(string(data)))
+}
@@ -0,0 +1,86 @@
+package ipsource
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHTTPDetect(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		status      int
+		contentType string
+		body        string
+		want        string
+	}{
+		{"plain", http.StatusOK, "text/plain", "203.0.113.10\n", "203.0.113.10"},
+		{"html labelled", http.StatusOK, "text/html; charset=utf-8", " 203.0.113.10 ", "203.0.113.10"},
+		{"no content type", http.StatusOK, "", "203.0.113.10", "203.0.113.10"},
+		{"ipv6", http.StatusOK, "text/plain", "2001:db8::1", "2001:db8::1"},
+		{"mapped ipv4", http.StatusOK, "text/plain", "::ffff:203.0.113.10", "203.0.113.10"},
+		{"error status", http.StatusServiceUnavailable, "text/plain", "203.0.113.10", ""},
+		{"image", http.StatusOK, "image/png", "203.0.113.10", ""},
+		{"not an address", http.StatusOK, "text/html", "<html>Log in</html>", ""},
+		{"too large", http.StatusOK, "text/plain", strings.Repeat(" ", MaxHTTPResponse) + "203.0.113.10", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header()["Content-Type"] = []string{test.contentType}
+				w.WriteHeader(test.status)
+				w.Write([]byte(test.body))
+			}))
+			defer srv.Close()
+
+			addr, err := NewHTTP(srv.URL).Detect(context.Background())
+			if test.want == "" {
+				if err == nil {
+					t.Errorf("Detect returned %v, expected an error", addr)
+				}
+				return
+			}
+			if err != nil || addr.String() != test.want {
+				t.Errorf("Detect returned %v, %v, want %v", addr, err, test.want)
+			}
+		})
+	}
+}
+
+func TestCheckRedirect(t *testing.T) {
+
+	request := func(url string) *http.Request {
+		req, err := http.NewRequest("GET", url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return req
+	}
+
+	tests := []struct {
+		name    string
+		via     []string
+		to      string
+		wantErr bool
+	}{
+		{"http to https", []string{"http://ip.example"}, "https://ip.example", false},
+		{"https to https", []string{"https://ip.example"}, "https://other.example", false},
+		{"https to http", []string{"https://ip.example"}, "http://ip.example", true},
+		{"too many", []string{"http://a.example", "http://b.example", "http://c.example", "http://d.example"}, "http://e.example", true},
+	}
+
+	for _, test := range tests {
+		var via []*http.Request
+		for _, url := range test.via {
+			via = append(via, request(url))
+		}
+		if err := checkRedirect(request(test.to), via); (err != nil) != test.wantErr {
+			t.Errorf("%v: checkRedirect returned %v, want error %v", test.name, err, test.wantErr)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package ipsource
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+)
+
+//Interface reads the address assigned to a local network interface.
+//This is useful where the machine holds the public IP itself, such as a router or a host on a PPPoE link.
+type Interface struct {
+	//InterfaceName is the name of the interface, eg eth0 or ppp0.
+	//If empty the interface holding the default route is used, picked again on each detection
+	//so changes to routes or interface names are followed.
+	InterfaceName string
+
+	//AllowPrivate returns a private or carrier-grade NAT address when the interface has no public one.
+	//Off by default, as such an address is only the inside of a NAT and can't be reached from the internet.
+	AllowPrivate bool
+}
+
+//ErrNotPublic is returned when an interface only has private addresses, so the source answered but with nothing to publish
+var ErrNotPublic = errors.New("No public address")
+
+//NewInterface returns a source for the named interface
+func NewInterface(name string) *Interface {
+	return &Interface{
+		InterfaceName: name,
+	}
+}
+
+//Name describes the interface
+func (s *Interface) Name() string {
+	if s.InterfaceName == "" {
+		return "interface:auto"
+	}
+	return "interface:" + s.InterfaceName
+}
+
+//Detect returns the first public IPv4 address on the interface
+func (s *Interface) Detect(ctx context.Context) (addr netip.Addr, err error) {
+
+	var iface *net.Interface
+	if s.InterfaceName == "" {
+		iface, err = defaultRouteInterface()
+	} else {
+		iface, err = net.InterfaceByName(s.InterfaceName)
+	}
+	if err != nil {
+		return
+	}
+
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return
+	}
+
+	var ips []netip.Addr
+	for _, a := range addrs {
+		ipNet, ok := a.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		if ip, ok := netip.AddrFromSlice(ipNet.IP); ok {
+			ips = append(ips, ip.Unmap())
+		}
+	}
+
+	return pickAddr(iface.Name, ips, s.AllowPrivate)
+}
+
+//pickAddr chooses the address to publish from those on an interface: the first public IPv4 address,
+//or with allowPrivate the first private or carrier-grade NAT one if there is no public address
+func pickAddr(ifaceName string, ips []netip.Addr, allowPrivate bool) (addr netip.Addr, err error) {
+
+	var private netip.Addr
+	for _, ip := range ips {
+		if !ip.Is4() || !ip.IsGlobalUnicast() {
+			continue
+		}
+		if IsPublic(ip) {
+			addr = ip
+			return
+		}
+		if !private.IsValid() {
+			private = ip
+		}
+	}
+
+	switch {
+	case private.IsValid() && allowPrivate:
+		addr = private
+	case private.IsValid():
+		err = fmt.Errorf("%w: interface %v only has the private address %v, which can't be reached from the internet. Use an echo service or stun to find the public IP behind NAT, or set -interface-allow-private to publish it anyway", ErrNotPublic, ifaceName, private)
+	default:
+		err = fmt.Errorf("No IPv4 address found on interface %v", ifaceName)
+	}
+	return
+}
+
+//defaultRouteInterface returns the interface the system would use to reach the internet.
+//Connecting a UDP socket sends nothing, but makes the system choose a route, taking metrics into account.
+func defaultRouteInterface() (iface *net.Interface, err error) {
+
+	conn, err := net.Dial("udp4", "1.1.1.1:53")
+	if err != nil {
+		err = fmt.Errorf("No default route: %v", err)
+		return
+	}
+	localIP := conn.LocalAddr().(*net.UDPAddr).IP
+	conn.Close()
+
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return
+	}
+
+	for i := range ifaces {
+		addrs, addrErr := ifaces[i].Addrs()
+		if addrErr != nil {
+			continue
+		}
+		for _, a := range addrs {
+			if ipNet, ok := a.(*net.IPNet); ok && ipNet.IP.Equal(localIP) {
+				iface = &ifaces[i]
+				return
+			}
+		}
+	}
+
+	err = fmt.Errorf("No interface found holding the default route address %v", localIP)
+	return
+}
@@ -0,0 +1,46 @@
+package ipsource
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestPickAddr(t *testing.T) {
+
+	addrs := func(list ...string) (ips []netip.Addr) {
+		for _, a := range list {
+			ips = append(ips, netip.MustParseAddr(a))
+		}
+		return
+	}
+
+	tests := []struct {
+		name         string
+		ips          []netip.Addr
+		allowPrivate bool
+		want         string
+		wantErr      bool
+	}{
+		{"public", addrs("203.0.113.10"), false, "203.0.113.10", false},
+		{"public after private", addrs("192.168.1.2", "203.0.113.10"), false, "203.0.113.10", false},
+		{"rfc1918", addrs("192.168.1.2"), false, "", true},
+		{"cgnat", addrs("100.64.12.1"), false, "", true},
+		{"ula and link local only", addrs("fd00::1", "fe80::1"), false, "", true},
+		{"private allowed", addrs("fe80::1", "10.0.0.5"), true, "10.0.0.5", false},
+		{"public preferred when private allowed", addrs("10.0.0.5", "203.0.113.10"), true, "203.0.113.10", false},
+		{"loopback only", addrs("127.0.0.1"), true, "", true},
+		{"none", nil, false, "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			addr, err := pickAddr("eth0", test.ips, test.allowPrivate)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("error %v, want error %v", err, test.wantErr)
+			}
+			if !test.wantErr && addr.String() != test.want {
+				t.Errorf("got %v, want %v", addr, test.want)
+			}
+		})
+	}
+}
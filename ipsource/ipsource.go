@@ -0,0 +1,67 @@
+//Package ipsource detects the public IP address of the network it is running on.
+//
+//Each detection method implements Source, so they can be used interchangeably
+//and new methods can be added without changes to the callers.
+package ipsource
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+//Source is a method of detecting the public IP address
+type Source interface {
+	//Name describes the source for logging
+	Name() string
+	//Detect returns the IP address reported by the source
+	Detect(ctx context.Context) (netip.Addr, error)
+}
+
+//Parse returns the built-in source described by spec:
+//
+//	http://... or https://...     HTTP echo service returning the IP as the body
+//	dns                           OpenDNS myip.opendns.com lookup
+//	stun                          STUN binding request
+//	upnp                          WAN address of the local UPnP internet gateway
+//	interface:<name>              address assigned to a local network interface
+//	interface or interface:auto   address of the interface holding the default route
+//	command:<path>                first line printed by an executable
+func Parse(spec string) (Source, error) {
+
+	switch {
+	case strings.HasPrefix(spec, "http://"), strings.HasPrefix(spec, "https://"):
+		return NewHTTP(spec), nil
+	case spec == "dns":
+		return NewDNS(), nil
+	case spec == "stun":
+		return NewSTUN(), nil
+	case spec == "upnp":
+		return NewUPnP(), nil
+	case spec == "interface", spec == "interface:auto":
+		return NewInterface(""), nil
+	case strings.HasPrefix(spec, "interface:"):
+		return NewInterface(strings.TrimPrefix(spec, "interface:")), nil
+	case strings.HasPrefix(spec, "command:") && spec != "command:":
+		return NewCommand(strings.TrimPrefix(spec, "command:")), nil
+	}
+
+	return nil, fmt.Errorf("Unknown IP source '%v' (expected a URL, dns, stun, upnp, interface:<name> or command:<path>)", spec)
+}
+
+//parseAddr parses an address returned by a source, reporting which source it came from on failure
+func parseAddr(source Source, value string) (addr netip.Addr, err error) {
+
+	value = strings.TrimSpace(value)
+
+	addr, parseErr := netip.ParseAddr(value)
+	if parseErr != nil {
+		err = fmt.Errorf("Response from %v does not look like an IP address: %.25s", source.Name(), value)
+		return
+	}
+
+	//Drop any zone and unwrap IPv4 addresses returned in IPv6 form
+	addr = addr.WithZone("").Unmap()
+	return
+}
@@ -0,0 +1,37 @@
+package ipsource
+
+import (
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+
+	tests := []struct {
+		spec     string
+		wantName string
+		wantErr  bool
+	}{
+		{spec: "https://icanhazip.com", wantName: "https://icanhazip.com"},
+		{spec: "dns", wantName: "dns:myip.opendns.com@208.67.222.222:53"},
+		{spec: "upnp", wantName: "upnp"},
+		{spec: "stun", wantName: "stun:stun.l.google.com:19302"},
+		{spec: "interface", wantName: "interface:auto"},
+		{spec: "interface:auto", wantName: "interface:auto"},
+		{spec: "interface:ppp0", wantName: "interface:ppp0"},
+		{spec: "command:/usr/local/bin/wan-ip", wantName: "command:/usr/local/bin/wan-ip"},
+		{spec: "command:", wantErr: true},
+		{spec: "ftp://example.com", wantErr: true},
+		{spec: "", wantErr: true},
+	}
+
+	for _, test := range tests {
+		source, err := Parse(test.spec)
+		if (err != nil) != test.wantErr {
+			t.Errorf("Parse(%q) error %v, want error %v", test.spec, err, test.wantErr)
+			continue
+		}
+		if !test.wantErr && source.Name() != test.wantName {
+			t.Errorf("Parse(%q) is %v, want %v", test.spec, source.Name(), test.wantName)
+		}
+	}
+}
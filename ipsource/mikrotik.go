@@ -0,0 +1,119 @@
+package ipsource
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"time"
+)
+
+//mikrotikAddress is the excerpt of a RouterOS /ip/address entry
+type mikrotikAddress struct {
+	Address   string `json:"address"`
+	Interface string `json:"interface"`
+	Disabled  string `json:"disabled"`
+	Invalid   string `json:"invalid"`
+}
+
+//MikroTik reads the WAN address from a MikroTik router using the RouterOS REST API (RouterOS 7.1 and later).
+//If Interface is empty the first public IPv4 address on any interface is used.
+type MikroTik struct {
+	//URL is the router's web address, eg https://192.168.88.1
+	URL       string
+	Interface string
+	Username  string
+	Password  string
+	Client    *http.Client
+}
+
+//NewMikroTik returns a MikroTik source for the router at address, which can be a host name or URL.
+//https is used if no scheme is given, as the REST API requires it.
+func NewMikroTik(address string, iface string) *MikroTik {
+	if !strings.Contains(address, "://") {
+		address = "https://" + address
+	}
+	return &MikroTik{
+		URL:       strings.TrimSuffix(address, "/"),
+		Interface: iface,
+		Client: &http.Client{
+			Timeout: time.Second * 10,
+		},
+	}
+}
+
+//Name describes the router
+func (s *MikroTik) Name() string {
+	if s.Interface != "" {
+		return fmt.Sprintf("mikrotik:%s/%s", s.URL, s.Interface)
+	}
+	return "mikrotik:" + s.URL
+}
+
+//Detect lists the router's addresses and returns the WAN address
+func (s *MikroTik) Detect(ctx context.Context) (addr netip.Addr, err error) {
+
+	reqURL := s.URL + "/rest/ip/address"
+	if s.Interface != "" {
+		reqURL += "?interface=" + url.QueryEscape(s.Interface)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", reqURL, nil)
+	if err != nil {
+		return
+	}
+	req.SetBasicAuth(s.Username, s.Password)
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return
+	}
+	if resp.StatusCode != http.StatusOK {
+		err = fmt.Errorf("RouterOS API at %v returned status %d: %.100s", s.URL, resp.StatusCode, body)
+		return
+	}
+
+	var addresses []mikrotikAddress
+	if err = json.Unmarshal(body, &addresses); err != nil {
+		err = fmt.Errorf("Error parsing RouterOS address list: %v", err)
+		return
+	}
+
+	for _, a := range addresses {
+		if a.Disabled == "true" || a.Invalid == "true" {
+			continue
+		}
+		if s.Interface != "" && a.Interface != s.Interface {
+			continue
+		}
+
+		//Addresses are in CIDR form, eg 203.0.113.5/24
+		prefix, parseErr := netip.ParsePrefix(a.Address)
+		if parseErr != nil || !prefix.Addr().Is4() {
+			continue
+		}
+		if s.Interface == "" && !IsPublic(prefix.Addr()) {
+			continue
+		}
+
+		addr = prefix.Addr()
+		return
+	}
+
+	if s.Interface != "" {
+		err = fmt.Errorf("No IPv4 address found on interface %v of %v", s.Interface, s.URL)
+	} else {
+		err = fmt.Errorf("No public IPv4 address found on %v", s.URL)
+	}
+	return
+}
@@ -0,0 +1,105 @@
+package ipsource
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/netip"
+	"regexp"
+	"time"
+)
+
+//ipv4RX finds IPv4 addresses anywhere in a page
+var ipv4RX = regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}\b`)
+
+//Scrape extracts the WAN IP from a web page, such as a router's status page.
+//If Pattern is set its first capture group (or the whole match if it has none) is used,
+//otherwise the first public IPv4 address on the page is used.
+type Scrape struct {
+	URL      string
+	Pattern  *regexp.Regexp
+	Username string
+	Password string
+	Client   *http.Client
+}
+
+//NewScrape returns a Scrape source for url with a 10 second timeout
+func NewScrape(url string, pattern *regexp.Regexp) *Scrape {
+	return &Scrape{
+		URL:     url,
+		Pattern: pattern,
+		Client: &http.Client{
+			Timeout: time.Second * 10,
+		},
+	}
+}
+
+//Name describes the page
+func (s *Scrape) Name() string {
+	return "scrape:" + s.URL
+}
+
+//Detect fetches the page and extracts the address
+func (s *Scrape) Detect(ctx context.Context) (addr netip.Addr, err error) {
+
+	req, err := http.NewRequestWithContext(ctx, "GET", s.URL, nil)
+	if err != nil {
+		return
+	}
+	if s.Username != "" || s.Password != "" {
+		req.SetBasicAuth(s.Username, s.Password)
+	}
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		err = fmt.Errorf("Request for %v returned status %d", s.URL, resp.StatusCode)
+		return
+	}
+
+	page, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return
+	}
+
+	if s.Pattern != nil {
+		match := s.Pattern.FindSubmatch(page)
+		if match == nil {
+			err = fmt.Errorf("Pattern %v did not match the page at %v", s.Pattern, s.URL)
+			return
+		}
+		value := match[0]
+		if len(match) > 1 {
+			value = match[1]
+		}
+		return parseAddr(s, string(value))
+	}
+
+	for _, value := range ipv4RX.FindAll(page, -1) {
+		candidate, parseErr := netip.ParseAddr(string(value))
+		if parseErr == nil && IsPublic(candidate) {
+			addr = candidate
+			return
+		}
+	}
+
+	err = fmt.Errorf("No public IPv4 address found on the page at %v", s.URL)
+	return
+}
+
+//cgnatPrefix is the shared address space used for carrier-grade NAT (RFC 6598)
+var cgnatPrefix = netip.MustParsePrefix("100.64.0.0/10")
+
+//IsPublic reports whether addr is usable on the internet,
+//ie not private, carrier-grade NAT, loopback, link local, multicast or unspecified
+func IsPublic(addr netip.Addr) bool {
+	return addr.IsValid() &&
+		addr.IsGlobalUnicast() &&
+		!addr.IsPrivate() &&
+		!cgnatPrefix.Contains(addr)
+}
@@ -0,0 +1,93 @@
+package ipsource
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"regexp"
+	"testing"
+)
+
+func TestIsPublic(t *testing.T) {
+
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{"203.0.113.10", true},
+		{"2001:db8::1", true},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"100.64.0.1", false},
+		{"100.127.255.254", false},
+		{"100.128.0.1", true},
+		{"127.0.0.1", false},
+		{"169.254.1.1", false},
+		{"fd12:3456::1", false},
+		{"fe80::1", false},
+		{"224.0.0.1", false},
+		{"0.0.0.0", false},
+	}
+
+	for _, test := range tests {
+		if got := IsPublic(netip.MustParseAddr(test.addr)); got != test.want {
+			t.Errorf("IsPublic(%v) = %v, want %v", test.addr, got, test.want)
+		}
+	}
+	if IsPublic(netip.Addr{}) {
+		t.Error("IsPublic of the zero address is true")
+	}
+}
+
+func TestScrapeDetect(t *testing.T) {
+
+	const page = `<html><p>LAN 192.168.1.1</p><p>Gateway 100.64.0.1</p><p>WAN <b id="wan">203.0.113.10</b></p><p>DNS 198.51.100.53</p></html>`
+
+	tests := []struct {
+		name    string
+		pattern string
+		user    string
+		want    string
+	}{
+		{"first public address", "", "", "203.0.113.10"},
+		{"capture group", `DNS ([\d.]+)`, "", "198.51.100.53"},
+		{"whole match", `\d+\.\d+\.\d+\.53`, "", "198.51.100.53"},
+		{"pattern not matching", `WAN6 ([\d:]+)`, "", ""},
+		{"not an address", `<b id="wan">(\w+)`, "", ""},
+		{"login needed", "", "wrong", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if user, _, ok := r.BasicAuth(); ok && user != "admin" {
+					http.Error(w, "unauthorized", http.StatusUnauthorized)
+					return
+				}
+				w.Write([]byte(page))
+			}))
+			defer srv.Close()
+
+			var pattern *regexp.Regexp
+			if test.pattern != "" {
+				pattern = regexp.MustCompile(test.pattern)
+			}
+			source := NewScrape(srv.URL, pattern)
+			source.Username = test.user
+
+			addr, err := source.Detect(context.Background())
+			if test.want == "" {
+				if err == nil {
+					t.Errorf("Detect returned %v, expected an error", addr)
+				}
+				return
+			}
+			if err != nil || addr.String() != test.want {
+				t.Errorf("Detect returned %v, %v, want %v", addr, err, test.want)
+			}
+		})
+	}
+}
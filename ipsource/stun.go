@@ -0,0 +1,115 @@
+package ipsource
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/netip"
+	"time"
+)
+
+const (
+	stunMagicCookie          = 0x2112A442
+	stunBindingRequest       = 0x0001
+	stunBindingSuccess       = 0x0101
+	stunAttrMappedAddress    = 0x0001
+	stunAttrXorMappedAddress = 0x0020
+)
+
+//STUN sends a binding request (RFC 5389) and reads the mapped address from the response
+type STUN struct {
+	//Server is the host:port of the STUN server
+	Server string
+}
+
+//NewSTUN returns a STUN source using Google's public server
+func NewSTUN() *STUN {
+	return &STUN{
+		Server: "stun.l.google.com:19302",
+	}
+}
+
+//Name describes the server
+func (s *STUN) Name() string {
+	return "stun:" + s.Server
+}
+
+//Detect sends the binding request and returns the IPv4 mapped address
+func (s *STUN) Detect(ctx context.Context) (addr netip.Addr, err error) {
+
+	d := net.Dialer{Timeout: time.Second * 10}
+	conn, err := d.DialContext(ctx, "udp4", s.Server)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	//Header: type, length, magic cookie, 12 byte transaction id
+	req := make([]byte, 20)
+	binary.BigEndian.PutUint16(req[0:2], stunBindingRequest)
+	binary.BigEndian.PutUint16(req[2:4], 0)
+	binary.BigEndian.PutUint32(req[4:8], stunMagicCookie)
+	if _, err = rand.Read(req[8:20]); err != nil {
+		return
+	}
+
+	deadline := time.Now().Add(time.Second * 10)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	conn.SetDeadline(deadline)
+
+	if _, err = conn.Write(req); err != nil {
+		return
+	}
+
+	resp := make([]byte, 1024)
+	n, err := conn.Read(resp)
+	if err != nil {
+		return
+	}
+	resp = resp[:n]
+
+	if len(resp) < 20 || binary.BigEndian.Uint16(resp[0:2]) != stunBindingSuccess || !bytes.Equal(resp[8:20], req[8:20]) {
+		err = fmt.Errorf("Unexpected response from STUN server %v", s.Server)
+		return
+	}
+
+	//Walk the attributes looking for an IPv4 mapped address
+	attrs := resp[20:]
+	for len(attrs) >= 4 {
+		attrType := binary.BigEndian.Uint16(attrs[0:2])
+		attrLen := int(binary.BigEndian.Uint16(attrs[2:4]))
+		if len(attrs) < 4+attrLen {
+			break
+		}
+		value := attrs[4 : 4+attrLen]
+
+		if (attrType == stunAttrXorMappedAddress || attrType == stunAttrMappedAddress) && attrLen >= 8 && value[1] == 0x01 {
+			var ip [4]byte
+			copy(ip[:], value[4:8])
+			if attrType == stunAttrXorMappedAddress {
+				var cookie [4]byte
+				binary.BigEndian.PutUint32(cookie[:], stunMagicCookie)
+				for i := range ip {
+					ip[i] ^= cookie[i]
+				}
+			}
+			addr = netip.AddrFrom4(ip)
+			return
+		}
+
+		//Attributes are padded to 4 bytes, which a malformed response can leave off the last one
+		padded := 4 + (attrLen+3)&^3
+		if len(attrs) < padded {
+			break
+		}
+		attrs = attrs[padded:]
+	}
+
+	err = fmt.Errorf("No IPv4 mapped address in response from STUN server %v", s.Server)
+	return
+}
@@ -0,0 +1,97 @@
+package ipsource
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"testing"
+)
+
+//stunAttr returns a STUN attribute holding an IPv4 address, XORed with the magic cookie for XOR-MAPPED-ADDRESS
+func stunAttr(attrType uint16, ip [4]byte) []byte {
+	attr := make([]byte, 12)
+	binary.BigEndian.PutUint16(attr[0:2], attrType)
+	binary.BigEndian.PutUint16(attr[2:4], 8)
+	attr[5] = 0x01
+	if attrType == stunAttrXorMappedAddress {
+		var cookie [4]byte
+		binary.BigEndian.PutUint32(cookie[:], stunMagicCookie)
+		for i := range ip {
+			ip[i] ^= cookie[i]
+		}
+	}
+	copy(attr[8:12], ip[:])
+	return attr
+}
+
+func TestSTUNDetect(t *testing.T) {
+
+	wan := [4]byte{203, 0, 113, 10}
+	software := []byte{0x80, 0x22, 0x00, 0x03, 'f', 'a', 'k', 0}
+
+	tests := []struct {
+		name string
+		//reply builds the response to a request, nil to not reply at all
+		reply func(req []byte) []byte
+		want  string
+	}{
+		{"xor mapped address", func(req []byte) []byte {
+			return append(stunHeader(req, stunBindingSuccess), stunAttr(stunAttrXorMappedAddress, wan)...)
+		}, "203.0.113.10"},
+		{"mapped address after another attribute", func(req []byte) []byte {
+			return append(append(stunHeader(req, stunBindingSuccess), software...), stunAttr(stunAttrMappedAddress, wan)...)
+		}, "203.0.113.10"},
+		{"error response", func(req []byte) []byte {
+			return append(stunHeader(req, 0x0111), stunAttr(stunAttrXorMappedAddress, wan)...)
+		}, ""},
+		{"other transaction", func(req []byte) []byte {
+			other := append([]byte{}, req...)
+			other[8] ^= 0xff
+			return append(stunHeader(other, stunBindingSuccess), stunAttr(stunAttrXorMappedAddress, wan)...)
+		}, ""},
+		{"no address", func(req []byte) []byte {
+			return append(stunHeader(req, stunBindingSuccess), software...)
+		}, ""},
+		{"truncated attribute", func(req []byte) []byte {
+			return append(stunHeader(req, stunBindingSuccess), stunAttr(stunAttrXorMappedAddress, wan)[:10]...)
+		}, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			go func() {
+				buf := make([]byte, 1024)
+				n, from, err := conn.ReadFrom(buf)
+				if err != nil {
+					return
+				}
+				conn.WriteTo(test.reply(buf[:n]), from)
+			}()
+
+			addr, err := (&STUN{Server: conn.LocalAddr().String()}).Detect(context.Background())
+			if test.want == "" {
+				if err == nil {
+					t.Errorf("Detect returned %v, expected an error", addr)
+				}
+				return
+			}
+			if err != nil || addr.String() != test.want {
+				t.Errorf("Detect returned %v, %v, want %v", addr, err, test.want)
+			}
+		})
+	}
+}
+
+//stunHeader returns the header of a response of msgType to req, with the request's transaction id
+func stunHeader(req []byte, msgType uint16) []byte {
+	header := make([]byte, 20)
+	binary.BigEndian.PutUint16(header[0:2], msgType)
+	copy(header[4:20], req[4:20])
+	return header
+}
@@ -0,0 +1,221 @@
+package ipsource
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"time"
+)
+
+//upnpServiceTypes are the IGD services that can report the router's WAN address
+var upnpServiceTypes = []string{
+	"urn:schemas-upnp-org:service:WANIPConnection:1",
+	"urn:schemas-upnp-org:service:WANIPConnection:2",
+	"urn:schemas-upnp-org:service:WANPPPConnection:1",
+}
+
+//upnpDevice is the excerpt of the IGD device description needed to find the control url
+type upnpDevice struct {
+	Services []struct {
+		ServiceType string `xml:"serviceType"`
+		ControlURL  string `xml:"controlURL"`
+	} `xml:"serviceList>service"`
+	Devices []upnpDevice `xml:"deviceList>device"`
+}
+
+//upnpRootDescription is the root of the IGD device description
+type upnpRootDescription struct {
+	URLBase string     `xml:"URLBase"`
+	Device  upnpDevice `xml:"device"`
+}
+
+//upnpExternalIPResponse is the SOAP response to GetExternalIPAddress
+type upnpExternalIPResponse struct {
+	Body struct {
+		Response struct {
+			IP string `xml:"NewExternalIPAddress"`
+		} `xml:"GetExternalIPAddressResponse"`
+	} `xml:"Body"`
+}
+
+//UPnP asks the local internet gateway for its WAN address.
+//Behind carrier-grade NAT this differs from the address seen by external sources.
+type UPnP struct {
+	Client *http.Client
+}
+
+//NewUPnP returns a UPnP source with a 10 second timeout
+func NewUPnP() *UPnP {
+	return &UPnP{
+		Client: &http.Client{
+			Timeout: time.Second * 10,
+		},
+	}
+}
+
+//Name describes the source
+func (s *UPnP) Name() string {
+	return "upnp"
+}
+
+//Detect discovers the gateway and calls GetExternalIPAddress on its WAN connection service
+func (s *UPnP) Detect(ctx context.Context) (addr netip.Addr, err error) {
+
+	location, err := discoverUPnPGateway(ctx)
+	if err != nil {
+		return
+	}
+
+	controlURL, serviceType, err := s.getControlURL(ctx, location)
+	if err != nil {
+		return
+	}
+
+	soap := fmt.Sprintf(`<?xml version="1.0"?>
+<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/">
+<s:Body><u:GetExternalIPAddress xmlns:u="%s"/></s:Body>
+</s:Envelope>`, serviceType)
+
+	req, err := http.NewRequestWithContext(ctx, "POST", controlURL, strings.NewReader(soap))
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", `text/xml; charset="utf-8"`)
+	req.Header.Set("SOAPAction", fmt.Sprintf(`"%s#GetExternalIPAddress"`, serviceType))
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return
+	}
+
+	var msg upnpExternalIPResponse
+	if err = xml.Unmarshal(body, &msg); err != nil {
+		err = fmt.Errorf("Error parsing GetExternalIPAddress response: %v", err)
+		return
+	}
+
+	return parseAddr(s, msg.Body.Response.IP)
+}
+
+//discoverUPnPGateway sends an SSDP search and returns the description location of the first gateway to answer
+func discoverUPnPGateway(ctx context.Context) (location string, err error) {
+
+	conn, err := net.ListenUDP("udp4", nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	dest := &net.UDPAddr{IP: net.IPv4(239, 255, 255, 250), Port: 1900}
+
+	for _, st := range upnpServiceTypes {
+		search := "M-SEARCH * HTTP/1.1\r\n" +
+			"HOST: 239.255.255.250:1900\r\n" +
+			"MAN: \"ssdp:discover\"\r\n" +
+			"MX: 2\r\n" +
+			"ST: " + st + "\r\n\r\n"
+		if _, err = conn.WriteTo([]byte(search), dest); err != nil {
+			return
+		}
+	}
+
+	deadline := time.Now().Add(time.Second * 3)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	conn.SetReadDeadline(deadline)
+
+	buf := make([]byte, 2048)
+	for {
+		n, _, readErr := conn.ReadFrom(buf)
+		if readErr != nil {
+			err = fmt.Errorf("No UPnP internet gateway responded")
+			return
+		}
+
+		resp, parseErr := http.ReadResponse(bufio.NewReader(bytes.NewReader(buf[:n])), nil)
+		if parseErr != nil {
+			continue
+		}
+		resp.Body.Close()
+
+		if location = resp.Header.Get("Location"); location != "" {
+			return
+		}
+	}
+}
+
+//getControlURL reads the device description and returns the control url for the WAN connection service
+func (s *UPnP) getControlURL(ctx context.Context, location string) (controlURL string, serviceType string, err error) {
+
+	req, err := http.NewRequestWithContext(ctx, "GET", location, nil)
+	if err != nil {
+		return
+	}
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return
+	}
+
+	var root upnpRootDescription
+	if err = xml.Unmarshal(body, &root); err != nil {
+		err = fmt.Errorf("Error parsing gateway description: %v", err)
+		return
+	}
+
+	base := root.URLBase
+	if base == "" {
+		base = location
+	}
+	baseURL, err := url.Parse(base)
+	if err != nil {
+		return
+	}
+
+	//Services can be nested several devices deep
+	devices := []upnpDevice{root.Device}
+	for len(devices) > 0 {
+		device := devices[0]
+		devices = append(devices[1:], device.Devices...)
+
+		for _, service := range device.Services {
+			for _, st := range upnpServiceTypes {
+				if service.ServiceType != st {
+					continue
+				}
+				ref, parseErr := url.Parse(service.ControlURL)
+				if parseErr != nil {
+					err = parseErr
+					return
+				}
+				controlURL = baseURL.ResolveReference(ref).String()
+				serviceType = st
+				return
+			}
+		}
+	}
+
+	err = fmt.Errorf("Gateway at %v has no WAN connection service", location)
+	return
+}
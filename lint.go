@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jonegerton/go-cloudflare-ddns/ddns"
+)
+
+//lintFinding is a problem found by config lint. Errors stop the utility running, warnings are setups that work but are risky.
+type lintFinding struct {
+	Error   bool
+	Setting string
+	Problem string
+	Advice  string
+}
+
+//lintLongTTL is the longest TTL not warned about on a record holding the WAN IP
+const lintLongTTL = 3600
+
+//runLint checks the configuration as config show sees it, printing errors that would stop a run and warnings about risky
+//setups with what to do instead. An error is returned if there are any errors, so scripts can check the result.
+func runLint() (err error) {
+
+	findings := lintConfig()
+
+	errorCount := 0
+	for _, finding := range findings {
+		level := "warning"
+		if finding.Error {
+			level = "error"
+			errorCount++
+		}
+		setting := ""
+		if finding.Setting != "" {
+			setting = "-" + finding.Setting + ": "
+		}
+		fmt.Printf("%v: %v%v\n", level, setting, finding.Problem)
+		if finding.Advice != "" {
+			fmt.Printf("    %v\n", finding.Advice)
+		}
+	}
+
+	if len(findings) == 0 {
+		fmt.Println("No problems found.")
+		return
+	}
+	fmt.Printf("\n%d errors, %d warnings\n", errorCount, len(findings)-errorCount)
+	if errorCount > 0 {
+		return fmt.Errorf("Config lint found %d errors", errorCount)
+	}
+
+	return
+}
+
+//lintConfig returns the problems with the configuration
+func lintConfig() (findings []lintFinding) {
+
+	add := func(isError bool, setting string, problem string, advice string) {
+		findings = append(findings, lintFinding{Error: isError, Setting: setting, Problem: problem, Advice: advice})
+	}
+
+	//Errors, as the utility would report them when run
+	if cfg.Token == "" && (cfg.User == "" || cfg.Key == "") {
+		add(true, "cftoken", "No credentials are set", "Set -cftoken to an API token with permission to edit DNS in the zone.")
+	}
+	if cfg.Zone == "" {
+		add(true, "cfzone", "No zone is set", "")
+	}
+	if len(cfhosts) == 0 && hostsFrom == "" && !cfg.UpdateAllMatching {
+		add(true, "cfhost", "No host entries are set", "")
+	}
+
+	var err error
+	if cfg.Notify, err = ddns.ParseNotifyChannels(notifyValues); err != nil {
+		add(true, "notify", err.Error(), "")
+	}
+	if cfg.UpdateWindows, err = ddns.ParseUpdateWindows(windowValues); err != nil {
+		add(true, "update-window", err.Error(), "")
+	}
+	if cfg.IPFilters, err = ddns.ParseIPFilters(filterValues); err != nil {
+		add(true, "ip-filter", err.Error(), "")
+	}
+
+	var extraHosts []ddns.Host
+	if hostsFrom != "" && hostsFrom != "-" {
+		if extraHosts, err = readHostsFrom(hostsFrom); err != nil {
+			add(true, "hosts-from", err.Error(), "")
+		}
+	}
+	updater, err := newUpdater(extraHosts)
+	if err != nil {
+		add(true, "", err.Error(), "")
+	}
+
+	//Warnings about setups that work but could go wrong
+	if cfg.Key != "" {
+		add(false, "cfkey", "The Global API Key is used",
+			"It can change anything in the account. Create an API token with permission to edit DNS in this zone only, and use -cftoken instead.")
+	}
+
+	sources := append([]string{cfg.IPSource}, peerValues...)
+	if updater != nil {
+		for _, host := range updater.Hosts() {
+			if host.Source != "" {
+				sources = append(sources, host.Source)
+			}
+		}
+	}
+	for _, source := range sources {
+		if strings.HasPrefix(strings.TrimPrefix(source, "scrape:"), "http://") {
+			add(false, "wan-ip-source", fmt.Sprintf("IP source %v is plain HTTP", source),
+				"Anyone on the way could change the answer and point the records at another address. Use an https:// URL, or check it with -confirm-with.")
+		}
+	}
+	if cfg.ConfirmWith != "" && strings.HasPrefix(cfg.ConfirmWith, "http://") {
+		add(false, "confirm-with", fmt.Sprintf("%v is plain HTTP", cfg.ConfirmWith), "Use an https:// URL, so the check can't be changed on the way.")
+	}
+	if cfg.RouterInsecure {
+		add(false, "router-insecure", "The router's TLS certificate isn't checked",
+			"Anyone on the network could pose as the router and give another IP, and see the router password. Install a certificate on the router, or trust its own.")
+	}
+
+	if updater != nil {
+		for _, host := range updater.Hosts() {
+			if host.TTL > lintLongTTL && strings.Contains(host.Content, "{ip}") {
+				add(false, "ttl", fmt.Sprintf("%v has a TTL of %v", host, time.Duration(host.TTL)*time.Second),
+					"Resolvers can keep giving out the old IP for that long after it changes. Use auto or a few minutes for records holding the WAN IP.")
+			}
+		}
+	}
+
+	for _, channel := range cfg.Notify {
+		if strings.HasPrefix(channel.URL, "http://") {
+			add(false, "notify", fmt.Sprintf("Notify channel %v is plain HTTP", maskedValue("notify", channel.URL)),
+				"Webhook URLs usually hold a secret, and the messages list your IP. Use an https:// URL.")
+		}
+	}
+
+	if cfg.Interval > 0 && cfg.Interval < time.Minute {
+		add(false, "interval", fmt.Sprintf("The IP is checked every %v", cfg.Interval),
+			"Public IP services may block clients that ask this often. Every few minutes is enough for most connections.")
+	}
+
+	var secrets []string
+	for name := range secretFlags {
+		secrets = append(secrets, name)
+	}
+	sort.Strings(secrets)
+	for _, name := range secrets {
+		if flagSources[name] == "flag" {
+			add(false, name, "A secret is given on the command line",
+				fmt.Sprintf("Other users can see command lines, eg with ps. Set %v in the environment, or in a -config file only you can read.", envName(name)))
+		}
+	}
+	if configPath != "" {
+		if info, statErr := os.Stat(configPath); statErr == nil && info.Mode().Perm()&0077 != 0 && configHasSecrets() {
+			add(false, "config", fmt.Sprintf("%v holds secrets but can be read by other users", configPath),
+				fmt.Sprintf("Make it readable only by you, eg chmod 600 %v.", configPath))
+		}
+	}
+
+	if fsType := filesystemType(filepath.Dir(savePath)); fsType == "tmpfs" || fsType == "ramfs" {
+		add(false, "", fmt.Sprintf("The saved data %v is on %v, so is lost on reboot", savePath, fsType),
+			"Each reboot starts again from what the records hold, and loses the statistics and notification history. Run from a directory on persistent storage.")
+	}
+
+	return
+}
+
+//configHasSecrets reports whether any secret setting came from the -config file
+func configHasSecrets() bool {
+	for name := range secretFlags {
+		if flagSources[name] == "file" {
+			return true
+		}
+	}
+	return false
+}
+
+//filesystemType returns the type of the filesystem holding dir, from the mount with the longest matching path.
+//It is empty where that can't be found, eg outside Linux.
+func filesystemType(dir string) (fsType string) {
+
+	if runtime.GOOS != "linux" {
+		return
+	}
+	if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+		dir = resolved
+	}
+
+	mounts, err := os.Open("/proc/mounts")
+	if err != nil {
+		return
+	}
+	defer mounts.Close()
+
+	longest := -1
+	scanner := bufio.NewScanner(mounts)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 {
+			continue
+		}
+		mountPoint := fields[1]
+		if dir == mountPoint || strings.HasPrefix(dir, strings.TrimSuffix(mountPoint, "/")+"/") {
+			if len(mountPoint) > longest {
+				longest, fsType = len(mountPoint), fields[2]
+			}
+		}
+	}
+
+	return
+}
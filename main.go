@@ -1,19 +1,22 @@
 package main
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"errors"
 	"flag"
 	"fmt"
-	"io/ioutil"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"path"
 	"regexp"
+	"runtime/debug"
 	"strings"
+	"syscall"
 	"time"
+
+	"github.com/jonegerton/go-cloudflare-ddns/ddns"
 )
 
 //array flags
@@ -28,71 +31,136 @@ func (i *arrayFlags) Set(value string) error {
 	return nil
 }
 
-//saveDataDocument defines the structure of the save json file
-type saveDataDocument struct {
-	IP     string `json:"ip"`
-	ZoneID string `json:"zoneID"`
-}
-
-//hostData is the excerpt of a larger response to return the ID only.
-//plus a couple of things that have to be echoed back when PUTting updates
-type hostData struct {
-	ID      string `json:"id"`
-	TTL     int    `json:"ttl"`
-	Proxied bool   `json:"proxied"`
-}
-
-//hostResponseMessage is the envelope response that includes the hostData
-type hostInfoResponseMessage struct {
-	Result []hostData `json:"result"`
-}
-
-//zoneInfoResponseMessage is the envelope response that includes the zone id
-type zoneInfoResponseMessage struct {
-	Result []struct {
-		ID string `json:"id"`
-	} `json:"result"`
-}
-
-// updateRequestBody is the submission body to
-// data="{\"type\":\"A\",\"name\":\"$cfhost\",\"content\":\"$WAN_IP\",\"ttl\":$cfttl,\"proxied\":$cfproxied}"
-type updateRequestBody struct {
-	Type    string `json:"type"`
-	Name    string `json:"name"`
-	Content string `json:"content"`
-	TTL     int    `json:"ttl"`
-	Proxied bool   `json:"proxied"`
-}
-
-// updateResponseMessage
-type updateResponseMessage struct {
-	Result struct {
-		Content string `json:"content"`
-	} `json:"result"`
-}
-
 var (
-	cfuser      string
-	cfkey       string
-	cfzone      string
-	cfhosts     arrayFlags
-	wanIPSource string = "http://icanhazip.com"
-	ipRX        *regexp.Regexp
-	savePath    string
-	verbose     bool
+	cfg          ddns.Config
+	cfhosts      arrayFlags
+	hostsFrom    string
+	savePath     string
+	waitNetwork  time.Duration
+	notifyValues arrayFlags
+	windowValues arrayFlags
+	filterValues arrayFlags
+	peerValues   arrayFlags
+	assumeYes    bool
+	iacMarkers   string
+
+	propagationResolvers string
+	fakeListen           string
+	fakeIP               string
+	configPath           string
+	profile              string
+	ttlValue             string
+	showStats            bool
+	metricsAddr          string
+	exporterOnly         bool
 )
 
-func init() {
+//profileRX matches the names allowed for -profile, which become part of the saved data's file name
+var profileRX = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]*$`)
 
-	flag.StringVar(&cfuser, "cfuser", "", "Cloudflare account username (required)")
-	flag.StringVar(&cfkey, "cfkey", "", "Global API Key from My Account > API Keys (required)")
-	flag.StringVar(&cfzone, "cfzone", "", "Name of the zone containing the host to update (required)")
-	flag.Var(&cfhosts, "cfhost", "Names of the host entries (required)")
+//hiddenFlags are left out of the usage, as they are only for testing deployments
+var hiddenFlags = map[string]bool{"fail-at": true, "simulate-ip": true}
 
-	flag.BoolVar(&verbose, "verbose", false, "Enable verbose logging output")
-	flag.StringVar(&wanIPSource, "wan-ip-source", wanIPSource, "URL of WAN IP service")
+func init() {
 
-	ipRX = regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}\b`)
+	defaults := ddns.DefaultConfig()
+
+	flag.StringVar(&cfg.User, "cfuser", "", "Cloudflare account username (required unless -cftoken is set)")
+	flag.StringVar(&cfg.Key, "cfkey", "", "Global API Key from My Account > API Keys (required unless -cftoken is set)")
+	flag.StringVar(&cfg.Token, "cftoken", "", "API token with permission to edit DNS in the zone, used instead of -cfuser and -cfkey")
+	flag.StringVar(&cfg.Zone, "cfzone", "", "Name of the zone containing the host to update (required)")
+	flag.StringVar(&cfg.Account, "cfaccount", "", "Id of the account holding the zone, for members of several accounts with zones of the same name")
+	flag.StringVar(&cfg.ZoneID, "cfzone-id", "", "Id of the zone, skipping the lookup by name. Use when the zone name matches more than one zone")
+	flag.StringVar(&cfg.ZoneMatch, "zone-match", defaults.ZoneMatch, "When the zone name matches more than one zone: active to use the only active one, or strict to always stop with a list of them")
+	flag.Var(&cfhosts, "cfhost", "Names of the host entries, optionally with record type and content: name[,type=TXT][,content=...] (required)")
+	flag.StringVar(&hostsFrom, "hosts-from", "", "Read additional host entries as JSON or CSV from a file, or from stdin if set to -")
+
+	flag.DurationVar(&cfg.Interval, "interval", 0, "Keep running and check the IP at this interval, eg 5m (default is to run once and exit)")
+	flag.BoolVar(&cfg.RunOnStart, "run-on-start", defaults.RunOnStart, "When running at an interval, check the IP immediately on start rather than waiting for the first interval")
+	flag.DurationVar(&cfg.InitialDelay, "initial-delay", 0, "When running at an interval, wait this long before the first check")
+	flag.DurationVar(&cfg.Jitter, "jitter", 0, "When running at an interval, add a random wait of up to this long before each check, eg 30s")
+	flag.DurationVar(&cfg.RetryInterval, "retry-interval", 0, "When running at an interval, check again this long after a failed run, doubling with each failure in a row up to -interval (default is to wait for -interval)")
+	flag.DurationVar(&cfg.IPCache, "ip-cache", 0, "When running at an interval, use the detected IP for this long before asking the IP source again, unless the local network changes, eg 15m (default is to detect it every run)")
+	flag.StringVar(&metricsAddr, "metrics-listen", "", "When running at an interval, serve statistics for Prometheus at /metrics on this address, eg :9153")
+	flag.BoolVar(&exporterOnly, "exporter-only", false, "Run only as a Prometheus exporter on -metrics-listen, reporting the WAN IP, what the records hold and any drift without updating them (implies -verify-only, and an -interval of 5m unless set)")
+	flag.BoolVar(&showStats, "stats", false, "With the status command, also show statistics on IP changes, updates and outages over the last 30 days")
+
+	flag.DurationVar(&waitNetwork, "wait-for-network", 0, "Wait up to this long for a default route and working DNS before the first check, eg 2m")
+
+	flag.DurationVar(&cfg.MaxRuntime, "max-runtime", 0, fmt.Sprintf("Exit with code %d if a run takes longer than this, including retries, eg 2m. When running at an interval, give up the check instead", exitMaxRuntime))
+
+	flag.StringVar(&cfg.LockRecord, "lock-record", "", "Name of a TXT record used as a lock so only one of several instances updates, eg _ddns-lock.example.com")
+	flag.DurationVar(&cfg.LockStale, "lock-stale", defaults.LockStale, "Take over the lock if the holder hasn't refreshed it for this long")
+	flag.StringVar(&cfg.InstanceID, "instance-id", defaults.InstanceID, "Name identifying this instance in the lock record")
+
+	flag.Var(&notifyValues, "notify", "Webhook URL to post update notifications to: url[,mode=digest|immediate]. Digest sends one message per run covering every host (can be repeated)")
+	flag.DurationVar(&cfg.NotifyRemind, "notify-remind", defaults.NotifyRemind, "When a host keeps failing the same way, notify it again after this long rather than every run, doubling each time (0 to notify every failure)")
+	flag.DurationVar(&cfg.NotifyRemindMax, "notify-remind-max", defaults.NotifyRemindMax, "Longest wait between reminders of a repeated failure")
+	flag.StringVar(&cfg.Locale, "locale", defaults.Locale, "Language of notification text: "+strings.Join(ddns.Locales(), ", "))
+	flag.StringVar(&cfg.NotifyTemplates, "notify-templates", "", "JSON file of templates replacing notification texts, by message id")
+	flag.DurationVar(&cfg.StaleAfter, "stale-after", 0, "Send a stale alert to the -notify channels when the records haven't been brought up to date with the IP for this long, for any reason, eg 6h (default is no alert)")
+	flag.Var(&windowValues, "update-window", "Only publish changes between these local times, eg 02:00-05:00, unless the old IP is unreachable (can be repeated)")
+	flag.BoolVar(&cfg.LowMemory, "low-memory", false, "Keep memory use to a minimum, for routers and other devices with little RAM")
+	flag.StringVar(&cfg.PayloadPatch, "payload-patch", "", "JSON merge patch applied to the record sent to Cloudflare when creating or updating a record, eg {\"proxied\":true}, to set fields the utility doesn't")
+	flag.BoolVar(&cfg.TransportDebug, "transport-debug", false, "Log the protocol, connection reuse and compression (gzip, as brotli isn't supported) of each request to Cloudflare, and a summary after each run")
+	flag.StringVar(&cfg.ReportPath, "report", "", "Write a report of each run that updates hosts to this file, as CSV, Markdown if it ends in .md or JSON if it ends in .json. {run} is replaced with the run id")
+
+	flag.StringVar(&cfg.StatusPageDir, "status-page", "", "Write a static status page, index.html and status.json, to this directory after each run")
+
+	flag.StringVar(&cfg.StateKeyFile, "state-key-file", "", "Encrypt the saved data with a key read from this file")
+
+	flag.BoolVar(&cfg.Verbose, "verbose", false, "Enable verbose logging output")
+	flag.StringVar(&cfg.IPSource, "wan-ip-source", defaults.IPSource, "URL of WAN IP service, or another IP source: dns, stun, upnp, interface:<name>, scrape:<url>, mikrotik:<address>, pfsense:<address>, opnsense:<address>, command:<path>")
+	flag.StringVar(&cfg.IPCommand, "wan-ip-command", "", "Run this executable to detect the WAN IP, using the first line it prints, instead of -wan-ip-source")
+	flag.Var(&filterValues, "ip-filter", "Check applied to detected IPs, in the order given: deny-private, allow=<cidr>[,<cidr>...], deny=<cidr>[,<cidr>...] or stable[=<polls>] to wait for a new IP to be seen that many times in a row (can be repeated)")
+	flag.StringVar(&cfg.PreferFamily, "prefer-family", defaults.PreferFamily, "Address family to publish: ipv4, ipv6, or any to use whichever the IP source reports. IPv6 addresses are published as AAAA records")
+	flag.StringVar(&cfg.ScrapePattern, "scrape-pattern", "", "Regular expression extracting the IP from a scrape: source page (default is the first public IPv4 address)")
+	flag.StringVar(&cfg.RouterUser, "router-user", "", "Username for router based IP sources")
+	flag.StringVar(&cfg.RouterPassword, "router-password", "", "Password for router based IP sources")
+	flag.StringVar(&cfg.RouterInterface, "router-interface", "", "WAN interface name for router API IP sources (default is the first public IPv4 address)")
+	flag.BoolVar(&cfg.RouterInsecure, "router-insecure", false, "Don't verify the TLS certificate of router based IP sources")
+	flag.BoolVar(&cfg.InterfaceAllowPrivate, "interface-allow-private", false, "Let interface IP sources publish a private or carrier-grade NAT address when the interface has no public one")
+	flag.StringVar(&cfg.FailoverIP, "failover-ip", "", "Publish this IP instead when IP detection keeps failing for longer than -failover-after")
+	flag.DurationVar(&cfg.FailoverAfter, "failover-after", defaults.FailoverAfter, "How long IP detection must keep failing before publishing -failover-ip")
+
+	flag.DurationVar(&cfg.Cooldown, "cooldown", defaults.Cooldown, "After a run where every Cloudflare update fails, skip runs for this long, doubling with each failed run (0 to disable)")
+	flag.DurationVar(&cfg.CooldownMax, "cooldown-max", defaults.CooldownMax, "Longest cooldown after repeated Cloudflare failures")
+	flag.DurationVar(&cfg.PropagationTimeout, "propagation-timeout", 0, "After updating, wait up to this long for public resolvers to serve the new IP, and report how long it took (default is not to check)")
+	flag.StringVar(&propagationResolvers, "propagation-resolvers", strings.Join(defaults.PropagationResolvers, ","), "Comma separated IP addresses of the resolvers the propagation check asks")
+	flag.IntVar(&cfg.HealthCheckPort, "healthcheck-port", 0, "Before publishing a new IP, check this port on it accepts connections, and skip the update if not")
+	flag.StringVar(&cfg.HealthCheckURL, "healthcheck-url", "", "External checker URL used for the health check instead of connecting directly. {ip} and {port} are replaced, and a 2xx status is a pass")
+	flag.DurationVar(&cfg.HealthCheckTimeout, "healthcheck-timeout", defaults.HealthCheckTimeout, "Timeout for the health check")
+	flag.StringVar(&ttlValue, "ttl", "", "TTL to set on records when they are updated: auto, seconds or a duration such as 5m (default is to keep each record's TTL)")
+	flag.DurationVar(&cfg.ZoneCacheTTL, "zone-cache-ttl", defaults.ZoneCacheTTL, "How long to use the zone id before looking it up again")
+	flag.DurationVar(&cfg.RecordCacheTTL, "record-cache-ttl", defaults.RecordCacheTTL, "How long to use a record's details, such as its TTL and proxied flag, before fetching them again (0 to always fetch them)")
+	flag.IntVar(&cfg.Retries, "retries", defaults.Retries, "Number of times to retry a failed update")
+	flag.BoolVar(&cfg.UpdateAllMatching, "update-all-matching", false, "When the IP changes, also update every A record in the zone holding the previous IP, or AAAA record for an IPv6 address")
+	flag.IntVar(&cfg.MaxChanges, "max-changes", defaults.MaxChanges, "Stop a run that would change more than this many records before changing any, unless -override-max-changes is given (0 for no limit)")
+	flag.BoolVar(&cfg.OverrideMaxChanges, "override-max-changes", false, "Let this run change more records than -max-changes, once they have been checked")
+	flag.BoolVar(&cfg.Staged, "staged", false, "Write the new content of each record that would change to its comment, as ddns-staged: <content>, instead of changing it, to review pending changes in the dashboard")
+	flag.BoolVar(&cfg.VerifyOnly, "verify-only", false, "Only check the records hold the detected IP and notify any drift, never changing them. Works with a read-only token, as a watchdog next to another updater")
+	flag.IntVar(&cfg.VerifyEvery, "verify-every", 0, "When the IP is unchanged, check every this many runs that the records still hold the right value, recreating them if deleted")
+	flag.BoolVar(&cfg.TakeOwnership, "take-ownership", false, "Update records that aren't yet marked as managed by this utility, and mark them")
+	flag.StringVar(&iacMarkers, "iac-markers", strings.Join(defaults.IaCMarkers, ","), "Comma separated words in a record's comment or tags showing it is managed by infrastructure as code. Such records are not updated (empty to disable)")
+	flag.BoolVar(&cfg.OverrideIaC, "override-iac", false, "Update records even if their comment or tags show they are managed by infrastructure as code")
+	flag.StringVar(&cfg.TunnelMode, "tunnel-mode", defaults.TunnelMode, "For hosts served through a Cloudflare Tunnel: skip them, or origin to update the tunnel's origin for them if it is a public IP")
+	flag.StringVar(&cfg.ConfirmWith, "confirm-with", "", "Secondary method that must agree with the WAN IP before updating: dns, stun or a URL")
+	flag.Var(&peerValues, "wan-ip-peer", "Another IP source to ask alongside -wan-ip-source, using the IP most of them agree on and quarantining sources that keep disagreeing. Give at least 2 (can be repeated)")
+	flag.DurationVar(&cfg.PeerQuarantine, "peer-quarantine", defaults.PeerQuarantine, "How long an IP source that keeps disagreeing with the -wan-ip-peer sources goes unasked before it is tried again")
+	flag.BoolVar(&cfg.CGNATCheck, "cgnat-check", false, "Compare the WAN IP with the router's WAN address via UPnP and skip the update if behind CGNAT")
+
+	flag.StringVar(&cfg.FailAt, "fail-at", "", "Fail the run at a step, detection, zone or update, to rehearse alerts")
+	flag.StringVar(&cfg.SimulateIP, "simulate-ip", "", "Publish this IP instead of the detected one, to rehearse alerts")
+	flag.Usage = usage
+
+	flag.StringVar(&cfg.APIBase, "api-base", defaults.APIBase, "Cloudflare API URL, eg to test against the fake-server command")
+	flag.StringVar(&fakeListen, "listen", "127.0.0.1:8053", "Address the fake-server command listens on")
+	flag.StringVar(&fakeIP, "fake-ip", "203.0.113.10", "WAN IP returned by the fake-server command's echo service")
+
+	flag.StringVar(&configPath, "config", "", "Read settings from this JSON file of flag names and values. Flags and environment variables override it")
+	flag.StringVar(&profile, "profile", "", "Name to keep this setup's saved data apart under, eg the zone, when more than one setup runs from the same directory. The data is saved to go-cloudflare-ddns-saved.<profile>.json")
+
+	flag.BoolVar(&assumeYes, "yes", false, "Don't ask for confirmation before deleting records with the prune command, taking ownership of records with -take-ownership, deleting archived state with state gc, or replacing the config file with the install command")
 
 	pwd, err := os.Getwd()
 	if err != nil {
@@ -104,357 +172,289 @@ func init() {
 
 func main() {
 
-	flag.Parse()
+	//Commands are given before any flags
+	command := ""
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		command = os.Args[1]
+		os.Args = append(os.Args[:1], os.Args[2:]...)
+	}
 
-	//Check mandatory flags
-	if cfuser == "" || cfkey == "" || cfzone == "" || len(cfhosts) == 0 {
-		flag.Usage()
-		os.Exit(1)
-		return
+	//config and state take a further command, eg config show
+	subcommand := ""
+	if (command == "config" || command == "state") && len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		subcommand = os.Args[1]
+		os.Args = append(os.Args[:1], os.Args[2:]...)
 	}
 
-	//Get the WAN IP
-	ip, err := getWANIP()
-	if err != nil {
+	flag.Parse()
+
+	//Settings not given as flags come from the environment or the config file
+	if err := applyConfigSources(); err != nil {
 		log.Fatal(err)
 	}
-	logVerbose("WAN IP is: %s", ip)
 
-	//Get saved data
-	saveData, err := getSaveData()
-	if err != nil {
-		log.Fatal(err)
+	//Each profile has saved data of its own
+	if profile != "" {
+		if !profileRX.MatchString(profile) {
+			log.Fatalf("Profile '%v' must be letters, digits, dots, dashes and underscores", profile)
+		}
+		savePath = path.Join(path.Dir(savePath), "go-cloudflare-ddns-saved."+profile+".json")
 	}
 
-	//Verify work is needed
-	if strings.Compare(ip, saveData.IP) == 0 {
-		log.Print("IP address unchanged - nothing to do.")
-		return
+	var err error
+	if cfg.TTL, err = ddns.ParseTTL(ttlValue); err != nil {
+		log.Fatal(err)
 	}
 
-	log.Print("New IP address or IP address changed.")
-	saveData.IP = ip
+	cfg.IaCMarkers = splitList(iacMarkers)
+	cfg.PropagationResolvers = splitList(propagationResolvers)
+	cfg.PeerSources = peerValues
+	applyLowMemoryGC()
 
-	//Get zoneid if not already resolved
-	if saveData.ZoneID == "" {
-		logVerbose("Getting zoneid for zone: %s", cfzone)
-		saveData.ZoneID, err = getZoneID()
+	switch command {
+	case "":
+	case "status":
+		updater, err := newUpdater(nil)
 		if err != nil {
 			log.Fatal(err)
 		}
-		logVerbose("ZoneID is: %s", saveData.ZoneID)
-	}
-
-	for _, cfhost := range cfhosts {
-
-		logVerbose("Updating IP for host: %s", cfhost)
-
-		//Always the hostData for the host record to update, as this also gets the ttl/proxied flag, which are required on the api
-		//If we cache this there's a risk of setting it to an old value
-		hostData, err := getHostData(saveData.ZoneID, cfhost)
-		if err != nil {
+		if err = updater.Status(os.Stdout); err != nil {
 			log.Fatal(err)
 		}
-		logVerbose("HostID is: %s", hostData.ID)
-
-		//Submit to cloudflare
-		err = sendIPUpdate(hostData, saveData.ZoneID, cfhost, string(ip))
+		if showStats {
+			fmt.Println()
+			if err = updater.WriteStats(os.Stdout); err != nil {
+				log.Fatal(err)
+			}
+		}
+		return
+	case "history":
+		updater, err := newUpdater(nil)
 		if err != nil {
 			log.Fatal(err)
 		}
-	}
-
-	//Persist
-	err = setSaveData(saveData)
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	log.Print("IP address update complete.")
-
-}
-
-func logVerbose(format string, a ...interface{}) {
-	if !verbose {
-		return
-	}
-
-	log.Printf(format, a...)
-}
-
-func getWANIP() (ip string, err error) {
-
-	ip = ""
-	err = nil
-
-	defer func() {
+		changes, err := updater.Changes(flag.Arg(0))
 		if err != nil {
-			err = fmt.Errorf("Error in getWANIP(): %v", err)
+			log.Fatal(err)
+		}
+		if len(changes) == 0 {
+			fmt.Println("No changes recorded.")
+		}
+		for _, change := range changes {
+			fmt.Println(change)
 		}
-	}()
-
-	//Requires service that returns the IP as the entire response body, eg:
-	//http://ipinfo.io/ip
-	//http://icanhazip.com
-	//http://checkip.amazonaws.com/
-
-	req, _ := http.NewRequest("GET", wanIPSource, nil)
-
-	client := &http.Client{
-		Timeout: time.Second * 10,
-	}
-
-	resp, err := client.Do(req)
-	if err != nil {
 		return
-	}
-	if resp == nil {
-		err = fmt.Errorf("Error requesting WAN IP from %v", wanIPSource)
+	case "prune":
+		if err := runPrune(); err != nil {
+			log.Fatal(err)
+		}
 		return
-	}
-	defer resp.Body.Close()
-
-	data, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
+	case "support-bundle":
+		if err := runSupportBundle(); err != nil {
+			log.Fatal(err)
+		}
 		return
-	}
-
-	ip = strings.TrimSpace(string(data))
-
-	if !ipRX.MatchString(ip) {
-		err = fmt.Errorf("Response from %v does not look like an IP address: %.25s", wanIPSource, ip)
-	}
-
-	return
-}
-
-func getSaveData() (saveData saveDataDocument, err error) {
-
-	defer func() {
-		if err != nil {
-			err = fmt.Errorf("Error in getSavedData(): %v", err)
+	case "fake-server":
+		log.Fatal(runFakeServer())
+	case "install":
+		if err := runInstall(); err != nil {
+			log.Fatal(err)
 		}
-	}()
-
-	//check for saved data
-	data, readErr := ioutil.ReadFile(savePath)
-	if readErr != nil {
-		log.Printf("Could not read saved data from file '%v' (this is ok on first run. at other times check file permissions etc)", savePath)
 		return
-	}
-
-	if err = json.Unmarshal(data, &saveData); err != nil {
-		err = fmt.Errorf("Error parsing host details response: %v", err)
+	case "state":
+		if err := runState(subcommand, flag.Args()); err != nil {
+			log.Fatal(err)
+		}
 		return
-	}
-	return
-
-}
-
-func setSaveData(saveData saveDataDocument) (err error) {
-
-	defer func() {
+	case "config":
+		switch subcommand {
+		case "show":
+			err = showConfig()
+		case "lint":
+			err = runLint()
+		case "migrate":
+			err = runMigrate(flag.Args())
+		default:
+			log.Fatalf("Unknown config command '%v' (expected config show, config lint or config migrate)", subcommand)
+		}
 		if err != nil {
-			err = fmt.Errorf("Error in setSaveData(): %v", err)
-
+			log.Fatal(err)
 		}
-	}()
-
-	data, err := json.Marshal(saveData)
-	if err != nil {
-		err = fmt.Errorf("Error preparsing saveData: %v", err)
 		return
+	default:
+		log.Fatalf("Unknown command '%v' (expected status, history, prune, support-bundle, fake-server, install, state list, state restore, state gc, config show, config lint or config migrate)", command)
 	}
 
-	//Persist the IP only once upload has succeeded (incase retry is required)
-	if err = ioutil.WriteFile(savePath, data, 0644); err != nil {
-		log.Fatalf("Failed to save data to file at '%v'", savePath)
+	//An exporter is a watchdog that keeps running and serves what it finds
+	if exporterOnly {
+		if metricsAddr == "" {
+			log.Fatal("-exporter-only needs -metrics-listen, eg -metrics-listen=:9153")
+		}
+		cfg.VerifyOnly = true
+		if cfg.Interval == 0 {
+			cfg.Interval = time.Minute * 5
+		}
 	}
 
-	return
-}
-
-func getHostData(zoneID string, cfhost string) (hostData hostData, err error) {
-
-	//Example curl request
-	// curl -X GET "https://api.cloudflare.com/client/v4/zones/$cfzonekey/dns_records?type=A&name=$cfhost" \
-	// 	-H "X-Auth-Key: $cfkey " \
-	// 	-H "X-Auth-Email: $cfuser" \
-	// 	-H "Content-Type: application/json" > ./cf-ddns.json
+	//Check mandatory flags
+	if (cfg.Token == "" && (cfg.User == "" || cfg.Key == "")) || cfg.Zone == "" || (len(cfhosts) == 0 && hostsFrom == "" && !cfg.UpdateAllMatching) {
+		flag.Usage()
+		os.Exit(1)
+		return
+	}
 
-	defer func() {
+	//Host entries can come from flags and from a list piped in or in a file
+	var extraHosts []ddns.Host
+	if hostsFrom != "" {
+		extraHosts, err = readHostsFrom(hostsFrom)
 		if err != nil {
-			err = fmt.Errorf("Error in getHostData(): %v", err)
+			log.Fatal(err)
 		}
-	}()
-
-	url := fmt.Sprintf("https://api.cloudflare.com/client/v4/zones/%s/dns_records?type=A&name=%s", zoneID, cfhost)
-
-	req, _ := http.NewRequest("GET", url, nil)
-	req.Header.Set("X-Auth-Key", cfkey)
-	req.Header.Set("X-Auth-Email", cfuser)
-	req.Header.Set("Content-Type", "application/json")
+	}
 
-	client := &http.Client{
-		Timeout: time.Second * 10,
+	if cfg.Notify, err = ddns.ParseNotifyChannels(notifyValues); err != nil {
+		log.Fatal(err)
 	}
 
-	resp, err := client.Do(req)
-	if err != nil {
-		return
+	if cfg.UpdateWindows, err = ddns.ParseUpdateWindows(windowValues); err != nil {
+		log.Fatal(err)
 	}
-	if resp == nil {
-		err = fmt.Errorf("Error requesting host details %v", url)
-		return
+
+	if cfg.IPFilters, err = ddns.ParseIPFilters(filterValues); err != nil {
+		log.Fatal(err)
 	}
-	defer resp.Body.Close()
 
-	body, err := ioutil.ReadAll(resp.Body)
+	updater, err := newUpdater(extraHosts)
 	if err != nil {
-		return
+		log.Fatal(err)
 	}
 
-	var msg hostInfoResponseMessage
-	if err = json.Unmarshal(body, &msg); err != nil {
-		err = fmt.Errorf("Error parsing host details response: %v", err)
-		return
+	//When running once the deadline covers everything, including waiting for the network
+	ctx := context.Background()
+	if cfg.Interval == 0 && cfg.MaxRuntime > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.MaxRuntime)
+		defer cancel()
+		armMaxRuntime()
 	}
-	if len(msg.Result) == 0 || msg.Result[0].ID == "" {
-		err = fmt.Errorf("Error reading host id")
-		return
-	}
-	hostData = msg.Result[0]
 
-	return
-
-}
-
-func getZoneID() (zoneID string, err error) {
-
-	//Example curl request
-	// curl -X GET "https://api.cloudflare.com/client/v4/zones/?name=$cfhost" \
-	// 	-H "X-Auth-Key: $cfkey " \
-	// 	-H "X-Auth-Email: $cfuser" \
-	// 	-H "Content-Type: application/json" > ./cf-ddns.json
+	if waitNetwork > 0 {
+		waitForNetwork(ctx, waitNetwork)
+	}
 
-	defer func() {
-		if err != nil {
-			err = fmt.Errorf("Error in getZoneID(): %v", err)
+	//Records are only adopted once they have been listed and confirmed
+	if cfg.TakeOwnership && !cfg.VerifyOnly {
+		if err = confirmOwnership(updater); err != nil {
+			log.Fatal(err)
 		}
-	}()
-
-	url := fmt.Sprintf("https://api.cloudflare.com/client/v4/zones/?name=%s", cfzone)
-
-	req, _ := http.NewRequest("GET", url, nil)
-	req.Header.Set("X-Auth-Key", cfkey)
-	req.Header.Set("X-Auth-Email", cfuser)
-	req.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{
-		Timeout: time.Second * 10,
 	}
 
-	resp, err := client.Do(req)
-	if err != nil {
-		return
-	}
-	if resp == nil {
-		err = fmt.Errorf("Error requesting zone details %v", url)
-		return
+	//Keep running on a schedule if an interval is set
+	if cfg.Interval > 0 {
+		if metricsAddr != "" {
+			go serveMetrics(updater)
+		}
+		go triggerOnHangup(updater)
+		log.Fatal(updater.Run(context.Background()))
 	}
-	defer resp.Body.Close()
 
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return
+	if err = updater.RunOnce(ctx); err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			log.Print(err)
+			log.Printf("Run did not complete within -max-runtime of %v - exiting.", cfg.MaxRuntime)
+			os.Exit(exitMaxRuntime)
+		}
+		log.Fatal(err)
 	}
 
-	var msg zoneInfoResponseMessage
-	if err = json.Unmarshal(body, &msg); err != nil {
-		err = fmt.Errorf("Error parsing zone details response: %v", err)
-		return
-	}
-	if len(msg.Result) == 0 || msg.Result[0].ID == "" {
-		err = fmt.Errorf("Error reading zone id")
-		return
-	}
-	zoneID = msg.Result[0].ID
+}
 
-	return
+//lowMemoryLimit is the soft heap limit in -low-memory mode
+const lowMemoryLimit = 16 << 20
 
+//applyLowMemoryGC makes the garbage collector run sooner for -low-memory, and harder as the heap nears the limit
+func applyLowMemoryGC() {
+	if !cfg.LowMemory {
+		return
+	}
+	debug.SetGCPercent(20)
+	debug.SetMemoryLimit(lowMemoryLimit)
 }
 
-func sendIPUpdate(hostData hostData, zoneID string, cfhost string, ip string) (err error) {
+//exitMaxRuntime is the exit code used when a run takes longer than -max-runtime
+const exitMaxRuntime = 3
 
-	//Curl example
-	// data="{\"type\":\"A\",\"name\":\"$cfhost\",\"content\":\"$WAN_IP\",\"ttl\":$cfttl,\"proxied\":$cfproxied}"
-	// echo "data: $data" >> $log
+//maxRuntimeGrace is how long a run past -max-runtime has to stop on its own, unlocking and finishing any save,
+//before the process exits anyway
+const maxRuntimeGrace = time.Second * 30
 
-	// curl -X PUT "https://api.cloudflare.com/client/v4/zones/$cfzonekey/dns_records/$cfhostkey" \
-	// 	-H "X-Auth-Key: $cfkey" \
-	// 	-H "X-Auth-Email: $cfuser" \
-	// 	-H "Content-Type: application/json" \
-	// 	--data $data >> $log
+//armMaxRuntime is a backstop for a run that doesn't stop when its -max-runtime context ends, eg stuck in a system
+//call, exiting once the grace period has passed too so scheduled runs can't pile up
+func armMaxRuntime() {
+	time.AfterFunc(cfg.MaxRuntime+maxRuntimeGrace, func() {
+		log.Printf("Run did not stop within %v of -max-runtime of %v running out - exiting.", maxRuntimeGrace, cfg.MaxRuntime)
+		os.Exit(exitMaxRuntime)
+	})
+}
 
-	defer func() {
-		if err != nil {
-			err = fmt.Errorf("Error in sendIPUpdate(): %v", err)
-		}
-	}()
-
-	data := updateRequestBody{
-		Type:    "A",
-		Name:    cfhost,
-		Content: ip,
-		TTL:     hostData.TTL,
-		Proxied: hostData.Proxied,
-	}
-	putBody, err := json.Marshal(data)
-	if err != nil {
-		err = fmt.Errorf("Error in sendIPUpdate(): %v", err)
+//triggerOnHangup checks straight away when the process gets a SIGHUP, eg from a script run when the connection comes up
+func triggerOnHangup(updater *ddns.Updater) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	for range hangup {
+		log.Print("Got SIGHUP - checking now.")
+		updater.Trigger()
 	}
+}
 
-	url := fmt.Sprintf("https://api.cloudflare.com/client/v4/zones/%s/dns_records/%s", zoneID, hostData.ID)
-
-	req, _ := http.NewRequest("PUT", url, bytes.NewBuffer(putBody))
-	req.Header.Set("X-Auth-Key", cfkey)
-	req.Header.Set("X-Auth-Email", cfuser)
-	req.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{
-		Timeout: time.Second * 10,
-	}
+//serveMetrics serves the updater's statistics at /metrics on -metrics-listen
+func serveMetrics(updater *ddns.Updater) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", updater.MetricsHandler())
+	log.Printf("Serving metrics on %v/metrics", metricsAddr)
+	log.Fatal(http.ListenAndServe(metricsAddr, mux))
+}
 
-	resp, err := client.Do(req)
-	if err != nil {
-		return
-	}
-	if resp == nil {
-		err = fmt.Errorf("Error sending host update details %v", url)
-		return
+//splitList splits a comma separated flag value, dropping empty items
+func splitList(value string) (items []string) {
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
 	}
-	defer resp.Body.Close()
+	return
+}
 
-	resBody, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return
-	}
+//usage prints the flags, leaving out the hidden ones
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), "Usage of %s:\n", os.Args[0])
+	flag.VisitAll(func(f *flag.Flag) {
+		if hiddenFlags[f.Name] {
+			return
+		}
+		fs := flag.NewFlagSet("", flag.ContinueOnError)
+		fs.SetOutput(flag.CommandLine.Output())
+		fs.Var(f.Value, f.Name, f.Usage)
+		fs.Lookup(f.Name).DefValue = f.DefValue
+		fs.PrintDefaults()
+	})
+}
 
-	var msg updateResponseMessage
-	if err = json.Unmarshal(resBody, &msg); err != nil {
-		err = fmt.Errorf("Error parsing host details response: %v", err)
-		return
-	}
-	if msg.Result.Content == "" {
-		err = fmt.Errorf("Error reading updated IP")
-		return
-	}
+//newUpdater returns an updater for the flags, with extra hosts from -hosts-from
+func newUpdater(extraHosts []ddns.Host) (*ddns.Updater, error) {
+	return ddns.New(
+		ddns.WithConfig(cfg),
+		ddns.WithHosts(cfhosts...),
+		ddns.WithHostEntries(extraHosts...),
+		ddns.WithStateStore(ddns.NewFileStore(savePath)),
+		ddns.WithLogger(log.Default()),
+	)
+}
 
-	//Check IP on response matches submit
-	if strings.Compare(ip, msg.Result.Content) != 0 {
-		err = errors.New("Error checking that IP was correctly updated")
+func logVerbose(format string, a ...interface{}) {
+	if !cfg.Verbose {
 		return
 	}
 
-	return
+	log.Printf(format, a...)
 }
@@ -0,0 +1,354 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//migrateFlags are about running the migrate command, or only meant for one run, so aren't written to the config file
+var migrateFlags = map[string]bool{"config": true, "yes": true, "override-max-changes": true}
+
+//executableName is how an invocation of the utility is found in a script or crontab line
+const executableName = "go-cloudflare-ddns"
+
+//runMigrate prints a config file, in the format read by -config, for an older way of setting the utility up:
+//   - an invocation pasted as arguments, eg config migrate ./go-cloudflare-ddns -cfuser=... -cfhost=home
+//   - a script or crontab running the utility, including wrapper scripts setting variables first as the README used to suggest
+//   - a script holding only the settings of the shell script version, cfuser=..., cfkey=... and so on
+//   - a JSON config file, which is checked and written out again in the current form
+//
+//With no arguments the settings given to the command itself, as flags, environment variables or -config, are converted.
+//The config file is written to stdout, and notes about the conversion to stderr.
+func runMigrate(args []string) (err error) {
+
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("Error in runMigrate(): %v", err)
+		}
+	}()
+
+	var settings map[string]interface{}
+	switch {
+	case len(args) == 0:
+		settings = givenSettings(migrateFlags)
+	case len(args) == 1 && isFile(args[0]):
+		settings, err = migrateFile(args[0])
+	case len(args) == 1:
+		//The whole command line pasted in quotes as one argument
+		settings, err = migrateInvocation(splitWords(args[0]), nil)
+	default:
+		settings, err = migrateInvocation(args, nil)
+	}
+	if err != nil {
+		return
+	}
+	if len(settings) == 0 {
+		return fmt.Errorf("No settings found to migrate")
+	}
+
+	data, err := json.MarshalIndent(settings, "", "    ")
+	if err != nil {
+		return
+	}
+	fmt.Println(string(data))
+
+	var names []string
+	for name := range settings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintf(os.Stderr, "Converted %v.\n", strings.Join(names, ", "))
+	for name := range secretFlags {
+		if _, ok := settings[name]; ok {
+			fmt.Fprintln(os.Stderr, "The config holds secrets, so save it where only you can read it, eg with chmod 600.")
+			break
+		}
+	}
+	fmt.Fprintln(os.Stderr, "Run with -config=<file>, and check it with config lint -config=<file>.")
+
+	return
+}
+
+//isFile reports whether path names an existing file
+func isFile(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular()
+}
+
+//migrateFile converts a JSON config file, or a script running the utility or setting its variables
+func migrateFile(path string) (settings map[string]interface{}, err error) {
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return
+	}
+
+	if strings.HasPrefix(strings.TrimSpace(string(data)), "{") {
+		var file map[string]interface{}
+		if err = json.Unmarshal(data, &file); err != nil {
+			err = fmt.Errorf("Error parsing config file %v: %v", path, err)
+			return
+		}
+		settings = map[string]interface{}{}
+		for name, value := range file {
+			list, ok := value.([]interface{})
+			if !ok {
+				list = []interface{}{value}
+			}
+			for _, item := range list {
+				if err = addSetting(settings, name, settingText(item)); err != nil {
+					return
+				}
+			}
+		}
+		return
+	}
+
+	vars := map[string]string{}
+	for _, line := range scriptLines(string(data)) {
+		if name, value, ok := scriptAssignment(line); ok {
+			vars[name] = expandVars(value, vars)
+			continue
+		}
+		if settings != nil || !strings.Contains(line, executableName) {
+			continue
+		}
+		//The first line running the utility with settings, eg not a cd to its directory
+		words := splitWords(expandVars(line, vars))
+		for i, word := range words {
+			if !strings.Contains(word, executableName) {
+				continue
+			}
+			var invocation map[string]interface{}
+			if invocation, err = migrateInvocation(words[i+1:], nil); err != nil {
+				return
+			}
+			if len(invocation) > 0 {
+				settings = invocation
+				break
+			}
+		}
+	}
+	if settings != nil {
+		return
+	}
+
+	//Without an invocation, the variables are the settings, as in the shell script version
+	return migrateInvocation(nil, vars)
+}
+
+//migrateInvocation converts the arguments of an invocation, skipping any leading command words such as the executable
+//or sudo, and stopping at shell redirects and separators. vars are variables named after settings, eg cfzone or
+//DDNS_CFZONE, added to the settings.
+func migrateInvocation(args []string, vars map[string]string) (settings map[string]interface{}, err error) {
+
+	settings = map[string]interface{}{}
+
+	var names []string
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		setting := strings.ToLower(strings.Replace(strings.TrimPrefix(name, envPrefix), "_", "-", -1))
+		if flag.Lookup(setting) == nil || migrateFlags[setting] {
+			continue
+		}
+		//Hosts were often set space separated in the shell script version
+		for _, value := range strings.Fields(vars[name]) {
+			if err = addSetting(settings, setting, value); err != nil {
+				return
+			}
+			if _, repeatable := flag.Lookup(setting).Value.(*arrayFlags); !repeatable {
+				break
+			}
+		}
+	}
+
+	started := false
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--":
+			continue
+		case !strings.HasPrefix(arg, "-") && !started:
+			continue
+		case arg == "|" || arg == "||" || arg == "&&" || arg == ";" || arg == "&" || strings.HasPrefix(arg, ">") || strings.HasPrefix(arg, "<") || strings.HasPrefix(arg, "2>"):
+			return
+		case !strings.HasPrefix(arg, "-"):
+			return nil, fmt.Errorf("Unexpected argument '%v'", arg)
+		}
+		started = true
+
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		f := flag.Lookup(name)
+		if f == nil {
+			return nil, fmt.Errorf("Unknown setting -%v", name)
+		}
+		if name == "config" {
+			return nil, fmt.Errorf("The invocation reads -config=%v, migrate that file instead", value)
+		}
+		if migrateFlags[name] {
+			continue
+		}
+		if boolFlag, ok := f.Value.(interface{ IsBoolFlag() bool }); !hasValue && ok && boolFlag.IsBoolFlag() {
+			value, hasValue = "true", true
+		}
+		if !hasValue {
+			if i+1 == len(args) {
+				return nil, fmt.Errorf("No value given for -%v", name)
+			}
+			i++
+			value = args[i]
+		}
+		if err = addSetting(settings, name, value); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+//addSetting adds a setting's value to settings, checking the value suits the setting. Repeatable settings are lists.
+func addSetting(settings map[string]interface{}, name string, value string) (err error) {
+
+	f := flag.Lookup(name)
+	if f == nil || migrateFlags[name] {
+		return fmt.Errorf("Unknown setting '%v'", name)
+	}
+
+	if _, repeatable := f.Value.(*arrayFlags); repeatable {
+		list, _ := settings[name].([]string)
+		settings[name] = append(list, value)
+		return
+	}
+
+	if getter, ok := f.Value.(flag.Getter); ok {
+		switch getter.Get().(type) {
+		case bool:
+			var b bool
+			if b, err = strconv.ParseBool(value); err != nil {
+				return fmt.Errorf("Invalid value '%v' for -%v, expected true or false", value, name)
+			}
+			settings[name] = b
+			return
+		case time.Duration:
+			if _, err = time.ParseDuration(value); err != nil {
+				return fmt.Errorf("Invalid value '%v' for -%v, expected a duration such as 5m", value, name)
+			}
+		case int:
+			if _, err = strconv.Atoi(value); err != nil {
+				return fmt.Errorf("Invalid value '%v' for -%v, expected a number", value, name)
+			}
+		}
+	}
+	settings[name] = value
+
+	return
+}
+
+//scriptLines returns the lines of a shell script or batch file, joining continued lines and dropping comments
+func scriptLines(script string) (lines []string) {
+
+	script = strings.Replace(script, "\r\n", "\n", -1)
+	script = strings.Replace(strings.Replace(script, "\\\n", " ", -1), "^\n", " ", -1)
+
+	for _, line := range strings.Split(script, "\n") {
+		line = strings.TrimSpace(line)
+		lower := strings.ToLower(line)
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "::") || lower == "rem" || strings.HasPrefix(lower, "rem ") || strings.HasPrefix(lower, "@echo") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+
+	return
+}
+
+//Variables being set in a shell script, name=value or export name=value, and in a batch file, SET name=value or SET "name=value"
+var (
+	shellAssignmentRX = regexp.MustCompile(`^(?:export\s+)?([A-Za-z_][A-Za-z0-9_]*)=(.*)$`)
+	batchAssignmentRX = regexp.MustCompile(`(?i)^set\s+"?([A-Za-z_][A-Za-z0-9_]*)=(.*?)"?$`)
+)
+
+//scriptAssignment returns the variable set by a script line, if it sets one
+func scriptAssignment(line string) (name string, value string, ok bool) {
+
+	if match := batchAssignmentRX.FindStringSubmatch(line); match != nil {
+		return match[1], match[2], true
+	}
+
+	match := shellAssignmentRX.FindStringSubmatch(line)
+	if match == nil {
+		return
+	}
+	value = match[2]
+	if words := splitWords(value); len(words) == 1 {
+		value = words[0]
+	}
+
+	return match[1], value, true
+}
+
+//varRX matches a variable used in a shell script, $name or ${name}, or a batch file, %name%
+var varRX = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}|\$([A-Za-z_][A-Za-z0-9_]*)|%([A-Za-z_][A-Za-z0-9_]*)%`)
+
+//expandVars replaces the variables set earlier in the script, leaving any others as they are
+func expandVars(line string, vars map[string]string) string {
+	return varRX.ReplaceAllStringFunc(line, func(used string) string {
+		match := varRX.FindStringSubmatch(used)
+		if value, ok := vars[match[1]+match[2]+match[3]]; ok {
+			return value
+		}
+		return used
+	})
+}
+
+//splitWords splits a command line into words as a shell would, honouring quotes. A backslash only escapes a quote,
+//space, dollar or backslash, so Windows paths are kept.
+func splitWords(line string) (words []string) {
+
+	var word strings.Builder
+	inWord := false
+	var quote rune
+	escaped := false
+
+	chars := []rune(line)
+	for i, c := range chars {
+		switch {
+		case escaped:
+			word.WriteRune(c)
+			escaped = false
+		case c == '\\' && quote != '\'' && i+1 < len(chars) && strings.ContainsRune("\"' $\\", chars[i+1]):
+			escaped, inWord = true, true
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote != 0:
+			word.WriteRune(c)
+		case c == '"' || c == '\'':
+			quote, inWord = c, true
+		case c == ' ' || c == '\t' || c == '\n':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(c)
+			inWord = true
+		}
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+
+	return
+}
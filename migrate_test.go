@@ -0,0 +1,74 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitWords(t *testing.T) {
+
+	tests := []struct {
+		line string
+		want []string
+	}{
+		{"", nil},
+		{"  go-cloudflare-ddns   -cfzone=example.com\t-cfhost=home ", []string{"go-cloudflare-ddns", "-cfzone=example.com", "-cfhost=home"}},
+		{`-cfhost="home, www" -cfkey='a b'`, []string{"-cfhost=home, www", "-cfkey=a b"}},
+		{`-cfhost=""`, []string{"-cfhost="}},
+		{`''`, []string{""}},
+		{`say\ hello \"quoted\"`, []string{"say hello", `"quoted"`}},
+		{`'it\'s'`, []string{`it\s`}},
+		{`"a 'b' c"`, []string{"a 'b' c"}},
+		{`C:\ddns\go-cloudflare-ddns.exe -cfzone=example.com`, []string{`C:\ddns\go-cloudflare-ddns.exe`, "-cfzone=example.com"}},
+		{`cost=\$5 back\\slash`, []string{"cost=$5", `back\slash`}},
+	}
+
+	for _, test := range tests {
+		if got := splitWords(test.line); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("splitWords(%q) = %q, want %q", test.line, got, test.want)
+		}
+	}
+}
+
+func TestScriptAssignment(t *testing.T) {
+
+	tests := []struct {
+		line      string
+		wantName  string
+		wantValue string
+		wantOK    bool
+	}{
+		{"cfzone=example.com", "cfzone", "example.com", true},
+		{`export cfhost="home www"`, "cfhost", "home www", true},
+		{`SET "DDNS_CFZONE=example.com"`, "DDNS_CFZONE", "example.com", true},
+		{"set cfkey=abc", "cfkey", "abc", true},
+		{"go-cloudflare-ddns -cfzone=example.com", "", "", false},
+	}
+
+	for _, test := range tests {
+		name, value, ok := scriptAssignment(test.line)
+		if name != test.wantName || value != test.wantValue || ok != test.wantOK {
+			t.Errorf("scriptAssignment(%q) = %q, %q, %v, want %q, %q, %v", test.line, name, value, ok, test.wantName, test.wantValue, test.wantOK)
+		}
+	}
+}
+
+func TestExpandVars(t *testing.T) {
+
+	vars := map[string]string{"zone": "example.com", "key": "abc"}
+
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"-cfzone=$zone", "-cfzone=example.com"},
+		{"-cfzone=${zone} -cfkey=%key%", "-cfzone=example.com -cfkey=abc"},
+		{"-cfhost=$HOSTNAME", "-cfhost=$HOSTNAME"},
+	}
+
+	for _, test := range tests {
+		if got := expandVars(test.line, vars); got != test.want {
+			t.Errorf("expandVars(%q) = %q, want %q", test.line, got, test.want)
+		}
+	}
+}
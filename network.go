@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"time"
+)
+
+//networkCheckHost is resolved to check DNS is working
+var networkCheckHost = "api.cloudflare.com"
+
+//waitForNetwork polls until there is a default route and DNS resolves, or the timeout passes or ctx ends.
+//If the timeout passes the run goes ahead anyway, and will report whatever fails.
+func waitForNetwork(ctx context.Context, timeout time.Duration) {
+
+	deadline := time.Now().Add(timeout)
+
+	for {
+		err := checkNetwork()
+		if err == nil {
+			logVerbose("Network is up")
+			return
+		}
+
+		if time.Now().After(deadline) {
+			log.Printf("Network still not ready after %v, continuing anyway: %v", timeout, err)
+			return
+		}
+
+		logVerbose("Waiting for network: %v", err)
+		select {
+		case <-time.After(time.Second * 5):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+//checkNetwork returns an error describing why the network isn't usable yet
+func checkNetwork() error {
+
+	//Connecting a UDP socket sends nothing, but fails if there is no route to the address
+	conn, err := net.Dial("udp4", "1.1.1.1:53")
+	if err != nil {
+		return fmt.Errorf("No default route: %v", err)
+	}
+	conn.Close()
+
+	if _, err := net.LookupHost(networkCheckHost); err != nil {
+		return fmt.Errorf("DNS lookup failed: %v", err)
+	}
+
+	return nil
+}
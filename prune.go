@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/jonegerton/go-cloudflare-ddns/ddns"
+)
+
+//runPrune deletes the records the utility manages in the zone, after listing them and asking for confirmation
+func runPrune() (err error) {
+
+	updater, err := newUpdater(nil)
+	if err != nil {
+		return
+	}
+
+	records, err := updater.OwnedRecords()
+	if err != nil {
+		return
+	}
+	if len(records) == 0 {
+		fmt.Println("No records in the zone are marked as managed by go-cloudflare-ddns.")
+		return
+	}
+
+	fmt.Printf("These %d records in %v are managed by go-cloudflare-ddns and will be deleted:\n", len(records), cfg.Zone)
+	for _, record := range records {
+		fmt.Printf("  %v\n", record)
+	}
+
+	if !assumeYes && !confirm("Delete them?") {
+		fmt.Println("Nothing deleted.")
+		return
+	}
+
+	return updater.DeleteRecords(records)
+}
+
+//confirmOwnership lists the records -take-ownership would adopt and asks for confirmation before any run changes them.
+//Without -yes, and with no answer, eg when not run from a terminal, it stops.
+func confirmOwnership(updater *ddns.Updater) (err error) {
+
+	records, err := updater.UnownedRecords()
+	if err != nil || len(records) == 0 {
+		return
+	}
+
+	fmt.Printf("These %d records in %v are not marked as managed by go-cloudflare-ddns, and -take-ownership will update and mark them:\n", len(records), cfg.Zone)
+	for _, record := range records {
+		fmt.Printf("  %v\n", record)
+	}
+
+	if !assumeYes && !confirm("Take ownership of them?") {
+		return fmt.Errorf("Not taking ownership of the records - nothing changed. Run with -yes to take ownership without asking")
+	}
+
+	return
+}
+
+//confirm asks a yes/no question on the terminal, taking anything but yes as no
+func confirm(question string) bool {
+
+	fmt.Printf("%v Type yes to continue: ", question)
+
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	return strings.EqualFold(strings.TrimSpace(answer), "yes")
+}
@@ -0,0 +1,140 @@
+//Package schedule runs a task at an interval, with jitter, backing off after failures and running early when triggered.
+//
+//It is the scheduling used by go-cloudflare-ddns when running at an interval, and its Backoff is the doubling wait
+//used for retries, cooldowns and reminders, so they all behave the same way however the utility is run.
+package schedule
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand/v2"
+	"time"
+)
+
+//Backoff is a wait that starts at Initial and doubles with each failure in a row, up to Max. A Max of 0 doesn't limit it.
+type Backoff struct {
+	Initial time.Duration
+	Max     time.Duration
+}
+
+//Delay returns the wait after the given number of failures in a row, Initial after the first. Without any failures,
+//or an Initial, there is no wait.
+func (b Backoff) Delay(failures int) (delay time.Duration) {
+
+	if failures <= 0 || b.Initial <= 0 {
+		return 0
+	}
+
+	delay = b.Initial
+	for i := 1; i < failures && (b.Max <= 0 || delay < b.Max); i++ {
+		//Stop doubling before the duration overflows
+		if delay > math.MaxInt64/2 {
+			break
+		}
+		delay *= 2
+	}
+	if b.Max > 0 && delay > b.Max {
+		delay = b.Max
+	}
+
+	return
+}
+
+//Jitter returns d with a random wait of up to jitter added, so instances started together don't stay in step
+func Jitter(d time.Duration, jitter time.Duration) time.Duration {
+	if jitter <= 0 {
+		return d
+	}
+	return d + rand.N(jitter)
+}
+
+//Schedule runs a task at Interval, counted from the start of each run. A run taking longer than the interval is
+//followed straight away by the next, rather than the runs piling up.
+type Schedule struct {
+	Interval time.Duration
+
+	//InitialDelay is a wait before the first run, and RunOnStart runs the task then rather than after the first interval
+	InitialDelay time.Duration
+	RunOnStart   bool
+
+	//Jitter adds a random wait of up to this long before each run
+	Jitter time.Duration
+
+	//Retry is the wait after a failed run, when sooner than the interval, doubling with each failure in a row.
+	//With no Retry.Initial a failed run waits for the interval as any other.
+	Retry Backoff
+
+	//Waiting is called with the wait before each run, eg for logging, and the number of failed runs in a row
+	Waiting func(wait time.Duration, failures int)
+
+	trigger chan struct{}
+}
+
+//New returns a schedule running at interval, from the first interval
+func New(interval time.Duration) *Schedule {
+	return &Schedule{Interval: interval, trigger: make(chan struct{}, 1)}
+}
+
+//Trigger makes the schedule run the task straight away, or as soon as the current run finishes. Triggers while a run
+//is waiting to start are combined into one run. The next interval is counted from the triggered run.
+func (s *Schedule) Trigger() {
+	select {
+	case s.trigger <- struct{}{}:
+	default:
+	}
+}
+
+//Run runs task on the schedule until ctx is cancelled, returning ctx's error. An error from task doesn't end the
+//schedule, it is only counted towards the Retry backoff, so task should report its own errors.
+func (s *Schedule) Run(ctx context.Context, task func(ctx context.Context) error) error {
+
+	if s.Interval <= 0 {
+		return errors.New("A schedule needs an interval")
+	}
+	if s.trigger == nil {
+		return errors.New("A schedule must be created with New")
+	}
+
+	failures := 0
+	wait := s.InitialDelay
+	if !s.RunOnStart {
+		wait += s.Interval
+	}
+	wait = Jitter(wait, s.Jitter)
+
+	for {
+		if s.Waiting != nil {
+			s.Waiting(wait, failures)
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+			//A trigger at the same moment is covered by this run
+			select {
+			case <-s.trigger:
+			default:
+			}
+		case <-s.trigger:
+			timer.Stop()
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+
+		started := time.Now()
+		if err := task(ctx); err != nil {
+			failures++
+		} else {
+			failures = 0
+		}
+
+		//A retry is counted from the end of the failed run, and only used when sooner than the interval
+		wait = max(s.Interval-time.Since(started), 0)
+		if retry := s.Retry.Delay(failures); retry > 0 && retry < wait {
+			wait = retry
+		}
+		wait = Jitter(wait, s.Jitter)
+	}
+}
@@ -0,0 +1,226 @@
+package schedule
+
+import (
+	"context"
+	"errors"
+	"math"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestBackoffDelay(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		backoff  Backoff
+		failures int
+		want     time.Duration
+	}{
+		{"no failures", Backoff{Initial: time.Second, Max: time.Minute}, 0, 0},
+		{"negative failures", Backoff{Initial: time.Second, Max: time.Minute}, -1, 0},
+		{"no initial", Backoff{Max: time.Minute}, 3, 0},
+		{"first failure", Backoff{Initial: 5 * time.Second}, 1, 5 * time.Second},
+		{"doubles", Backoff{Initial: 5 * time.Second}, 3, 20 * time.Second},
+		{"below the cap", Backoff{Initial: time.Minute, Max: 30 * time.Minute}, 5, 16 * time.Minute},
+		{"capped", Backoff{Initial: time.Minute, Max: 30 * time.Minute}, 6, 30 * time.Minute},
+		{"capped after many failures", Backoff{Initial: time.Minute, Max: 30 * time.Minute}, 1000, 30 * time.Minute},
+		{"max below initial", Backoff{Initial: time.Hour, Max: time.Minute}, 1, time.Minute},
+		{"many failures without a cap", Backoff{Initial: time.Hour}, 200, 2097152 * time.Hour},
+		{"huge failure count", Backoff{Initial: time.Nanosecond}, math.MaxInt32, time.Duration(1 << 62)},
+		{"huge failure count capped", Backoff{Initial: time.Nanosecond, Max: time.Hour}, math.MaxInt32, time.Hour},
+	}
+
+	for _, test := range tests {
+		if got := test.backoff.Delay(test.failures); got != test.want {
+			t.Errorf("%v: Delay(%d) = %v, expected %v", test.name, test.failures, got, test.want)
+		}
+	}
+}
+
+func TestJitter(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		d      time.Duration
+		jitter time.Duration
+	}{
+		{"no jitter", time.Minute, 0},
+		{"negative jitter", time.Minute, -time.Second},
+		{"jitter", time.Minute, 30 * time.Second},
+		{"jitter on no wait", 0, time.Second},
+	}
+
+	for _, test := range tests {
+		for i := 0; i < 100; i++ {
+			got := Jitter(test.d, test.jitter)
+			if got < test.d || got >= test.d+max(test.jitter, 1) {
+				t.Fatalf("%v: Jitter(%v, %v) = %v, expected from %v up to %v", test.name, test.d, test.jitter, got, test.d, test.d+test.jitter)
+			}
+		}
+	}
+}
+
+//runFor runs s for d, returning how long after the start each run began
+func runFor(t *testing.T, s *Schedule, d time.Duration, task func(run int) error) (runs []time.Duration) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+
+	started := time.Now()
+	err := s.Run(ctx, func(ctx context.Context) error {
+		runs = append(runs, time.Since(started))
+		return task(len(runs))
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Run returned %v, expected the context's error", err)
+	}
+
+	return
+}
+
+func TestRunNeedsInterval(t *testing.T) {
+
+	if err := New(0).Run(context.Background(), func(context.Context) error { return nil }); err == nil {
+		t.Error("Run with no interval returned no error")
+	}
+	if err := (&Schedule{Interval: time.Second}).Run(context.Background(), func(context.Context) error { return nil }); err == nil {
+		t.Error("Run of a schedule not made by New returned no error")
+	}
+}
+
+func TestRunOnStart(t *testing.T) {
+
+	tests := []struct {
+		name         string
+		runOnStart   bool
+		initialDelay time.Duration
+		wantFirst    time.Duration
+	}{
+		{"run on start", true, 0, 0},
+		{"run on start after a delay", true, 40 * time.Millisecond, 40 * time.Millisecond},
+		{"wait for the interval", false, 0, 100 * time.Millisecond},
+		{"wait for the delay and the interval", false, 40 * time.Millisecond, 140 * time.Millisecond},
+	}
+
+	for _, test := range tests {
+		s := New(100 * time.Millisecond)
+		s.RunOnStart = test.runOnStart
+		s.InitialDelay = test.initialDelay
+
+		runs := runFor(t, s, 250*time.Millisecond, func(int) error { return nil })
+		if len(runs) == 0 {
+			t.Errorf("%v: no runs", test.name)
+			continue
+		}
+		if runs[0] < test.wantFirst || runs[0] > test.wantFirst+30*time.Millisecond {
+			t.Errorf("%v: first run after %v, expected %v", test.name, runs[0], test.wantFirst)
+		}
+		for i := 1; i < len(runs); i++ {
+			if gap := runs[i] - runs[i-1]; gap < 100*time.Millisecond || gap > 130*time.Millisecond {
+				t.Errorf("%v: run %d was %v after the one before, expected the interval", test.name, i+1, gap)
+			}
+		}
+	}
+}
+
+func TestRunRetry(t *testing.T) {
+
+	s := New(time.Second)
+	s.RunOnStart = true
+	s.Retry = Backoff{Initial: 20 * time.Millisecond}
+
+	var failures []int
+	s.Waiting = func(wait time.Duration, failed int) {
+		failures = append(failures, failed)
+	}
+
+	//Fails three times, then succeeds and waits for the interval
+	runs := runFor(t, s, 400*time.Millisecond, func(run int) error {
+		if run <= 3 {
+			return errors.New("failed")
+		}
+		return nil
+	})
+
+	if len(runs) != 4 {
+		t.Fatalf("%d runs at %v, expected 4", len(runs), runs)
+	}
+	for i, want := range []time.Duration{20, 40, 80} {
+		want *= time.Millisecond
+		if gap := runs[i+1] - runs[i]; gap < want || gap > want+30*time.Millisecond {
+			t.Errorf("Retry %d was %v after the failure, expected %v", i+1, gap, want)
+		}
+	}
+	if want := []int{0, 1, 2, 3, 0}; !slices.Equal(failures, want) {
+		t.Errorf("Waiting saw failures %v, expected %v", failures, want)
+	}
+}
+
+func TestRunRetryNotLongerThanInterval(t *testing.T) {
+
+	s := New(50 * time.Millisecond)
+	s.RunOnStart = true
+	s.Retry = Backoff{Initial: time.Second}
+
+	runs := runFor(t, s, 180*time.Millisecond, func(int) error { return errors.New("failed") })
+	if len(runs) < 3 {
+		t.Errorf("%d runs at %v, expected a run every interval", len(runs), runs)
+	}
+}
+
+func TestTrigger(t *testing.T) {
+
+	s := New(time.Hour)
+
+	go func() {
+		time.Sleep(30 * time.Millisecond)
+		s.Trigger()
+		time.Sleep(50 * time.Millisecond)
+		s.Trigger()
+	}()
+
+	runs := runFor(t, s, 150*time.Millisecond, func(int) error { return nil })
+	if len(runs) != 2 {
+		t.Fatalf("%d runs at %v, expected one for each trigger", len(runs), runs)
+	}
+	if runs[0] < 30*time.Millisecond || runs[0] > 60*time.Millisecond {
+		t.Errorf("First triggered run after %v, expected 30ms", runs[0])
+	}
+}
+
+func TestTriggersCombined(t *testing.T) {
+
+	s := New(time.Hour)
+
+	//Triggers before the schedule starts are combined into one run straight away
+	s.Trigger()
+	s.Trigger()
+	s.Trigger()
+
+	runs := runFor(t, s, 50*time.Millisecond, func(int) error { return nil })
+	if len(runs) != 1 {
+		t.Errorf("%d runs at %v, expected triggers to be combined into one", len(runs), runs)
+	}
+}
+
+func TestTriggerDuringRun(t *testing.T) {
+
+	s := New(time.Hour)
+	s.RunOnStart = true
+
+	//A trigger while the first run is under way is followed by another run when it finishes
+	runs := runFor(t, s, 100*time.Millisecond, func(run int) error {
+		if run == 1 {
+			s.Trigger()
+			time.Sleep(20 * time.Millisecond)
+		}
+		return nil
+	})
+	if len(runs) != 2 {
+		t.Fatalf("%d runs at %v, expected the triggered run after the first", len(runs), runs)
+	}
+	if gap := runs[1] - runs[0]; gap < 20*time.Millisecond || gap > 50*time.Millisecond {
+		t.Errorf("Triggered run was %v after the first, expected as soon as it finished", gap)
+	}
+}
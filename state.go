@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/jonegerton/go-cloudflare-ddns/ddns"
+)
+
+//runState lists, restores or forgets the saved state of hosts archived when they were removed from the host list.
+//names limits restore and gc to those hosts.
+func runState(subcommand string, names []string) (err error) {
+
+	updater, err := newUpdater(nil)
+	if err != nil {
+		return
+	}
+
+	var archived []ddns.ArchivedHost
+	switch subcommand {
+	case "list":
+		if archived, err = updater.ArchivedHosts(); err != nil {
+			return
+		}
+		if len(archived) == 0 {
+			fmt.Println("No archived hosts.")
+		}
+		for _, a := range archived {
+			fmt.Printf("  %v\n", a)
+		}
+
+	case "restore":
+		if archived, err = updater.RestoreHosts(names); err != nil {
+			return
+		}
+		if len(archived) == 0 {
+			fmt.Println("No archived hosts to restore.")
+		}
+		for _, a := range archived {
+			fmt.Printf("Restored %v\n", a)
+		}
+		if len(archived) > 0 {
+			fmt.Println("Add them back to the host list, and they will only be updated if the IP has changed since.")
+		}
+
+	case "gc":
+		all, listErr := updater.ArchivedHosts()
+		if listErr != nil {
+			return listErr
+		}
+		if len(all) == 0 {
+			fmt.Println("No archived hosts.")
+			return
+		}
+		if len(names) == 0 {
+			fmt.Printf("The saved state of these %d archived hosts will be deleted:\n", len(all))
+			for _, a := range all {
+				fmt.Printf("  %v\n", a)
+			}
+			if !assumeYes && !confirm("Delete it?") {
+				fmt.Println("Nothing deleted.")
+				return
+			}
+		}
+		if archived, err = updater.ForgetArchivedHosts(names); err != nil {
+			return
+		}
+		for _, a := range archived {
+			fmt.Printf("Deleted the archived state of %v\n", a)
+		}
+
+	default:
+		return fmt.Errorf("Unknown state command '%v' (expected state list, state restore or state gc)", subcommand)
+	}
+
+	return
+}